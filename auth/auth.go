@@ -0,0 +1,255 @@
+// Package auth authenticates the clients which call the party service, with basic auth or signed bearer tokens, and
+// checks they're allowed to use each route.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// Scopes a client can be granted. A client with AllScopes can use every route.
+const (
+	AllScopes         = "*"
+	ReadRespondents   = "respondents:read"
+	WriteRespondents  = "respondents:write"
+	DeleteRespondents = "respondents:delete"
+	ReadBusinesses    = "businesses:read"
+	WriteBusinesses   = "businesses:write"
+	ReadOutbox        = "outbox:read"
+	ReadHistory       = "history:read"
+	ManageWebhooks    = "webhooks:manage"
+)
+
+// ClientConfig is the credentials and scopes for one client of the service
+type ClientConfig struct {
+	Name     string
+	User     string
+	Password string
+	Scopes   []string
+}
+
+// Client is an authenticated caller of the service. Clients authenticated by a token are named after its subject,
+// and have the roles it lists.
+type Client struct {
+	Name   string
+	Roles  []string
+	scopes map[string]bool
+}
+
+// HasRole reports whether the client has the role, as given by its token
+func (c *Client) HasRole(role string) bool {
+	for _, has := range c.Roles {
+		if has == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the client is allowed to use routes which require the scope
+func (c *Client) HasScope(scope string) bool {
+	return c.scopes[AllScopes] || c.scopes[scope]
+}
+
+type credentials struct {
+	client   *Client
+	password [sha256.Size]byte
+}
+
+// Authenticator checks requests' basic auth credentials against the clients it knows, and their bearer tokens if it
+// accepts them
+type Authenticator struct {
+	users  map[string]credentials
+	tokens *TokenVerifier
+}
+
+// New returns an authenticator for the clients provided, each of which must have its own user name and a password
+func New(clients ...ClientConfig) (*Authenticator, error) {
+	a := &Authenticator{users: map[string]credentials{}}
+	for _, config := range clients {
+		if config.User == "" || config.Password == "" {
+			return nil, fmt.Errorf("client %s needs a user name and password", config.Name)
+		}
+		if _, ok := a.users[config.User]; ok {
+			return nil, fmt.Errorf("client %s has the same user name as another client", config.Name)
+		}
+		client := &Client{Name: config.Name, scopes: map[string]bool{}}
+		for _, scope := range config.Scopes {
+			client.scopes[scope] = true
+		}
+		a.users[config.User] = credentials{client: client, password: sha256.Sum256([]byte(config.Password))}
+	}
+	return a, nil
+}
+
+// WithTokens returns a copy of the authenticator which also accepts bearer tokens checked by the verifier. Requests
+// without a bearer token fall back to basic auth, if the authenticator has any clients to check it against.
+func (a *Authenticator) WithTokens(verifier *TokenVerifier) *Authenticator {
+	return &Authenticator{users: a.users, tokens: verifier}
+}
+
+// Authenticate returns the client with the user name and password provided, if there is one. Passwords are compared
+// in constant time, whether or not the user exists.
+func (a *Authenticator) Authenticate(user, password string) (*Client, bool) {
+	found, ok := a.users[user]
+	given := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(given[:], found.password[:]) != 1 || !ok {
+		return nil, false
+	}
+	return found.client, true
+}
+
+// Require only serves requests from clients with the scope provided. Others are refused with a 401 if they can't be
+// authenticated, or a 403 if they can but don't have the scope.
+func (a *Authenticator) Require(scope string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		client, ok := a.authenticateRequest(r)
+		if !ok {
+			if a.tokens != nil {
+				w.Header().Add("WWW-Authenticate", "Bearer")
+			}
+			if len(a.users) > 0 {
+				w.Header().Add("WWW-Authenticate", "Basic realm=Restricted")
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		if !client.HasScope(scope) {
+			w.WriteHeader(http.StatusForbidden)
+			errorString := models.Error{
+				Error: "Client " + client.Name + " doesn't have the " + scope + " scope",
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+
+		h(w, r.WithContext(WithClient(r.Context(), client)), ps)
+	}
+}
+
+// Returns the client making the request, from its bearer token or basic auth credentials
+func (a *Authenticator) authenticateRequest(r *http.Request) (*Client, bool) {
+	header := r.Header.Get("Authorization")
+	if a.tokens != nil && len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		client, err := a.tokens.Verify(header[len("Bearer "):])
+		if err != nil {
+			logging.FromContext(r.Context()).Info("Rejected bearer token", zap.Error(err))
+			return nil, false
+		}
+		return client, true
+	}
+
+	user, password, hasAuth := r.BasicAuth()
+	if !hasAuth {
+		return nil, false
+	}
+	return a.Authenticate(user, password)
+}
+
+type contextKey struct{}
+
+// WithClient returns a copy of the context which carries the authenticated client
+func WithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// ClientFromContext returns the authenticated client the context carries, or nil if there isn't one
+func ClientFromContext(ctx context.Context) *Client {
+	client, _ := ctx.Value(contextKey{}).(*Client)
+	return client
+}
+
+// Config is where client settings are looked up, e.g. viper
+type Config interface {
+	GetString(key string) string
+}
+
+// LoadClients reads the clients named in auth_clients, a comma or space separated list, from the config. Each client
+// name's settings are auth_client_<name>_user (which defaults to the name), auth_client_<name>_password, or
+// auth_client_<name>_password_file for a mounted secret, and auth_client_<name>_scopes, with any hyphens in the name
+// replaced by underscores.
+//
+// If no clients are named, there's a single client, "default", with every scope and the credentials in
+// security_user_name and security_user_password.
+func LoadClients(config Config) ([]ClientConfig, error) {
+	names := splitList(config.GetString("auth_clients"))
+	if len(names) == 0 {
+		return []ClientConfig{{
+			Name:     "default",
+			User:     config.GetString("security_user_name"),
+			Password: config.GetString("security_user_password"),
+			Scopes:   []string{AllScopes},
+		}}, nil
+	}
+
+	clients := make([]ClientConfig, len(names))
+	for idx, name := range names {
+		prefix := "auth_client_" + strings.ReplaceAll(strings.ToLower(name), "-", "_") + "_"
+		client := ClientConfig{
+			Name:     name,
+			User:     config.GetString(prefix + "user"),
+			Password: config.GetString(prefix + "password"),
+			Scopes:   splitList(config.GetString(prefix + "scopes")),
+		}
+		if client.User == "" {
+			client.User = name
+		}
+		if file := config.GetString(prefix + "password_file"); file != "" {
+			secret, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("can't read password for client %s: %w", name, err)
+			}
+			client.Password = strings.TrimRight(string(secret), "\r\n")
+		}
+		if len(client.Scopes) == 0 {
+			return nil, errors.New("client " + name + " has no scopes")
+		}
+		clients[idx] = client
+	}
+	return clients, nil
+}
+
+func splitList(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// LoadTokenConfig reads the tokens to accept from the config: jwt_issuer, jwt_audience, jwt_jwks_file, jwt_secret, or
+// jwt_secret_file for a mounted secret, and jwt_leeway.
+func LoadTokenConfig(config Config) (TokenConfig, error) {
+	tokens := TokenConfig{
+		Issuer:   config.GetString("jwt_issuer"),
+		Audience: config.GetString("jwt_audience"),
+		Secret:   []byte(config.GetString("jwt_secret")),
+		JWKSFile: config.GetString("jwt_jwks_file"),
+	}
+	if file := config.GetString("jwt_secret_file"); file != "" {
+		secret, err := ioutil.ReadFile(file)
+		if err != nil {
+			return TokenConfig{}, fmt.Errorf("can't read token secret: %w", err)
+		}
+		tokens.Secret = []byte(strings.TrimRight(string(secret), "\r\n"))
+	}
+	if leeway := config.GetString("jwt_leeway"); leeway != "" {
+		var err error
+		if tokens.Leeway, err = time.ParseDuration(leeway); err != nil {
+			return TokenConfig{}, fmt.Errorf("invalid token leeway: %w", err)
+		}
+	}
+	return tokens, nil
+}
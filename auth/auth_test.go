@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+// A config read from a map, in place of viper
+type mapConfig map[string]string
+
+func (m mapConfig) GetString(key string) string {
+	return m[key]
+}
+
+func newAuthenticator(t *testing.T) *Authenticator {
+	a, err := New(
+		ClientConfig{Name: "frontstage", User: "frontstage", Password: "frontstage-secret", Scopes: []string{ReadRespondents, WriteRespondents}},
+		ClientConfig{Name: "batch", User: "batch", Password: "batch-secret", Scopes: []string{ReadRespondents}},
+	)
+	if err != nil {
+		t.Fatal("Error creating authenticator, ", err.Error())
+	}
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newAuthenticator(t)
+
+	client, ok := a.Authenticate("batch", "batch-secret")
+	assert.True(t, ok)
+	assert.Equal(t, "batch", client.Name)
+
+	_, ok = a.Authenticate("batch", "frontstage-secret")
+	assert.False(t, ok)
+	_, ok = a.Authenticate("someone", "batch-secret")
+	assert.False(t, ok)
+	_, ok = a.Authenticate("", "")
+	assert.False(t, ok)
+}
+
+func TestNewRejectsBadClients(t *testing.T) {
+	_, err := New(ClientConfig{Name: "batch", User: "batch"})
+	assert.Equal(t, "client batch needs a user name and password", err.Error())
+
+	_, err = New(ClientConfig{Name: "batch", User: "admin", Password: "a"}, ClientConfig{Name: "frontstage", User: "admin", Password: "b"})
+	assert.Equal(t, "client frontstage has the same user name as another client", err.Error())
+}
+
+func TestHasScope(t *testing.T) {
+	admin := &Client{Name: "default", scopes: map[string]bool{AllScopes: true}}
+	batch := &Client{Name: "batch", scopes: map[string]bool{ReadRespondents: true}}
+
+	assert.True(t, admin.HasScope(DeleteRespondents))
+	assert.True(t, batch.HasScope(ReadRespondents))
+	assert.False(t, batch.HasScope(DeleteRespondents))
+}
+
+func serveWithAuth(a *Authenticator, scope, user, password string) (*httptest.ResponseRecorder, *Client) {
+	var client *Client
+	handler := a.Require(scope, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		client = ClientFromContext(r.Context())
+	})
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/v2/respondents/abc", nil)
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	handler(resp, req, nil)
+	return resp, client
+}
+
+func TestRequireServesClientWithScope(t *testing.T) {
+	resp, client := serveWithAuth(newAuthenticator(t), ReadRespondents, "batch", "batch-secret")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "batch", client.Name)
+}
+
+func TestRequireRefusesUnauthenticated(t *testing.T) {
+	resp, client := serveWithAuth(newAuthenticator(t), ReadRespondents, "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Basic realm=Restricted", resp.Header().Get("WWW-Authenticate"))
+	assert.Nil(t, client)
+
+	resp, client = serveWithAuth(newAuthenticator(t), ReadRespondents, "batch", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Nil(t, client)
+}
+
+func TestRequireForbidsClientWithoutScope(t *testing.T) {
+	resp, client := serveWithAuth(newAuthenticator(t), DeleteRespondents, "batch", "batch-secret")
+
+	var errResp models.Error
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatal("Error decoding JSON response, ", err.Error())
+	}
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "Client batch doesn't have the respondents:delete scope", errResp.Error)
+	assert.Nil(t, client)
+}
+
+func TestLoadClientsDefaultsToSecurityUser(t *testing.T) {
+	clients, err := LoadClients(mapConfig{"security_user_name": "admin", "security_user_password": "secret"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ClientConfig{{Name: "default", User: "admin", Password: "secret", Scopes: []string{AllScopes}}}, clients)
+}
+
+func TestLoadClients(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	ioutil.WriteFile(secret, []byte("batch-secret\n"), 0600)
+
+	clients, err := LoadClients(mapConfig{
+		"auth_clients":                             "frontstage, response-operations,batch",
+		"auth_client_frontstage_password":          "frontstage-secret",
+		"auth_client_frontstage_scopes":            "respondents:read,respondents:write",
+		"auth_client_response_operations_user":     "rops",
+		"auth_client_response_operations_password": "rops-secret",
+		"auth_client_response_operations_scopes":   "*",
+		"auth_client_batch_password_file":          secret,
+		"auth_client_batch_scopes":                 "respondents:read",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ClientConfig{
+		{Name: "frontstage", User: "frontstage", Password: "frontstage-secret", Scopes: []string{ReadRespondents, WriteRespondents}},
+		{Name: "response-operations", User: "rops", Password: "rops-secret", Scopes: []string{AllScopes}},
+		{Name: "batch", User: "batch", Password: "batch-secret", Scopes: []string{ReadRespondents}},
+	}, clients)
+}
+
+func TestLoadClientsRejectsBadClients(t *testing.T) {
+	_, err := LoadClients(mapConfig{"auth_clients": "batch", "auth_client_batch_password": "batch-secret"})
+	assert.Equal(t, "client batch has no scopes", err.Error())
+
+	_, err = LoadClients(mapConfig{"auth_clients": "batch", "auth_client_batch_password_file": "missing", "auth_client_batch_scopes": "*"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenConfig says which bearer tokens to accept. Tokens signed with RS256 are checked against the keys in the JWKS
+// file, and those signed with HS256 against the secret, so at least one of them is needed.
+type TokenConfig struct {
+	Issuer   string
+	Audience string
+	Secret   []byte
+	JWKSFile string
+	// Leeway is how far the clocks of the service issuing tokens and this one may disagree
+	Leeway time.Duration
+}
+
+// TokenVerifier checks signed JWTs and turns them into the clients they identify
+type TokenVerifier struct {
+	config TokenConfig
+	keys   map[string]*rsa.PublicKey
+	parser *jwt.Parser
+}
+
+// The claims of a token, beyond the registered ones, which say what the caller can do
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	// Scope is the caller's scopes, separated by spaces
+	Scope string   `json:"scope"`
+	Roles []string `json:"roles"`
+}
+
+// NewTokenVerifier returns a verifier for tokens from the issuer, for the audience, in the config
+func NewTokenVerifier(config TokenConfig) (*TokenVerifier, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("tokens need an issuer and audience to check")
+	}
+
+	v := &TokenVerifier{config: config, keys: map[string]*rsa.PublicKey{}}
+	var methods []string
+	if len(config.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if config.JWKSFile != "" {
+		var err error
+		if v.keys, err = loadJWKS(config.JWKSFile); err != nil {
+			return nil, err
+		}
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("tokens need a secret or a JWKS file to check their signatures")
+	}
+
+	v.parser = jwt.NewParser(jwt.WithValidMethods(methods), jwt.WithoutClaimsValidation())
+	return v, nil
+}
+
+// Verify returns the client the token identifies, if its signature is valid and it's for this service and current
+func (v *TokenVerifier) Verify(token string) (*Client, error) {
+	claims := &tokenClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.key); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-v.config.Leeway), true) {
+		return nil, errors.New("token has expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(v.config.Leeway), false) {
+		return nil, errors.New("token isn't valid yet")
+	}
+	if !claims.VerifyIssuer(v.config.Issuer, true) {
+		return nil, errors.New("token is from the wrong issuer")
+	}
+	if !claims.VerifyAudience(v.config.Audience, true) {
+		return nil, errors.New("token is for the wrong audience")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	client := &Client{Name: claims.Subject, Roles: claims.Roles, scopes: map[string]bool{}}
+	for _, scope := range strings.Fields(claims.Scope) {
+		client.scopes[scope] = true
+	}
+	return client, nil
+}
+
+// Returns the key to check the token's signature with
+func (v *TokenVerifier) key(token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		return v.config.Secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key with ID %q", kid)
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// Reads the RSA signing keys from a JSON Web Key Set file, by key ID
+func loadJWKS(file string) (map[string]*rsa.PublicKey, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("can't read JWKS file: %w", err)
+	}
+	var set jwks
+	if err = json.Unmarshal(content, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS file: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %w", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS file has no RSA signing keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+var secret = []byte("a-secret-shared-with-the-issuer")
+
+// Returns claims for a current token, for the party service, from the issuer the tests expect
+func validClaims() tokenClaims {
+	return tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "frontstage",
+			Issuer:    "https://auth.example.com",
+			Audience:  jwt.ClaimStrings{"ras-rm-party"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Scope: "respondents:read respondents:write",
+		Roles: []string{"respondent-admin"},
+	}
+}
+
+func signHS256(t *testing.T, claims tokenClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		t.Fatal("Error signing token, ", err.Error())
+	}
+	return token
+}
+
+// Generates an RSA key, and writes its public half to a JWKS file, returning the key and the file's path
+func writeJWKS(t *testing.T, kid string) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Error generating key, ", err.Error())
+	}
+	set := map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	content, _ := json.Marshal(set)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	ioutil.WriteFile(file, content, 0600)
+	return key, file
+}
+
+func newVerifier(t *testing.T, config TokenConfig) *TokenVerifier {
+	config.Issuer, config.Audience = "https://auth.example.com", "ras-rm-party"
+	v, err := NewTokenVerifier(config)
+	if err != nil {
+		t.Fatal("Error creating token verifier, ", err.Error())
+	}
+	return v
+}
+
+func TestVerifyHS256Token(t *testing.T) {
+	client, err := newVerifier(t, TokenConfig{Secret: secret}).Verify(signHS256(t, validClaims()))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "frontstage", client.Name)
+	assert.Equal(t, []string{"respondent-admin"}, client.Roles)
+	assert.True(t, client.HasRole("respondent-admin"))
+	assert.True(t, client.HasScope(WriteRespondents))
+	assert.False(t, client.HasScope(DeleteRespondents))
+}
+
+func TestVerifyRS256TokenFromJWKS(t *testing.T) {
+	key, file := writeJWKS(t, "key-1")
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal("Error signing token, ", err.Error())
+	}
+
+	client, err := newVerifier(t, TokenConfig{JWKSFile: file}).Verify(signed)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "frontstage", client.Name)
+}
+
+func TestVerifyRejectsUnknownKey(t *testing.T) {
+	key, file := writeJWKS(t, "key-1")
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	token.Header["kid"] = "key-2"
+	signed, _ := token.SignedString(key)
+
+	_, err := newVerifier(t, TokenConfig{JWKSFile: file}).Verify(signed)
+
+	assert.NotNil(t, err)
+}
+
+func TestVerifyRejectsMethodsNotConfigured(t *testing.T) {
+	_, file := writeJWKS(t, "key-1")
+
+	_, err := newVerifier(t, TokenConfig{JWKSFile: file}).Verify(signHS256(t, validClaims()))
+	assert.NotNil(t, err)
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = newVerifier(t, TokenConfig{Secret: secret}).Verify(unsigned)
+	assert.NotNil(t, err)
+}
+
+func TestVerifyChecksClaims(t *testing.T) {
+	v := newVerifier(t, TokenConfig{Secret: secret, Leeway: 30 * time.Second})
+
+	for message, change := range map[string]func(*tokenClaims){
+		"token has expired":               func(c *tokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) },
+		"token isn't valid yet":           func(c *tokenClaims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) },
+		"token is from the wrong issuer":  func(c *tokenClaims) { c.Issuer = "https://elsewhere.example.com" },
+		"token is for the wrong audience": func(c *tokenClaims) { c.Audience = jwt.ClaimStrings{"ras-rm-case"} },
+		"token has no subject":            func(c *tokenClaims) { c.Subject = "" },
+	} {
+		claims := validClaims()
+		change(&claims)
+		_, err := v.Verify(signHS256(t, claims))
+		if assert.NotNil(t, err, message) {
+			assert.Equal(t, message, err.Error())
+		}
+	}
+
+	claims := validClaims()
+	claims.ExpiresAt = nil
+	_, err := v.Verify(signHS256(t, claims))
+	assert.Equal(t, "token has expired", err.Error())
+
+	claims = validClaims()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second))
+	_, err = v.Verify(signHS256(t, claims))
+	assert.Nil(t, err)
+}
+
+func TestNewTokenVerifierNeedsKeys(t *testing.T) {
+	_, err := NewTokenVerifier(TokenConfig{Issuer: "https://auth.example.com", Audience: "ras-rm-party"})
+
+	assert.Equal(t, "tokens need a secret or a JWKS file to check their signatures", err.Error())
+}
+
+func serveWithToken(a *Authenticator, scope string, setAuth func(*http.Request)) (*httptest.ResponseRecorder, *Client) {
+	var client *Client
+	handler := a.Require(scope, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		client = ClientFromContext(r.Context())
+	})
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/respondents", nil)
+	setAuth(req)
+	handler(resp, req, nil)
+	return resp, client
+}
+
+func TestRequireAcceptsBearerTokens(t *testing.T) {
+	a := newAuthenticator(t).WithTokens(newVerifier(t, TokenConfig{Secret: secret}))
+	token := signHS256(t, validClaims())
+
+	resp, client := serveWithToken(a, ReadRespondents, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, []string{"respondent-admin"}, client.Roles)
+
+	resp, _ = serveWithToken(a, ReadRespondents, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token+"x") })
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, []string{"Bearer", "Basic realm=Restricted"}, resp.Header().Values("WWW-Authenticate"))
+
+	// Basic auth is the fallback for clients without tokens
+	resp, client = serveWithToken(a, ReadRespondents, func(r *http.Request) { r.SetBasicAuth("batch", "batch-secret") })
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "batch", client.Name)
+}
+
+func TestRequireWithOnlyTokensRefusesBasicAuth(t *testing.T) {
+	a, _ := New()
+	a = a.WithTokens(newVerifier(t, TokenConfig{Secret: secret}))
+
+	resp, _ := serveWithToken(a, ReadRespondents, func(r *http.Request) { r.SetBasicAuth("batch", "batch-secret") })
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Bearer", resp.Header().Get("WWW-Authenticate"))
+}
+
+func TestLoadTokenConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(file, append(secret, '\n'), 0600)
+
+	tokens, err := LoadTokenConfig(mapConfig{"jwt_issuer": "https://auth.example.com", "jwt_audience": "ras-rm-party", "jwt_secret_file": file, "jwt_leeway": "30s"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, TokenConfig{Issuer: "https://auth.example.com", Audience: "ras-rm-party", Secret: secret, Leeway: 30 * time.Second}, tokens)
+}
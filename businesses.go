@@ -0,0 +1,574 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Parses a positive integer pagination parameter, falling back to the default if it wasn't provided
+func paginationParam(queryParams url.Values, name string, defaultValue int) (int, error) {
+	if queryParams.Get(name) == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(queryParams.Get(name))
+	if err != nil || value < 1 {
+		return 0, errors.New("Invalid value for " + name + ": " + queryParams.Get(name))
+	}
+	return value, nil
+}
+
+func getBusinesses(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	queryParams := r.URL.Query()
+	if _, ok := queryParams["ruRef"]; ok {
+		getBusinessByRef(w, r, businesses, strings.TrimSpace(queryParams.Get("ruRef")))
+		return
+	}
+
+	keywords := []string{}
+	for _, keyword := range queryParams["keyword"] {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	if len(keywords) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "No keyword provided for search",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	page, err := paginationParam(queryParams, "page", 1)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: err.Error(),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	limit, err := paginationParam(queryParams, "limit", 10)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: err.Error(),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	found, total, err := businesses.SearchBusinesses(r.Context(), store.BusinessSearch{Keywords: keywords, Page: page, Limit: limit})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if total == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "No businesses found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	response := models.BusinessSearch{
+		Data:  found,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Writes the business with the RU reference provided, as GET /businesses?ruRef= returns it
+func getBusinessByRef(w http.ResponseWriter, r *http.Request, businesses store.BusinessStore, ruRef string) {
+	if ruRef == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "No ruRef provided",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	business, err := businesses.GetBusinessByRef(r.Context(), ruRef)
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Business does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.Businesses{Data: []models.Business{business}})
+}
+
+// The most RU references which can be resolved in one request
+const maxResolvedRefs = 1000
+
+func resolveBusinesses(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	var resolveRequest models.ResolveBusinesses
+	err := json.NewDecoder(r.Body).Decode(&resolveRequest)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Invalid JSON",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	// Resolve each reference once, keeping the order they were asked for in
+	refs := []string{}
+	seen := map[string]bool{}
+	for _, ref := range resolveRequest.RURefs {
+		if ref = strings.TrimSpace(ref); ref != "" && !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "No ruRefs provided",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if len(refs) > maxResolvedRefs {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Too many ruRefs: at most " + strconv.Itoa(maxResolvedRefs) + " can be resolved at once",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	found, err := businesses.GetBusinessesByRefs(r.Context(), refs)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	byRef := map[string]models.Business{}
+	for _, business := range found {
+		byRef[business.SampleUnitRef] = business
+	}
+	response := models.ResolvedBusinesses{Data: []models.ResolvedBusiness{}, NotFound: []string{}}
+	for _, ref := range refs {
+		business, ok := byRef[ref]
+		if !ok {
+			response.NotFound = append(response.NotFound, ref)
+			continue
+		}
+		response.Data = append(response.Data, models.ResolvedBusiness{
+			RURef:      ref,
+			ID:         business.ID,
+			Name:       business.Name,
+			TradingAs:  business.TradingAs,
+			Attributes: business.Attributes,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func postBusinesses(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	var postRequest models.PostBusinesses
+	err := json.NewDecoder(r.Body).Decode(&postRequest)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Invalid JSON",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	missingFields := []string{}
+	if postRequest.Data.SampleUnitRef == "" {
+		missingFields = append(missingFields, "sampleUnitRef")
+	}
+	if postRequest.Data.Name == "" {
+		missingFields = append(missingFields, "name")
+	}
+
+	if len(missingFields) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Missing required fields: " + strings.Join(missingFields, ", "),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	businessID := postRequest.Data.ID
+	if businessID == "" {
+		businessID = uuid.New().String()
+	} else if _, err := uuid.Parse(businessID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + businessID,
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	business := postRequest.Data
+	business.ID = businessID
+	err = businesses.CreateBusiness(r.Context(), business)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	business.Associations = []models.Association{}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.Businesses{Data: []models.Business{business}})
+}
+
+func getBusinessByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	businessID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	collectionExerciseID := r.URL.Query().Get("collectionExerciseId")
+	if collectionExerciseID != "" {
+		if _, err := uuid.Parse(collectionExerciseID); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errorString := models.Error{
+				Error: "Not a valid ID: " + collectionExerciseID,
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+	}
+
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	var business models.Business
+	if collectionExerciseID != "" {
+		business, err = businesses.GetBusinessForCollectionExercise(r.Context(), businessID.String(), collectionExerciseID)
+	} else {
+		business, err = businesses.GetBusiness(r.Context(), businessID.String())
+	}
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Business does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.Businesses{Data: []models.Business{business}})
+}
+
+func patchBusinessByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	businessUUID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	var patchRequest models.PostBusinesses
+	err = json.NewDecoder(r.Body).Decode(&patchRequest)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Invalid JSON",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	if patchRequest.Data.ID != "" && patchRequest.Data.ID != businessUUID.String() {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "ID must not be changed",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	for _, sample := range patchRequest.Samples {
+		missingFields := []string{}
+		if sample.SampleSummaryID == "" {
+			missingFields = append(missingFields, "sampleSummaryId")
+		}
+		if sample.CollectionExerciseID == "" {
+			missingFields = append(missingFields, "collectionExerciseId")
+		}
+
+		if len(missingFields) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			errorString := models.Error{
+				Error: "Missing required fields in samples: " + strings.Join(missingFields, ", "),
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+
+		for _, sampleID := range []string{sample.SampleSummaryID, sample.CollectionExerciseID} {
+			if _, err := uuid.Parse(sampleID); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				errorString := models.Error{
+					Error: "Not a valid ID: " + sampleID,
+				}
+				json.NewEncoder(w).Encode(errorString)
+				return
+			}
+		}
+	}
+
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	businessID := businessUUID.String()
+	business, err := businesses.GetBusiness(r.Context(), businessID)
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Business does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if patchRequest.Data.SampleUnitRef != "" {
+		business.SampleUnitRef = patchRequest.Data.SampleUnitRef
+	}
+	if patchRequest.Data.SampleSummaryID != "" {
+		business.SampleSummaryID = patchRequest.Data.SampleSummaryID
+	}
+	if patchRequest.Data.Name != "" {
+		business.Name = patchRequest.Data.Name
+	}
+	if patchRequest.Data.TradingAs != "" {
+		business.TradingAs = patchRequest.Data.TradingAs
+	}
+	if !reflect.DeepEqual(models.BusinessAttributes{}, patchRequest.Data.Attributes) {
+		business.Attributes = patchRequest.Data.Attributes
+	}
+
+	err = businesses.UpdateBusiness(r.Context(), business, patchRequest.Samples)
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Business does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	// Re-read the business, as changing the attributes for another sample, or being added to one, changes its current
+	// state differently
+	business, err = businesses.GetBusiness(r.Context(), businessID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	samples, err := businesses.BusinessSamples(r.Context(), businessID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.Businesses{Data: []models.Business{business}, Samples: samples})
+}
+
+func getBusinessHistory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	businessID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	history, err := businesses.BusinessAttributesHistory(r.Context(), businessID.String())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if len(history) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "No history found for business ID " + businessID.String(),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.BusinessAttributesHistory{Data: history})
+}
+
+func putSampleLink(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sampleSummaryID, err := uuid.Parse(p.ByName("sampleSummaryId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("sampleSummaryId"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	var putRequest models.PutSampleLink
+	err = json.NewDecoder(r.Body).Decode(&putRequest)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Invalid JSON",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	if putRequest.CollectionExerciseID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Missing required fields: collectionExerciseId",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	collectionExerciseID, err := uuid.Parse(putRequest.CollectionExerciseID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + putRequest.CollectionExerciseID,
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	linked, err := businesses.LinkSampleSummary(r.Context(), sampleSummaryID.String(), collectionExerciseID.String())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SampleLink{
+		SampleSummaryID:      sampleSummaryID.String(),
+		CollectionExerciseID: collectionExerciseID.String(),
+		Businesses:           linked,
+	})
+}
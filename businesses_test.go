@@ -0,0 +1,1433 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var searchBusinessQueryColumns = []string{"party_uuid", "business_ref", "id", "sample_summary_id", "name", "trading_as", "attributes"}
+var searchBusinessAssociationsQueryColumns = []string{"business_id", "id", "first_name", "last_name", "survey_id", "enrolment_status"}
+var businessSamplesQueryColumns = []string{"sample_summary_id", "collection_exercise"}
+var businessAttributesJSON = []byte(`{"ruref":"49900000001","checkletter":"F","entname1":"Bolts and Ratchets Ltd","froempment":50,"frosic2007":"45320","cell_no":1}`)
+var postBusinessReq = models.PostBusinesses{
+	Data: models.Business{
+		SampleUnitRef:   "49900000001",
+		SampleSummaryID: "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		Name:            "Bolts and Ratchets Ltd",
+		TradingAs:       "Bolts and Ratchets",
+		Attributes: models.BusinessAttributes{
+			RURef:       "49900000001",
+			CheckLetter: "F",
+			EntName1:    "Bolts and Ratchets Ltd",
+			FroEmpment:  50,
+			FroSic2007:  "45320",
+			CellNo:      1,
+		},
+	},
+}
+
+func addBusinessRow(rows *sqlmock.Rows) *sqlmock.Rows {
+	return rows.AddRow("3b136c4b-7a14-4904-9e01-13364dd7b972", "49900000001", 1, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		"Bolts and Ratchets Ltd", "Bolts and Ratchets", businessAttributesJSON)
+}
+
+// GET /businesses?keyword=...
+
+func TestGetBusinesses(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs("%ratchets%", "%ratchets%", "%ratchets%").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("%ratchets%", "%ratchets%", "%ratchets%", 10, 0).WillReturnRows(returnRows)
+
+	associationRows := mock.NewRows(searchBusinessAssociationsQueryColumns)
+	associationRows.AddRow("3b136c4b-7a14-4904-9e01-13364dd7b972", "be70e086-7bbc-461c-a565-5b454d748a71", "Bob", "Boblaw", "5e237abd-f8dc-4cb0-829e-58d5cef8ca4a", "ENABLED")
+	associationRows.AddRow("3b136c4b-7a14-4904-9e01-13364dd7b972", "be70e086-7bbc-461c-a565-5b454d748a71", "Bob", "Boblaw", "84bc0d0a-ae32-4fb1-aabc-6de370245d62", "PENDING")
+	associationRows.AddRow("3b136c4b-7a14-4904-9e01-13364dd7b972", "2711912c-db86-4e1e-9728-fc28db049858", "Jim", "Jimbob", nil, nil)
+	mock.ExpectQuery(selectQueryRegex).WithArgs(pq.Array([]string{"3b136c4b-7a14-4904-9e01-13364dd7b972"})).WillReturnRows(associationRows)
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=ratchets", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var businesses models.BusinessSearch
+	err = json.NewDecoder(resp.Body).Decode(&businesses)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, businesses.Total)
+	assert.Equal(t, 1, businesses.Page)
+	assert.Equal(t, 10, businesses.Limit)
+	assert.Equal(t, 1, len(businesses.Data))
+	assert.Equal(t, "3b136c4b-7a14-4904-9e01-13364dd7b972", businesses.Data[0].ID)
+	assert.Equal(t, "Bolts and Ratchets Ltd", businesses.Data[0].Name)
+	assert.Equal(t, "F", businesses.Data[0].Attributes.CheckLetter)
+	assert.Equal(t, 50, businesses.Data[0].Attributes.FroEmpment)
+	assert.Equal(t, 2, len(businesses.Data[0].Associations))
+	assert.Equal(t, "Bob Boblaw", businesses.Data[0].Associations[0].Name)
+	assert.Equal(t, 2, len(businesses.Data[0].Associations[0].Enrolments))
+	assert.Equal(t, 0, len(businesses.Data[0].Associations[1].Enrolments))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBusinessesPaginatesAndMatchesAllKeywords(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs("%bolts%", "%bolts%", "%bolts%", "%ltd%", "%ltd%", "%ltd%").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(12))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("%bolts%", "%bolts%", "%bolts%", "%ltd%", "%ltd%", "%ltd%", 5, 10).WillReturnRows(mock.NewRows(searchBusinessQueryColumns))
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=bolts&keyword=ltd&page=3&limit=5", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var businesses models.BusinessSearch
+	err = json.NewDecoder(resp.Body).Decode(&businesses)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 12, businesses.Total)
+	assert.Equal(t, 3, businesses.Page)
+	assert.Equal(t, 5, businesses.Limit)
+	assert.Equal(t, 0, len(businesses.Data))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBusinessesEscapesWildcardsInKeyword(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(`%100\% \_pure\_%`, `%100\% \_pure\_%`, `%100\% \_pure\_%`).WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=100%25+_pure_", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBusinessesReturns400WhenBadPaginationProvided(t *testing.T) {
+	setup()
+
+	var err error
+	db, _, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=ratchets&limit=0", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Invalid value for limit: 0", errResp.Error)
+}
+
+func TestGetBusinessesReturns400WhenNoKeywordProvided(t *testing.T) {
+	setup()
+
+	var err error
+	db, _, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	req := httptest.NewRequest("GET", "/v2/businesses", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "No keyword provided for search", errResp.Error)
+}
+
+func TestGetBusinessesReturns401WhenNotAuthed(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=49900000001", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestGetBusinessesReturns404WhenNoResults(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=49900000001", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "No businesses found", errResp.Error)
+}
+
+func TestGetBusinessesReturns500WhenDBNotInit(t *testing.T) {
+	setup()
+
+	db = nil
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=49900000001", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Database connection could not be found", errResp.Error)
+}
+
+func TestGetBusinessesReturns500WhenDBDown(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WillReturnError(fmt.Errorf("Connection refused"))
+
+	req := httptest.NewRequest("GET", "/v2/businesses?keyword=49900000001", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Error querying DB: Connection refused", errResp.Error)
+}
+
+// GET /businesses?ruRef=...
+
+func TestGetBusinessesByRURef(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("49900000001").WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+
+	req := httptest.NewRequest("GET", "/v2/businesses?ruRef=49900000001", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var businesses models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&businesses)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses?ruRef=', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, len(businesses.Data))
+	assert.Equal(t, "3b136c4b-7a14-4904-9e01-13364dd7b972", businesses.Data[0].ID)
+	assert.Equal(t, "F", businesses.Data[0].Attributes.CheckLetter)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBusinessesByRURefReturns400WhenEmpty(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/businesses?ruRef=%20", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses?ruRef=', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "No ruRef provided", errResp.Error)
+}
+
+func TestGetBusinessesByRURefReturns404WhenNotFound(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/businesses?ruRef=49900000001", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses?ruRef=', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Business does not exist", errResp.Error)
+}
+
+// POST /businesses/resolve
+
+func TestResolveBusinesses(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs(pq.Array([]string{"49900000002", "49900000001"})).WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+
+	req := httptest.NewRequest("POST", "/v2/businesses/resolve", bytes.NewBufferString(`{"ruRefs":["49900000002","49900000001"," 49900000002"]}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var resolved models.ResolvedBusinesses
+	err = json.NewDecoder(resp.Body).Decode(&resolved)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses/resolve', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, len(resolved.Data))
+	assert.Equal(t, "49900000001", resolved.Data[0].RURef)
+	assert.Equal(t, "3b136c4b-7a14-4904-9e01-13364dd7b972", resolved.Data[0].ID)
+	assert.Equal(t, "Bolts and Ratchets Ltd", resolved.Data[0].Name)
+	assert.Equal(t, 50, resolved.Data[0].Attributes.FroEmpment)
+	assert.Equal(t, []string{"49900000002"}, resolved.NotFound)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveBusinessesReturns400WhenNoRefsProvided(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("POST", "/v2/businesses/resolve", bytes.NewBufferString(`{"ruRefs":["", " "]}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses/resolve', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "No ruRefs provided", errResp.Error)
+}
+
+func TestResolveBusinessesReturns400WhenTooManyRefsProvided(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	refs := make([]string, maxResolvedRefs+1)
+	for i := range refs {
+		refs[i] = fmt.Sprintf("%011d", i+1)
+	}
+	body, _ := json.Marshal(models.ResolveBusinesses{RURefs: refs})
+	req := httptest.NewRequest("POST", "/v2/businesses/resolve", bytes.NewBuffer(body))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses/resolve', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Too many ruRefs: at most 1000 can be resolved at once", errResp.Error)
+}
+
+func TestResolveBusinessesWithMemoryStore(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+	business := postBusinessReq.Data
+	business.ID = "3b136c4b-7a14-4904-9e01-13364dd7b972"
+	if err := memory.CreateBusiness(context.Background(), business); err != nil {
+		t.Fatal("Error creating business, ", err.Error())
+	}
+
+	req := httptest.NewRequest("POST", "/v2/businesses/resolve", bytes.NewBufferString(`{"ruRefs":["49900000001","49900000002"]}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var resolved models.ResolvedBusinesses
+	err := json.NewDecoder(resp.Body).Decode(&resolved)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses/resolve', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, len(resolved.Data))
+	assert.Equal(t, business.ID, resolved.Data[0].ID)
+	assert.Equal(t, "Bolts and Ratchets", resolved.Data[0].TradingAs)
+	assert.Equal(t, []string{"49900000002"}, resolved.NotFound)
+}
+
+// POST /businesses
+
+func TestPostBusinesses(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	jsonOut, err := json.Marshal(postBusinessReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertQueryRegex).WithArgs(AnyUUID{}, "49900000001", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WithArgs(AnyUUID{}, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", "Bolts and Ratchets Ltd", "Bolts and Ratchets",
+		sqlmock.AnyArg(), AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.BusinessCreated)
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "Bolts and Ratchets Ltd", response.Data[0].Name)
+	assert.NotEmpty(t, response.Data[0].ID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostBusinessesReturns400IfBadJSON(t *testing.T) {
+	setup()
+
+	var err error
+	db, _, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBufferString("{\"data\": \"not a business\"}"))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Invalid JSON", errResp.Error)
+}
+
+func TestPostBusinessesReturns400IfRequiredFieldsMissing(t *testing.T) {
+	setup()
+
+	var err error
+	db, _, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	jsonOut, err := json.Marshal(models.PostBusinesses{Data: models.Business{TradingAs: "Bolts and Ratchets"}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Missing required fields: sampleUnitRef, name", errResp.Error)
+}
+
+func TestPostBusinessesReturns401WhenNotAuthed(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("POST", "/v2/businesses", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestPostBusinessesReturns422IfBusinessCouldntBeInserted(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	jsonOut, err := json.Marshal(postBusinessReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertQueryRegex).WillReturnError(fmt.Errorf("Duplicate key"))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Contains(t, errResp.Error, "Duplicate key")
+}
+
+func TestPostBusinessesReturns422IfAttributesCouldntBeInserted(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	jsonOut, err := json.Marshal(postBusinessReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WillReturnError(fmt.Errorf("Invalid input syntax"))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Contains(t, errResp.Error, "Can't create business attributes")
+}
+
+func TestPostBusinessesReturns500WhenDBNotInit(t *testing.T) {
+	setup()
+
+	db = nil
+
+	req := httptest.NewRequest("POST", "/v2/businesses", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Database connection could not be found", errResp.Error)
+}
+
+func TestPostBusinessesReturns500IfCommitFails(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	jsonOut, err := json.Marshal(postBusinessReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.BusinessCreated)
+	mock.ExpectCommit().WillReturnError(fmt.Errorf("Connection lost"))
+
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Contains(t, errResp.Error, "Connection lost")
+}
+
+// GET /businesses/{id}
+
+func TestGetBusinessByID(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("3b136c4b-7a14-4904-9e01-13364dd7b972").WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var businesses models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&businesses)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, len(businesses.Data))
+	assert.Equal(t, "49900000001", businesses.Data[0].SampleUnitRef)
+	assert.Equal(t, "49900000001", businesses.Data[0].Attributes.RURef)
+	assert.Equal(t, 0, len(businesses.Data[0].Associations))
+}
+
+func TestGetBusinessByIDReturns400IfPassedANonUUID(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("GET", "/v2/businesses/1", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Not a valid ID: 1", errResp.Error)
+}
+
+func TestGetBusinessByIDReturns401WhenNotAuthed(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestGetBusinessByIDReturns404WhenNoResults(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessQueryColumns))
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Business does not exist", errResp.Error)
+}
+
+func TestGetBusinessByIDReturns500WhenDBDown(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnError(fmt.Errorf("Connection refused"))
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Error querying DB: Connection refused", errResp.Error)
+}
+
+func TestGetBusinessByIDForCollectionExercise(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("517a1f82-3440-41dd-933b-b54af5379b39", "3b136c4b-7a14-4904-9e01-13364dd7b972").WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972?collectionExerciseId=517a1f82-3440-41dd-933b-b54af5379b39", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var businesses models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&businesses)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, len(businesses.Data))
+	assert.Equal(t, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", businesses.Data[0].SampleSummaryID)
+	assert.Equal(t, 50, businesses.Data[0].Attributes.FroEmpment)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBusinessByIDReturns400IfCollectionExerciseIDInvalid(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972?collectionExerciseId=abc", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Not a valid ID: abc", errResp.Error)
+}
+
+// GET /businesses/{id}/history
+
+func TestGetBusinessHistoryReturns400IfPassedANonUUID(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("GET", "/v2/businesses/abc/history", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}/history', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Not a valid ID: abc", errResp.Error)
+}
+
+func TestGetBusinessHistoryReturns500WhenDBDown(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WillReturnError(fmt.Errorf("Connection refused"))
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972/history", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}/history', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Error querying DB: Connection refused", errResp.Error)
+}
+
+// PATCH /businesses/{id}
+
+func TestPatchBusinessByID(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	jsonOut, err := json.Marshal(models.PostBusinesses{Data: models.Business{TradingAs: "Ratchets Direct"}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(updateQueryRegex).WithArgs("49900000001", "3b136c4b-7a14-4904-9e01-13364dd7b972").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WithArgs("3b136c4b-7a14-4904-9e01-13364dd7b972", "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		"Bolts and Ratchets Ltd", "Ratchets Direct", sqlmock.AnyArg(), AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.BusinessUpdated)
+	mock.ExpectCommit()
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessQueryColumns).AddRow("3b136c4b-7a14-4904-9e01-13364dd7b972",
+		"49900000001", 1, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", "Bolts and Ratchets Ltd", "Ratchets Direct", businessAttributesJSON))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("3b136c4b-7a14-4904-9e01-13364dd7b972").
+		WillReturnRows(mock.NewRows(businessSamplesQueryColumns).AddRow("0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", nil))
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Ratchets Direct", response.Data[0].TradingAs)
+	assert.Equal(t, "Bolts and Ratchets Ltd", response.Data[0].Name)
+	assert.Equal(t, "F", response.Data[0].Attributes.CheckLetter)
+	assert.Equal(t, []models.Sample{{SampleSummaryID: "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"}}, response.Samples)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchBusinessByIDAddsBusinessToSamples(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	sample := models.Sample{SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a", CollectionExerciseID: "517a1f82-3440-41dd-933b-b54af5379b39"}
+	jsonOut, err := json.Marshal(models.PostBusinesses{Samples: []models.Sample{sample}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(addBusinessRow(mock.NewRows(searchBusinessQueryColumns)))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	// The business's attributes haven't changed, so no new version is recorded for its sample
+	mock.ExpectExec(insertQueryRegex).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(updateQueryRegex).WithArgs(sample.CollectionExerciseID, "3b136c4b-7a14-4904-9e01-13364dd7b972", sample.SampleSummaryID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insertQueryRegex).WithArgs("3b136c4b-7a14-4904-9e01-13364dd7b972", sample.SampleSummaryID, sample.CollectionExerciseID,
+		"Bolts and Ratchets Ltd", "Bolts and Ratchets", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(2, 1))
+	expectEventOutboxEntries(mock, events.BusinessUpdated)
+	mock.ExpectCommit()
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessQueryColumns).AddRow("3b136c4b-7a14-4904-9e01-13364dd7b972",
+		"49900000001", 2, sample.SampleSummaryID, "Bolts and Ratchets Ltd", "Bolts and Ratchets", businessAttributesJSON))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(businessSamplesQueryColumns).
+		AddRow("0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", nil).AddRow(sample.SampleSummaryID, sample.CollectionExerciseID))
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, sample.SampleSummaryID, response.Data[0].SampleSummaryID)
+	assert.Equal(t, 2, len(response.Samples))
+	assert.Equal(t, sample, response.Samples[1])
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchBusinessByIDReturns400IfSampleIncomplete(t *testing.T) {
+	setup()
+
+	jsonOut, err := json.Marshal(models.PostBusinesses{Samples: []models.Sample{{SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a"}}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Missing required fields in samples: collectionExerciseId", errResp.Error)
+}
+
+func TestPatchBusinessByIDReturns400IfIDChanged(t *testing.T) {
+	setup()
+
+	jsonOut, err := json.Marshal(models.PostBusinesses{Data: models.Business{ID: "be70e086-7bbc-461c-a565-5b454d748a71"}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "ID must not be changed", errResp.Error)
+}
+
+func TestPatchBusinessByIDReturns401WhenNotAuthed(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestPatchBusinessByIDReturns404IfBusinessNotFound(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessQueryColumns))
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", bytes.NewBufferString("{}"))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Business does not exist", errResp.Error)
+}
+
+func TestPatchBusinessByIDReturns422IfAttributesCouldntBeUpdated(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WillReturnError(fmt.Errorf("Invalid input syntax"))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", bytes.NewBufferString("{}"))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Equal(t, "Can't update business attributes for ID 3b136c4b-7a14-4904-9e01-13364dd7b972: Invalid input syntax", errResp.Error)
+}
+
+func TestPatchBusinessByIDReturns500IfCommitFails(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	returnRows := addBusinessRow(mock.NewRows(searchBusinessQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(returnRows)
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(mock.NewRows(searchBusinessAssociationsQueryColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.BusinessUpdated)
+	mock.ExpectCommit().WillReturnError(fmt.Errorf("Connection lost"))
+
+	req := httptest.NewRequest("PATCH", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", bytes.NewBufferString("{}"))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Can't commit transaction for business ID 3b136c4b-7a14-4904-9e01-13364dd7b972: Connection lost", errResp.Error)
+}
+
+// PUT /businesses/sample/link/{sampleSummaryId}
+
+func TestPutSampleLink(t *testing.T) {
+	setup()
+
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery("WITH linked AS (.+)").WithArgs("517a1f82-3440-41dd-933b-b54af5379b39", "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1").
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(3))
+
+	req := httptest.NewRequest("PUT", "/v2/businesses/sample/link/0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		bytes.NewBufferString(`{"collectionExerciseId":"517a1f82-3440-41dd-933b-b54af5379b39"}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var link models.SampleLink
+	err = json.NewDecoder(resp.Body).Decode(&link)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PUT /businesses/sample/link/{sampleSummaryId}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", link.SampleSummaryID)
+	assert.Equal(t, "517a1f82-3440-41dd-933b-b54af5379b39", link.CollectionExerciseID)
+	assert.Equal(t, 3, link.Businesses)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPutSampleLinkReturns400IfInvalid(t *testing.T) {
+	setup()
+
+	for _, test := range []struct {
+		sampleSummaryID string
+		body            string
+		expected        string
+	}{
+		{"abc", `{"collectionExerciseId":"517a1f82-3440-41dd-933b-b54af5379b39"}`, "Not a valid ID: abc"},
+		{"0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", `{}`, "Missing required fields: collectionExerciseId"},
+		{"0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", `{"collectionExerciseId":"def"}`, "Not a valid ID: def"},
+	} {
+		resp = httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/v2/businesses/sample/link/"+test.sampleSummaryID, bytes.NewBufferString(test.body))
+		req.SetBasicAuth("admin", "secret")
+		router.ServeHTTP(resp, req)
+
+		var errResp models.Error
+		err := json.NewDecoder(resp.Body).Decode(&errResp)
+		if err != nil {
+			t.Fatal("Error decoding JSON response from 'PUT /businesses/sample/link/{sampleSummaryId}', ", err.Error())
+		}
+		assert.Equal(t, http.StatusBadRequest, resp.Code, test.body)
+		assert.Equal(t, test.expected, errResp.Error)
+	}
+}
+
+func TestPutSampleLinkReturns401WhenNotAuthed(t *testing.T) {
+	setup()
+	req := httptest.NewRequest("PUT", "/v2/businesses/sample/link/0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		bytes.NewBufferString(`{"collectionExerciseId":"517a1f82-3440-41dd-933b-b54af5379b39"}`))
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+// Behaviour against the in-memory store
+
+func TestBusinessLifecycleWithMemoryStore(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	jsonOut, err := json.Marshal(postBusinessReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var created models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	businessID := created.Data[0].ID
+
+	resp = httptest.NewRecorder()
+	jsonOut, err = json.Marshal(models.PostBusinesses{Data: models.Business{TradingAs: "Ratchets Direct"}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /businesses/{id}', ", err.Error())
+	}
+	req = httptest.NewRequest("PATCH", "/v2/businesses/"+businessID, bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/businesses?keyword=direct", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var search models.BusinessSearch
+	err = json.NewDecoder(resp.Body).Decode(&search)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, search.Total)
+	assert.Equal(t, businessID, search.Data[0].ID)
+	assert.Equal(t, "Ratchets Direct", search.Data[0].TradingAs)
+	assert.Equal(t, "F", search.Data[0].Attributes.CheckLetter)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/businesses?keyword=widgets", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestGetBusinessByIDReturns404WithMemoryStore(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Business does not exist", errResp.Error)
+}
+
+func TestSampleLinksWithMemoryStore(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	jsonOut, err := json.Marshal(postBusinessReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var created models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+	businessID := created.Data[0].ID
+
+	// The sample the business was created in is linked by the legacy endpoint
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/party-api/v1/businesses/sample/link/0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		bytes.NewBufferString(`{"collectionExerciseId":"517a1f82-3440-41dd-933b-b54af5379b39"}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var link models.SampleLink
+	err = json.NewDecoder(resp.Body).Decode(&link)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PUT /businesses/sample/link/{sampleSummaryId}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, link.Businesses)
+
+	// The business is then added to the next period's sample
+	resp = httptest.NewRecorder()
+	jsonOut, err = json.Marshal(models.PostBusinesses{Samples: []models.Sample{
+		{SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a", CollectionExerciseID: "62f682a9-c223-4f15-942e-93d00d400daf"},
+	}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /businesses/{id}', ", err.Error())
+	}
+	req = httptest.NewRequest("PATCH", "/v2/businesses/"+businessID, bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var patched models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&patched)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /businesses/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "c9a4f9a5-573e-4870-a114-42279ab2aa3a", patched.Data[0].SampleSummaryID)
+	assert.Equal(t, []models.Sample{
+		{SampleSummaryID: "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", CollectionExerciseID: "517a1f82-3440-41dd-933b-b54af5379b39"},
+		{SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a", CollectionExerciseID: "62f682a9-c223-4f15-942e-93d00d400daf"},
+	}, patched.Samples)
+}
+
+func TestBusinessAttributesPerCollectionExerciseWithMemoryStore(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	jsonOut, err := json.Marshal(postBusinessReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /businesses', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/businesses", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var created models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /businesses', ", err.Error())
+	}
+	businessID := created.Data[0].ID
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/v2/businesses/sample/link/0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		bytes.NewBufferString(`{"collectionExerciseId":"517a1f82-3440-41dd-933b-b54af5379b39"}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// The next period's sample has the business's new employment figure
+	resp = httptest.NewRecorder()
+	jsonOut, err = json.Marshal(models.PostBusinesses{Data: models.Business{
+		SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a",
+		Attributes:      models.BusinessAttributes{RURef: "49900000001", FroEmpment: 55},
+	}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /businesses/{id}', ", err.Error())
+	}
+	req = httptest.NewRequest("PATCH", "/v2/businesses/"+businessID, bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/businesses/"+businessID+"?collectionExerciseId=517a1f82-3440-41dd-933b-b54af5379b39", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var inExercise models.Businesses
+	err = json.NewDecoder(resp.Body).Decode(&inExercise)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 50, inExercise.Data[0].Attributes.FroEmpment)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/businesses/"+businessID+"?collectionExerciseId=62f682a9-c223-4f15-942e-93d00d400daf", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/businesses/"+businessID+"/history", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var history models.BusinessAttributesHistory
+	err = json.NewDecoder(resp.Body).Decode(&history)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}/history', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 2, len(history.Data))
+	assert.Equal(t, "517a1f82-3440-41dd-933b-b54af5379b39", history.Data[0].CollectionExerciseID)
+	assert.Equal(t, 50, history.Data[0].Attributes.FroEmpment)
+	assert.Equal(t, "c9a4f9a5-573e-4870-a114-42279ab2aa3a", history.Data[1].SampleSummaryID)
+	assert.Equal(t, 55, history.Data[1].Attributes.FroEmpment)
+}
+
+func TestGetBusinessHistoryReturns404WithMemoryStore(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/businesses/3b136c4b-7a14-4904-9e01-13364dd7b972/history", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /businesses/{id}/history', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "No history found for business ID 3b136c4b-7a14-4904-9e01-13364dd7b972", errResp.Error)
+}
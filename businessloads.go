@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/samplefile"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// The sample file formats each Content-Type a file can be posted as is in
+var sampleFileContentTypes = map[string]string{
+	"text/csv":             samplefile.CSV,
+	"application/x-ndjson": samplefile.NDJSON,
+	"application/ndjson":   samplefile.NDJSON,
+}
+
+// How long a load which was stopped has to record that it failed
+const businessLoadStopTimeout = 10 * time.Second
+
+var errLoadBusinessesUsage = errors.New("usage: load-businesses <sampleSummaryId> <file>")
+
+// Returns the business in a sample file row, as it is in the sample summary
+func sampleBusiness(sampleSummaryID string, attributes models.SampleAttributes) models.Business {
+	return models.Business{
+		ID:              uuid.New().String(),
+		SampleUnitRef:   attributes.RURef,
+		SampleSummaryID: sampleSummaryID,
+		Name:            businessName(attributes.RUName1, attributes.RUName2, attributes.RUName3),
+		TradingAs:       attributes.TradStyle1,
+		Attributes:      models.BusinessAttributes(attributes),
+	}
+}
+
+// Returns a new job loading the rows of a sample file, which already has the errors for rows which couldn't be read
+func newBusinessLoad(sampleSummaryID string, rows []samplefile.Row, rowErrors []models.BusinessLoadError) models.BusinessLoad {
+	return models.BusinessLoad{
+		ID:              uuid.New().String(),
+		SampleSummaryID: sampleSummaryID,
+		Status:          store.BusinessLoadRunning,
+		Rows:            len(rows) + len(rowErrors),
+		Errors:          append([]models.BusinessLoadError{}, rowErrors...),
+		CreatedOn:       time.Now().UTC(),
+	}
+}
+
+// Runs business loads in the background, until they're finished or the service stops
+type businessLoader struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func newBusinessLoader() *businessLoader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &businessLoader{ctx: ctx, cancel: cancel}
+}
+
+// Start runs the load in the background. It outlives the request starting it, so keeps the request's ID for its logs
+// but not its cancellation.
+func (l *businessLoader) Start(ctx context.Context, businesses store.BusinessStore, load models.BusinessLoad, rows []samplefile.Row, batchSize int) {
+	loadCtx := logging.WithRequestID(l.ctx, logging.RequestID(ctx))
+	load.Errors = append([]models.BusinessLoadError{}, load.Errors...)
+	l.running.Add(1)
+	go func() {
+		defer l.running.Done()
+		runBusinessLoad(loadCtx, businesses, &load, rows, batchSize)
+	}()
+}
+
+// Wait waits for the running loads to finish. If ctx is done first, they're stopped, and marked as failed, and its
+// error is returned once they have.
+func (l *businessLoader) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// Loads the rows into the store in batches of batchSize, recording how far the load has got after each. The rows of a
+// batch which can't be loaded are retried one at a time, so that only those which can't be loaded on their own get an
+// error, and the load carries on with the next batch. If ctx is cancelled the load stops, and is marked as failed,
+// after the batch it's loading.
+func runBusinessLoad(ctx context.Context, businesses store.BusinessStore, load *models.BusinessLoad, rows []samplefile.Row, batchSize int) {
+	logger := logging.FromContext(ctx).With(zap.String("business_load_id", load.ID))
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	for start := 0; start < len(rows) && ctx.Err() == nil; start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		batch := rows[start:end]
+		loaded := make([]models.Business, len(batch))
+		for idx, row := range batch {
+			loaded[idx] = sampleBusiness(load.SampleSummaryID, row.Attributes)
+		}
+		err := businesses.LoadBusinesses(ctx, loaded)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			logger.Warn("Error loading batch of businesses, so loading its rows one at a time", zap.Int("from_row", batch[0].Number), zap.Error(err))
+			loadRows(ctx, businesses, load, batch, loaded)
+		} else {
+			load.Loaded += len(batch)
+		}
+
+		if end < len(rows) && ctx.Err() == nil {
+			if err := businesses.UpdateBusinessLoad(ctx, *load); err != nil {
+				logger.Error("Error recording progress of business load", zap.Error(err))
+			}
+		}
+	}
+
+	completedOn := time.Now().UTC()
+	load.CompletedOn = &completedOn
+	if ctx.Err() != nil {
+		// The load's context is done, so recording that it stopped needs one of its own
+		stopCtx, cancel := context.WithTimeout(logging.WithRequestID(context.Background(), logging.RequestID(ctx)), businessLoadStopTimeout)
+		defer cancel()
+		load.Status = store.BusinessLoadFailed
+		if err := businesses.UpdateBusinessLoad(stopCtx, *load); err != nil {
+			logger.Error("Error recording that business load was stopped", zap.Error(err))
+		}
+		logger.Warn("Business load was stopped before it finished", zap.Int("rows", load.Rows), zap.Int("loaded", load.Loaded))
+		return
+	}
+
+	load.Status = store.BusinessLoadCompleted
+	if err := businesses.UpdateBusinessLoad(ctx, *load); err != nil {
+		logger.Error("Error recording completion of business load", zap.Error(err))
+	}
+
+	logger.Info("Loaded businesses", zap.Int("rows", load.Rows), zap.Int("loaded", load.Loaded), zap.Int("errors", len(load.Errors)))
+}
+
+// Loads the rows of a batch which failed one at a time, recording the error for each which can't be loaded
+func loadRows(ctx context.Context, businesses store.BusinessStore, load *models.BusinessLoad, batch []samplefile.Row, loaded []models.Business) {
+	logger := logging.FromContext(ctx).With(zap.String("business_load_id", load.ID))
+	for idx, row := range batch {
+		if ctx.Err() != nil {
+			return
+		}
+		err := businesses.LoadBusinesses(ctx, loaded[idx:idx+1])
+		if err == nil {
+			load.Loaded++
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("Error loading business", zap.Int("row", row.Number), zap.Error(err))
+		load.Errors = append(load.Errors, models.BusinessLoadError{Row: row.Number, RURef: row.Attributes.RURef, Error: err.Error()})
+	}
+	sort.SliceStable(load.Errors, func(i, j int) bool { return load.Errors[i].Row < load.Errors[j].Row })
+}
+
+func postBusinessLoads(loader *businessLoader) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		sampleSummaryID := r.URL.Query().Get("sampleSummaryId")
+		if sampleSummaryID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			errorString := models.Error{
+				Error: "Missing required fields: sampleSummaryId",
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+		if _, err := uuid.Parse(sampleSummaryID); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errorString := models.Error{
+				Error: "Not a valid ID: " + sampleSummaryID,
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format, ok := sampleFileContentTypes[contentType]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			errorString := models.Error{
+				Error: "Unsupported Content-Type: " + r.Header.Get("Content-Type"),
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+
+		businesses := getBusinessStore()
+		if businesses == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			errorString := models.Error{
+				Error: "Database connection could not be found",
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+
+		// The file's read before responding, so that one which can't be read at all is rejected outright
+		rows, rowErrors, err := samplefile.Read(r.Body, format)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errorString := models.Error{
+				Error: "Invalid sample file: " + err.Error(),
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+
+		load := newBusinessLoad(sampleSummaryID, rows, rowErrors)
+		err = businesses.CreateBusinessLoad(r.Context(), load)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		loader.Start(r.Context(), businesses, load, rows, viper.GetInt("business_load_batch_size"))
+
+		w.Header().Set("Location", "/v2/business-loads/"+load.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(models.BusinessLoads{Data: []models.BusinessLoad{load}})
+	}
+}
+
+func getBusinessLoadByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	loadID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	load, err := businesses.GetBusinessLoad(r.Context(), loadID.String())
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Business load does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.BusinessLoads{Data: []models.BusinessLoad{load}})
+}
+
+// Runs the load-businesses subcommand, e.g. `ras-rm-party load-businesses <sampleSummaryId> sample.csv`, writing the
+// rows which couldn't be loaded and a summary to out. Files ending .ndjson or .jsonl are read as NDJSON, and any
+// others as CSV.
+func runLoadBusinesses(ctx context.Context, businesses store.BusinessStore, args []string, out io.Writer) error {
+	if len(args) != 2 {
+		return errLoadBusinessesUsage
+	}
+	sampleSummaryID, path := args[0], args[1]
+	if _, err := uuid.Parse(sampleSummaryID); err != nil {
+		return fmt.Errorf("not a valid sample summary ID: %s", sampleSummaryID)
+	}
+
+	format := samplefile.CSV
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		format = samplefile.NDJSON
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, rowErrors, err := samplefile.Read(file, format)
+	if err != nil {
+		return err
+	}
+
+	load := newBusinessLoad(sampleSummaryID, rows, rowErrors)
+	if err = businesses.CreateBusinessLoad(ctx, load); err != nil {
+		return err
+	}
+	runBusinessLoad(ctx, businesses, &load, rows, viper.GetInt("business_load_batch_size"))
+
+	for _, rowError := range load.Errors {
+		fmt.Fprintf(out, "Row %d: %s\n", rowError.Row, rowError.Error)
+	}
+	fmt.Fprintf(out, "Loaded %d of %d businesses for sample summary %s (business load %s)\n", load.Loaded, load.Rows, sampleSummaryID, load.ID)
+	return nil
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/samplefile"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const loadSampleSummaryID = "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"
+
+// Posts the sample file, waits for it to be loaded, and returns the load as it was when it started
+func postSampleFile(t *testing.T, contentType, file string) models.BusinessLoad {
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v2/business-loads?sampleSummaryId="+loadSampleSummaryID, strings.NewReader(file))
+	req.Header.Set("Content-Type", contentType)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	businessLoads.Wait(context.Background())
+
+	var response models.BusinessLoads
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /business-loads', ", err.Error())
+	}
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	return response.Data[0]
+}
+
+// Fetches the load through the API
+func getBusinessLoad(t *testing.T, id string) models.BusinessLoad {
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v2/business-loads/"+id, nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.BusinessLoads
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /business-loads/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	return response.Data[0]
+}
+
+func TestPostBusinessLoadsCSV(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+	existing := models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001", Name: "Old Name"}
+	if err := memory.CreateBusiness(context.Background(), existing); err != nil {
+		t.Fatal("Error creating business, ", err.Error())
+	}
+
+	started := postSampleFile(t, "text/csv; charset=utf-8", "ruref,runame1,runame2,tradstyle1,froempment\n"+
+		"49900000001,Acme,Holdings,Acme Trading,50\n"+
+		"49900000002,Widgets,,,10\n"+
+		"49900000003,,,,5\n")
+
+	assert.Equal(t, "/v2/business-loads/"+started.ID, resp.Header().Get("Location"))
+	assert.Equal(t, store.BusinessLoadRunning, started.Status)
+	assert.Equal(t, 3, started.Rows)
+	assert.Equal(t, []models.BusinessLoadError{{Row: 3, RURef: "49900000003", Error: "Missing required fields: runame1"}}, started.Errors)
+
+	load := getBusinessLoad(t, started.ID)
+	assert.Equal(t, store.BusinessLoadCompleted, load.Status)
+	assert.Equal(t, 2, load.Loaded)
+	assert.NotNil(t, load.CompletedOn)
+	assert.Equal(t, started.Errors, load.Errors)
+
+	updated, err := memory.GetBusiness(context.Background(), existing.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme Holdings", updated.Name)
+	assert.Equal(t, "Acme Trading", updated.TradingAs)
+	assert.Equal(t, loadSampleSummaryID, updated.SampleSummaryID)
+	assert.Equal(t, 50, updated.Attributes.FroEmpment)
+
+	created, err := memory.GetBusinessByRef(context.Background(), "49900000002")
+	assert.Nil(t, err)
+	assert.Equal(t, "Widgets", created.Name)
+	samples, err := memory.BusinessSamples(context.Background(), created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Sample{{SampleSummaryID: loadSampleSummaryID}}, samples)
+}
+
+func TestPostBusinessLoadsNDJSON(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+
+	started := postSampleFile(t, "application/x-ndjson", `{"ruref":"49900000001","runame1":"Acme","cell_no":2}`+"\n"+`{"ruref":`+"\n")
+
+	load := getBusinessLoad(t, started.ID)
+	assert.Equal(t, 2, load.Rows)
+	assert.Equal(t, 1, load.Loaded)
+	assert.Len(t, load.Errors, 1)
+	assert.Equal(t, 2, load.Errors[0].Row)
+	created, err := memory.GetBusinessByRef(context.Background(), "49900000001")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, created.Attributes.CellNo)
+}
+
+func TestPostBusinessLoadsReturns400IfInvalid(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	for _, test := range []struct {
+		query       string
+		contentType string
+		file        string
+		expected    string
+	}{
+		{"", "text/csv", "ruref,runame1\n", "Missing required fields: sampleSummaryId"},
+		{"?sampleSummaryId=abc", "text/csv", "ruref,runame1\n", "Not a valid ID: abc"},
+		{"?sampleSummaryId=" + loadSampleSummaryID, "application/json", "{}", "Unsupported Content-Type: application/json"},
+		{"?sampleSummaryId=" + loadSampleSummaryID, "text/csv", "ruref,colour\n", "Invalid sample file: unknown columns in sample file: colour"},
+		{"?sampleSummaryId=" + loadSampleSummaryID, "text/csv", "", "Invalid sample file: sample file is empty"},
+	} {
+		resp = httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v2/business-loads"+test.query, strings.NewReader(test.file))
+		req.Header.Set("Content-Type", test.contentType)
+		req.SetBasicAuth("admin", "secret")
+		router.ServeHTTP(resp, req)
+
+		var errResp models.Error
+		err := json.NewDecoder(resp.Body).Decode(&errResp)
+		if err != nil {
+			t.Fatal("Error decoding JSON response from 'POST /business-loads', ", err.Error())
+		}
+		assert.Equal(t, http.StatusBadRequest, resp.Code, test.expected)
+		assert.Equal(t, test.expected, errResp.Error)
+	}
+}
+
+func TestPostBusinessLoadsAcceptsFilesLargerThanOtherRequests(t *testing.T) {
+	viper.Set("max_request_body_bytes", 64)
+	viper.Set("business_load_max_bytes", 128)
+	t.Cleanup(func() {
+		viper.Set("max_request_body_bytes", 1<<20)
+		viper.Set("business_load_max_bytes", 1<<26)
+	})
+	setup()
+	useMemoryStore(t)
+
+	file := "ruref,runame1\n" + strings.Repeat("49900000001,Acme Holdings Limited\n", 2)
+	assert.Greater(t, len(file), 64)
+	postSampleFile(t, "text/csv", file)
+
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v2/business-loads?sampleSummaryId="+loadSampleSummaryID, strings.NewReader(file+file+file))
+	req.Header.Set("Content-Type", "text/csv")
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+}
+
+func TestPostBusinessLoadsGivesSlowFilesLongerThanOtherRequests(t *testing.T) {
+	viper.Set("server_read_timeout", "100ms")
+	viper.Set("server_write_timeout", "100ms")
+	t.Cleanup(func() {
+		viper.Set("server_read_timeout", "15s")
+		viper.Set("server_write_timeout", "30s")
+	})
+	setup()
+	useMemoryStore(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening, ", err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serve(ctx, newServer(router), listener, "", "", time.Second)
+
+	// The file takes several times the server's timeouts to send
+	body, sending := io.Pipe()
+	go func() {
+		sending.Write([]byte("ruref,runame1\n"))
+		for idx := 0; idx < 10; idx++ {
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintf(sending, "4990000%04d,Acme Holdings Limited\n", idx)
+		}
+		sending.Close()
+	}()
+	req, err := http.NewRequest("POST", "http://"+listener.Addr().String()+"/v2/business-loads?sampleSummaryId="+loadSampleSummaryID, body)
+	if err != nil {
+		t.Fatal("Error creating request, ", err.Error())
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	req.SetBasicAuth("admin", "secret")
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error posting sample file, ", err.Error())
+	}
+	defer response.Body.Close()
+	businessLoads.Wait(context.Background())
+
+	var loads models.BusinessLoads
+	err = json.NewDecoder(response.Body).Decode(&loads)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /business-loads', ", err.Error())
+	}
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.Equal(t, 10, loads.Data[0].Rows)
+}
+
+func TestPostBusinessLoadsDoesntGiveUnauthenticatedClientsLonger(t *testing.T) {
+	viper.Set("server_read_timeout", "100ms")
+	viper.Set("server_write_timeout", "100ms")
+	t.Cleanup(func() {
+		viper.Set("server_read_timeout", "15s")
+		viper.Set("server_write_timeout", "30s")
+	})
+	setup()
+	useMemoryStore(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening, ", err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serve(ctx, newServer(router), listener, "", "", time.Second)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting, ", err.Error())
+	}
+	defer conn.Close()
+
+	// The rest of the file is never sent, so the server closes the connection once its own read timeout has passed,
+	// rather than waiting for as long as it would for an authenticated client
+	fmt.Fprintf(conn, "POST /v2/business-loads?sampleSummaryId=%s HTTP/1.1\r\nHost: localhost\r\nContent-Type: text/csv\r\n"+
+		"Content-Length: 1000\r\n\r\nruref,runame1\n", loadSampleSummaryID)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.ReadAll(conn)
+
+	assert.Nil(t, err)
+}
+
+func TestGetBusinessLoadByIDReturns404IfNotFound(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/business-loads/8d1bd1a6-5f7f-4d8e-a0a4-6f7d0f3c3a5e", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /business-loads/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Business load does not exist", errResp.Error)
+}
+
+func TestGetBusinessLoadByIDReturns400IfInvalidID(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/business-loads/abc", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+// A store which fails to load any batch containing the RU reference
+type failingLoadStore struct {
+	*store.Memory
+	ref string
+}
+
+func (f failingLoadStore) LoadBusinesses(ctx context.Context, businesses []models.Business) error {
+	for _, business := range businesses {
+		if business.SampleUnitRef == f.ref {
+			return errors.New("connection reset")
+		}
+	}
+	return f.Memory.LoadBusinesses(ctx, businesses)
+}
+
+func TestRunBusinessLoadOnlyReportsRowsWhichCantBeLoaded(t *testing.T) {
+	memory := store.NewMemory()
+	businesses := failingLoadStore{Memory: memory, ref: "49900000003"}
+	rows := []samplefile.Row{
+		{Number: 1, Attributes: models.SampleAttributes{RURef: "49900000001", RUName1: "Acme"}},
+		{Number: 2, Attributes: models.SampleAttributes{RURef: "49900000002", RUName1: "Widgets"}},
+		{Number: 4, Attributes: models.SampleAttributes{RURef: "49900000003", RUName1: "Gadgets"}},
+		{Number: 5, Attributes: models.SampleAttributes{RURef: "49900000004", RUName1: "Gizmos"}},
+		{Number: 6, Attributes: models.SampleAttributes{RURef: "49900000005", RUName1: "Doodads"}},
+	}
+	load := newBusinessLoad(loadSampleSummaryID, rows, []models.BusinessLoadError{{Row: 3, Error: "Invalid JSON"}})
+	assert.Nil(t, memory.CreateBusinessLoad(context.Background(), load))
+
+	runBusinessLoad(context.Background(), businesses, &load, rows, 2)
+
+	stored, err := memory.GetBusinessLoad(context.Background(), load.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, store.BusinessLoadCompleted, stored.Status)
+	assert.Equal(t, 6, stored.Rows)
+	assert.Equal(t, 4, stored.Loaded)
+	assert.Equal(t, []models.BusinessLoadError{
+		{Row: 3, Error: "Invalid JSON"},
+		{Row: 4, RURef: "49900000003", Error: "connection reset"},
+	}, stored.Errors)
+	for _, ref := range []string{"49900000001", "49900000002", "49900000004", "49900000005"} {
+		_, err = memory.GetBusinessByRef(context.Background(), ref)
+		assert.Nil(t, err, ref)
+	}
+	_, err = memory.GetBusinessByRef(context.Background(), "49900000003")
+	assert.Equal(t, store.ErrNotFound, err)
+}
+
+// A store which doesn't finish loading any batch until its context is done
+type blockingLoadStore struct {
+	*store.Memory
+	loading chan struct{}
+}
+
+func (b blockingLoadStore) LoadBusinesses(ctx context.Context, businesses []models.Business) error {
+	close(b.loading)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestBusinessLoaderStopsLoadsStillRunningWhenWaitTimesOut(t *testing.T) {
+	memory := store.NewMemory()
+	businesses := blockingLoadStore{Memory: memory, loading: make(chan struct{})}
+	rows := []samplefile.Row{{Number: 1, Attributes: models.SampleAttributes{RURef: "49900000001", RUName1: "Acme"}}}
+	load := newBusinessLoad(loadSampleSummaryID, rows, nil)
+	assert.Nil(t, memory.CreateBusinessLoad(context.Background(), load))
+
+	loader := newBusinessLoader()
+	loader.Start(context.Background(), businesses, load, rows, 1)
+	<-businesses.loading
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := loader.Wait(ctx)
+
+	assert.Equal(t, context.Canceled, err)
+	stored, err := memory.GetBusinessLoad(context.Background(), load.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, store.BusinessLoadFailed, stored.Status)
+	assert.Equal(t, 0, stored.Loaded)
+	assert.Empty(t, stored.Errors)
+	assert.NotNil(t, stored.CompletedOn)
+}
+
+func TestRunLoadBusinesses(t *testing.T) {
+	memory := store.NewMemory()
+	path := filepath.Join(t.TempDir(), "sample.jsonl")
+	file := `{"ruref":"49900000001","runame1":"Acme"}` + "\n" + `{"ruref":"49900000002"}` + "\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal("Error writing sample file, ", err.Error())
+	}
+
+	var out bytes.Buffer
+	err := runLoadBusinesses(context.Background(), memory, []string{loadSampleSummaryID, path}, &out)
+
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "Row 2: Missing required fields: runame1\n")
+	assert.Contains(t, out.String(), "Loaded 1 of 2 businesses for sample summary "+loadSampleSummaryID)
+	_, err = memory.GetBusinessByRef(context.Background(), "49900000001")
+	assert.Nil(t, err)
+}
+
+func TestRunLoadBusinessesRejectsBadArguments(t *testing.T) {
+	for _, args := range [][]string{{}, {loadSampleSummaryID}, {loadSampleSummaryID, "a.csv", "b.csv"}} {
+		err := runLoadBusinesses(context.Background(), store.NewMemory(), args, &bytes.Buffer{})
+		assert.Equal(t, errLoadBusinessesUsage, err)
+	}
+
+	err := runLoadBusinesses(context.Background(), store.NewMemory(), []string{"abc", "sample.csv"}, &bytes.Buffer{})
+	assert.EqualError(t, err, "not a valid sample summary ID: abc")
+}
@@ -0,0 +1,27 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+)
+
+type caseClient struct {
+	service
+}
+
+// NewCaseClient returns a client for the Case service at the URL provided. If httpClient is nil, http.DefaultClient
+// is used.
+func NewCaseClient(baseURL string, httpClient *http.Client) CaseClient {
+	return &caseClient{newService("Case", baseURL, httpClient)}
+}
+
+func (c *caseClient) GetCase(ctx context.Context, id string) (models.Case, error) {
+	enrolmentCase := models.Case{}
+	if err := c.do(ctx, http.MethodGet, "/cases/"+url.PathEscape(id), nil, &enrolmentCase); err != nil {
+		return models.Case{}, err
+	}
+	return enrolmentCase, nil
+}
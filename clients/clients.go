@@ -0,0 +1,266 @@
+// Package clients provides typed clients for the other RAS services the party service depends on, so that callers
+// deal with parties, cases and collection exercises rather than HTTP requests and status codes.
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/metrics"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNotFound is returned when the thing being retrieved doesn't exist in the service asked for it
+var ErrNotFound = errors.New("not found")
+
+// ErrInactive is returned when an enrolment code exists but can no longer be used
+var ErrInactive = errors.New("inactive")
+
+// Error represents a failure to get a usable response from a service, e.g. because it couldn't be reached or
+// responded with an unexpected status code
+type Error struct {
+	// Service is the name of the service, as it should appear in messages
+	Service string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return "Couldn't communicate with " + e.Service + " service: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Config configures the HTTP client shared by the service clients
+type Config struct {
+	// Timeout is the time limit for each request, including reading the response body
+	Timeout time.Duration
+	// MaxIdleConnsPerHost is the number of idle connections to keep open to each service
+	MaxIdleConnsPerHost int
+	// PublicOnly refuses connections to loopback, private, link-local and other non-public addresses, for clients
+	// which call URLs given to the service by its users. Such clients connect directly rather than through any proxy
+	// in the environment, since the addresses they'd connect to couldn't be checked.
+	PublicOnly bool
+}
+
+// ErrNonPublicAddress is returned when a client which only connects to public addresses is asked to connect to one
+// which isn't
+var ErrNonPublicAddress = errors.New("connections to non-public addresses aren't allowed")
+
+// The ranges of addresses which aren't reachable on the public internet, besides loopback, link-local, multicast and
+// unspecified ones
+var nonPublicNetworks = parseCIDRs(
+	"0.0.0.0/8",      // "This" network
+	"10.0.0.0/8",     // Private
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"172.16.0.0/12",  // Private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // Private
+	"198.18.0.0/15",  // Benchmarking
+	"240.0.0.0/4",    // Reserved
+	"fc00::/7",       // Unique local
+	"64:ff9b:1::/48", // Local-use NAT64
+)
+
+// The well-known NAT64 prefix, whose addresses are translated to the IPv4 address in their last four bytes
+var nat64Network = parseCIDRs("64:ff9b::/96")[0]
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// Returns whether the IP address is reachable on the public internet. IPv6 addresses standing for IPv4 ones, whether
+// IPv4-mapped or NAT64, are checked as the IPv4 address they stand for.
+func isPublic(ip net.IP) bool {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	} else if nat64Network.Contains(ip) {
+		ip = ip[net.IPv6len-net.IPv4len:]
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Refuses connections to non-public addresses. It's called with the address being dialled once its host name has been
+// resolved, so a name which resolves to a non-public address is refused too, however it's resolved at the time.
+func dialPublicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return ErrNonPublicAddress
+	}
+	return nil
+}
+
+// NewHTTPClient returns an HTTP client with the timeout and connection pool configured
+func NewHTTPClient(config Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   config.Timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	proxy := http.ProxyFromEnvironment
+	if config.PublicOnly {
+		dialer.Control = dialPublicOnly
+		proxy = nil
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          config.MaxIdleConnsPerHost * 4,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{Transport: transport, Timeout: config.Timeout}
+}
+
+// IACClient looks up and deactivates enrolment codes in the IAC service
+type IACClient interface {
+	// GetIAC returns the enrolment code, ErrNotFound if it doesn't exist, or ErrInactive along with the code if it
+	// has already been used
+	GetIAC(ctx context.Context, code string) (models.IAC, error)
+	// DeactivateIAC stops the enrolment code from being used again
+	DeactivateIAC(ctx context.Context, code string) error
+	// Ping checks that the IAC service is responding
+	Ping(ctx context.Context) error
+}
+
+// CaseClient looks up cases in the Case service
+type CaseClient interface {
+	// GetCase returns the case with the ID provided, or ErrNotFound
+	GetCase(ctx context.Context, id string) (models.Case, error)
+	// Ping checks that the Case service is responding
+	Ping(ctx context.Context) error
+}
+
+// CollectionExerciseClient looks up collection exercises in the Collection Exercise service
+type CollectionExerciseClient interface {
+	// GetCollectionExercise returns the collection exercise with the ID provided, or ErrNotFound
+	GetCollectionExercise(ctx context.Context, id string) (models.CollectionExercise, error)
+	// Ping checks that the Collection Exercise service is responding
+	Ping(ctx context.Context) error
+}
+
+// Makes requests to one service, turning failures into errors naming it
+type service struct {
+	name       string
+	baseURL    string
+	httpClient *http.Client
+}
+
+func newService(name, baseURL string, httpClient *http.Client) service {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return service{name: name, baseURL: baseURL, httpClient: httpClient}
+}
+
+// Ping checks that the service is responding, using its info endpoint
+func (s service) Ping(ctx context.Context) error {
+	err := s.do(ctx, http.MethodGet, "/info", nil, nil)
+	if err == ErrNotFound {
+		// Whatever is there, it isn't the service
+		return s.fail(fmt.Errorf("Received status code %d", http.StatusNotFound))
+	}
+	return err
+}
+
+func (s service) fail(err error) error {
+	return &Error{Service: s.name, Err: err}
+}
+
+// Sends the request and decodes the JSON response into out, if provided. A 404 response returns ErrNotFound, and
+// any other response than 200 an Error.
+func (s service) do(ctx context.Context, method, path string, body io.Reader, out interface{}) error {
+	ctx, span := tracing.Tracer().Start(ctx, s.name+" "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.PeerServiceKey.String(s.name), semconv.HTTPMethodKey.String(method)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := s.send(ctx, method, path, body, out)
+	if err != ErrNotFound {
+		tracing.RecordError(span, err)
+	}
+
+	outcome := "success"
+	if err == ErrNotFound {
+		outcome = "not_found"
+	} else if err != nil {
+		outcome = "error"
+	}
+	metrics.ObserveOutbound(s.name, method, outcome, time.Since(start))
+	return err
+}
+
+func (s service) send(ctx context.Context, method, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+	if err != nil {
+		return s.fail(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return s.fail(err)
+	}
+	defer func() {
+		// Drain the body so that the connection can be reused
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s.fail(fmt.Errorf("Received status code %d", resp.StatusCode))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return s.fail(fmt.Errorf("Invalid response: %w", err))
+	}
+	return nil
+}
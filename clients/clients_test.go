@@ -0,0 +1,197 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/clients/clientstest"
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var ctx = context.Background()
+
+var activeIAC = models.IAC{IAC: "abc1234", Active: true, CaseID: "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb"}
+var testCase = models.Case{
+	ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+	BusinessID: "21ab28e5-4e02-4a9e-b0a6-2e3bbf2e2c1d",
+	CaseGroup:  models.CaseGroup{CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea"},
+}
+
+func TestGetIAC(t *testing.T) {
+	server := clientstest.NewServer()
+	defer server.Close()
+	server.AddIAC(activeIAC)
+
+	iac, err := NewIACClient(server.URL, nil).GetIAC(ctx, "abc1234")
+
+	assert.Nil(t, err)
+	assert.Equal(t, activeIAC, iac)
+}
+
+func TestGetIACReturnsNotFound(t *testing.T) {
+	server := clientstest.NewServer()
+	defer server.Close()
+
+	_, err := NewIACClient(server.URL, nil).GetIAC(ctx, "abc1234")
+
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestGetIACReturnsInactive(t *testing.T) {
+	server := clientstest.NewServer()
+	defer server.Close()
+	server.AddIAC(models.IAC{IAC: "abc1234", Active: false})
+
+	iac, err := NewIACClient(server.URL, nil).GetIAC(ctx, "abc1234")
+
+	assert.Equal(t, ErrInactive, err)
+	assert.Equal(t, "abc1234", iac.IAC)
+}
+
+func TestDeactivateIAC(t *testing.T) {
+	server := clientstest.NewServer()
+	defer server.Close()
+	server.AddIAC(activeIAC)
+	client := NewIACClient(server.URL, nil)
+
+	err := client.DeactivateIAC(ctx, "abc1234")
+	assert.Nil(t, err)
+
+	_, err = client.GetIAC(ctx, "abc1234")
+	assert.Equal(t, ErrInactive, err)
+	assert.Equal(t, []string{"abc1234"}, server.Deactivated())
+}
+
+func TestGetCaseAndCollectionExercise(t *testing.T) {
+	server := clientstest.NewServer()
+	defer server.Close()
+	server.AddCase(testCase)
+	server.AddCollectionExercise(models.CollectionExercise{ID: "1010b2f2-8668-498a-afee-3c33cdfe42ea", SurveyID: "cb8accda-6118-4d3b-85a3-149e28960c54"})
+
+	enrolmentCase, err := NewCaseClient(server.URL, nil).GetCase(ctx, testCase.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, testCase, enrolmentCase)
+
+	collectionExercise, err := NewCollectionExerciseClient(server.URL, nil).GetCollectionExercise(ctx, enrolmentCase.CaseGroup.CollectionExerciseID)
+	assert.Nil(t, err)
+	assert.Equal(t, "cb8accda-6118-4d3b-85a3-149e28960c54", collectionExercise.SurveyID)
+
+	_, err = NewCollectionExerciseClient(server.URL, nil).GetCollectionExercise(ctx, "91b4e876-16af-471e-973e-e3da5ab127bd")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestUnexpectedStatusIsAnError(t *testing.T) {
+	server := clientstest.NewServer()
+	defer server.Close()
+	server.Fail("/cases/"+testCase.ID, http.StatusServiceUnavailable)
+
+	_, err := NewCaseClient(server.URL, nil).GetCase(ctx, testCase.ID)
+
+	var clientErr *Error
+	assert.True(t, errors.As(err, &clientErr))
+	assert.Equal(t, "Case", clientErr.Service)
+	assert.Equal(t, "Couldn't communicate with Case service: Received status code 503", err.Error())
+}
+
+func TestInvalidResponseIsAnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>"))
+	}))
+	defer server.Close()
+
+	_, err := NewIACClient(server.URL, nil).GetIAC(ctx, "abc1234")
+
+	var clientErr *Error
+	assert.True(t, errors.As(err, &clientErr))
+	assert.Contains(t, err.Error(), "Couldn't communicate with IAC service: Invalid response")
+}
+
+func TestRequestsTimeOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	httpClient := NewHTTPClient(Config{Timeout: 50 * time.Millisecond, MaxIdleConnsPerHost: 2})
+	_, err := NewIACClient(server.URL, httpClient).GetIAC(ctx, "abc1234")
+
+	var clientErr *Error
+	assert.True(t, errors.As(err, &clientErr))
+	assert.Equal(t, "IAC", clientErr.Service)
+}
+
+func TestRequestIDIsForwarded(t *testing.T) {
+	var forwarded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(logging.RequestIDHeader)
+		w.Write([]byte(`{"id": "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewCaseClient(server.URL, nil).GetCase(logging.WithRequestID(ctx, "frontstage-1234"), testCase.ID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "frontstage-1234", forwarded)
+}
+
+func TestRequestsAreTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	parentCtx, parent := tracing.Tracer().Start(ctx, "GET /v2/respondents")
+	_, err := NewCaseClient(server.URL, nil).GetCase(parentCtx, testCase.ID)
+	parent.End()
+
+	assert.Equal(t, ErrNotFound, err)
+	spans := recorder.Ended()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "Case GET", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Contains(t, traceparent, spans[0].SpanContext().SpanID().String())
+}
+
+func TestPublicOnlyClientsRefuseNonPublicAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPClient(Config{Timeout: time.Second, PublicOnly: true}).Get(server.URL)
+	assert.True(t, errors.Is(err, ErrNonPublicAddress))
+
+	res, err := NewHTTPClient(Config{Timeout: time.Second}).Get(server.URL)
+	assert.Nil(t, err)
+	res.Body.Close()
+
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00::1", "fe80::1", "::ffff:10.0.0.1",
+		"::ffff:127.0.0.1", "::ffff:169.254.169.254", "64:ff9b::a00:1", "64:ff9b::7f00:1", "64:ff9b::a9fe:a9fe", "64:ff9b:1::a00:1"} {
+		assert.False(t, isPublic(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "151.101.1.1", "2001:4860:4860::8888", "::ffff:8.8.8.8", "64:ff9b::808:808"} {
+		assert.True(t, isPublic(net.ParseIP(ip)), ip)
+	}
+}
@@ -0,0 +1,153 @@
+// Package clientstest provides a fake of the IAC, Case and Collection Exercise services for testing code which uses
+// the clients package.
+package clientstest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+)
+
+// Server is an HTTP server which serves the enrolment codes, cases and collection exercises added to it, in the
+// same way as the real services. All three services are served from its URL.
+type Server struct {
+	*httptest.Server
+
+	mu                  sync.Mutex
+	iacs                map[string]models.IAC
+	cases               map[string]models.Case
+	collectionExercises map[string]models.CollectionExercise
+	deactivated         []string
+	failing             map[string]int
+	delay               time.Duration
+	inFlight            int
+	maxInFlight         int
+}
+
+// NewServer starts and returns a server with nothing in it. It should be closed when finished with.
+func NewServer() *Server {
+	s := &Server{
+		iacs:                map[string]models.IAC{},
+		cases:               map[string]models.Case{},
+		collectionExercises: map[string]models.CollectionExercise{},
+		failing:             map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddIAC adds an enrolment code for the IAC service to serve
+func (s *Server) AddIAC(iac models.IAC) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.iacs[iac.IAC] = iac
+}
+
+// AddCase adds a case for the Case service to serve
+func (s *Server) AddCase(enrolmentCase models.Case) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cases[enrolmentCase.ID] = enrolmentCase
+}
+
+// AddCollectionExercise adds a collection exercise for the Collection Exercise service to serve
+func (s *Server) AddCollectionExercise(collectionExercise models.CollectionExercise) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collectionExercises[collectionExercise.ID] = collectionExercise
+}
+
+// Fail makes requests to the path provided respond with the status code provided
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing[path] = status
+}
+
+// SetDelay makes every response wait for the duration provided before being sent
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = delay
+}
+
+// MaxInFlight returns the largest number of requests which have been handled at the same time
+func (s *Server) MaxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight
+}
+
+// Deactivated returns the enrolment codes which have been deactivated, in the order they were deactivated
+func (s *Server) Deactivated() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.deactivated...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	delay := s.delay
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status, ok := s.failing[r.URL.Path]; ok {
+		w.WriteHeader(status)
+		return
+	}
+
+	var found interface{}
+	var ok bool
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/info":
+		found, ok = map[string]string{"name": "fake"}, true
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/iacs/"):
+		found, ok = s.iacs[strings.TrimPrefix(r.URL.Path, "/iacs/")]
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/cases/"):
+		found, ok = s.cases[strings.TrimPrefix(r.URL.Path, "/cases/")]
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/collectionexercises/"):
+		found, ok = s.collectionExercises[strings.TrimPrefix(r.URL.Path, "/collectionexercises/")]
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/iacs/"):
+		code := strings.TrimPrefix(r.URL.Path, "/iacs/")
+		iac, exists := s.iacs[code]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		iac.Active = false
+		s.iacs[code] = iac
+		s.deactivated = append(s.deactivated, code)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
@@ -0,0 +1,27 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+)
+
+type collectionExerciseClient struct {
+	service
+}
+
+// NewCollectionExerciseClient returns a client for the Collection Exercise service at the URL provided. If
+// httpClient is nil, http.DefaultClient is used.
+func NewCollectionExerciseClient(baseURL string, httpClient *http.Client) CollectionExerciseClient {
+	return &collectionExerciseClient{newService("Collection Exercise", baseURL, httpClient)}
+}
+
+func (c *collectionExerciseClient) GetCollectionExercise(ctx context.Context, id string) (models.CollectionExercise, error) {
+	collectionExercise := models.CollectionExercise{}
+	if err := c.do(ctx, http.MethodGet, "/collectionexercises/"+url.PathEscape(id), nil, &collectionExercise); err != nil {
+		return models.CollectionExercise{}, err
+	}
+	return collectionExercise, nil
+}
@@ -0,0 +1,36 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+)
+
+type iacClient struct {
+	service
+}
+
+// NewIACClient returns a client for the IAC service at the URL provided. If httpClient is nil, http.DefaultClient is
+// used.
+func NewIACClient(baseURL string, httpClient *http.Client) IACClient {
+	return &iacClient{newService("IAC", baseURL, httpClient)}
+}
+
+func (c *iacClient) GetIAC(ctx context.Context, code string) (models.IAC, error) {
+	iac := models.IAC{}
+	if err := c.do(ctx, http.MethodGet, "/iacs/"+url.PathEscape(code), nil, &iac); err != nil {
+		return models.IAC{}, err
+	}
+	if !iac.Active {
+		return iac, ErrInactive
+	}
+	return iac, nil
+}
+
+func (c *iacClient) DeactivateIAC(ctx context.Context, code string) error {
+	body := bytes.NewBuffer([]byte(`{"updatedBy": "Party Service"}`))
+	return c.do(ctx, http.MethodPut, "/iacs/"+url.PathEscape(code), body, nil)
+}
@@ -0,0 +1,121 @@
+// Package events publishes the changes made to the party data as versioned JSON events, so that other services can
+// react to them rather than polling. Events are recorded in the store's outbox alongside the change, and published once
+// it's committed.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The types of event published, and the version of each one's data. A version only changes if the data changes in a
+// way consumers would notice, e.g. a field being removed.
+const (
+	// RespondentCreated is published when a respondent is created. Its data is RespondentCreatedData.
+	RespondentCreated        = "respondent.created"
+	RespondentCreatedVersion = 1
+	// RespondentEmailChanged is published when a respondent's email address changes. Its data is
+	// RespondentEmailChangedData.
+	RespondentEmailChanged        = "respondent.email_changed"
+	RespondentEmailChangedVersion = 1
+	// RespondentDeleted is published when a respondent is deleted, along with their enrolments. Its data is
+	// RespondentDeletedData.
+	RespondentDeleted        = "respondent.deleted"
+	RespondentDeletedVersion = 1
+	// EnrolmentStatusChanged is published when the status of one of a respondent's enrolments changes, e.g. from
+	// PENDING to ENABLED or DISABLED. Its data is EnrolmentStatusChangedData.
+	EnrolmentStatusChanged        = "enrolment.status_changed"
+	EnrolmentStatusChangedVersion = 1
+	// BusinessCreated is published when a business is created. Its data is BusinessData.
+	BusinessCreated        = "business.created"
+	BusinessCreatedVersion = 1
+	// BusinessUpdated is published when a business is updated. Its data is BusinessData, as it is after the update.
+	BusinessUpdated        = "business.updated"
+	BusinessUpdatedVersion = 1
+)
+
+// Types is every type of event published
+var Types = []string{RespondentCreated, RespondentEmailChanged, RespondentDeleted, EnrolmentStatusChanged, BusinessCreated, BusinessUpdated}
+
+// Event is something that happened to the party data, as published to other services
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Enrolment is a survey a created respondent is enrolled on, and the business they're enrolled for
+type Enrolment struct {
+	BusinessID string `json:"businessId"`
+	SurveyID   string `json:"surveyId"`
+	Status     string `json:"status"`
+}
+
+// RespondentCreatedData is the data of a RespondentCreated event
+type RespondentCreatedData struct {
+	RespondentID string      `json:"respondentId"`
+	EmailAddress string      `json:"emailAddress"`
+	FirstName    string      `json:"firstName"`
+	LastName     string      `json:"lastName"`
+	Status       string      `json:"status"`
+	Enrolments   []Enrolment `json:"enrolments"`
+}
+
+// RespondentEmailChangedData is the data of a RespondentEmailChanged event
+type RespondentEmailChangedData struct {
+	RespondentID         string `json:"respondentId"`
+	PreviousEmailAddress string `json:"previousEmailAddress"`
+	EmailAddress         string `json:"emailAddress"`
+}
+
+// RespondentDeletedData is the data of a RespondentDeleted event
+type RespondentDeletedData struct {
+	RespondentID string `json:"respondentId"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// EnrolmentStatusChangedData is the data of an EnrolmentStatusChanged event
+type EnrolmentStatusChangedData struct {
+	RespondentID   string `json:"respondentId"`
+	BusinessID     string `json:"businessId"`
+	SurveyID       string `json:"surveyId"`
+	PreviousStatus string `json:"previousStatus"`
+	Status         string `json:"status"`
+}
+
+// BusinessData is the data of BusinessCreated and BusinessUpdated events
+type BusinessData struct {
+	BusinessID      string `json:"businessId"`
+	SampleUnitRef   string `json:"sampleUnitRef"`
+	SampleSummaryID string `json:"sampleSummaryId,omitempty"`
+	Name            string `json:"name"`
+	TradingAs       string `json:"tradingAs,omitempty"`
+}
+
+// New returns an event of the type and version provided, with its own ID, which happened now
+func New(eventType string, version int, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Version:    version,
+		OccurredAt: time.Now().UTC(),
+		Data:       raw,
+	}, nil
+}
+
+// Publisher sends events on to other services
+type Publisher interface {
+	// Publish returns once the event has been accepted, so that it isn't recorded as published if it wasn't
+	Publish(ctx context.Context, event Event) error
+	// Close stops the publisher, once any events being published have been
+	Close() error
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func TestNew(t *testing.T) {
+	event, err := New(RespondentEmailChanged, RespondentEmailChangedVersion, RespondentEmailChangedData{
+		RespondentID:         "be70e086-7bbc-461c-a565-5b454d748a71",
+		PreviousEmailAddress: "bob@boblaw.com",
+		EmailAddress:         "robert@boblaw.com",
+	})
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, "respondent.email_changed", event.Type)
+	assert.Equal(t, 1, event.Version)
+	assert.False(t, event.OccurredAt.IsZero())
+	assert.JSONEq(t, `{"respondentId":"be70e086-7bbc-461c-a565-5b454d748a71","previousEmailAddress":"bob@boblaw.com","emailAddress":"robert@boblaw.com"}`,
+		string(event.Data))
+
+	other, err := New(RespondentEmailChanged, RespondentEmailChangedVersion, RespondentEmailChangedData{})
+	assert.Nil(t, err)
+	assert.NotEqual(t, event.ID, other.ID)
+}
+
+func TestEventJSON(t *testing.T) {
+	event, err := New(RespondentCreated, RespondentCreatedVersion, RespondentCreatedData{RespondentID: "be70e086-7bbc-461c-a565-5b454d748a71"})
+	assert.Nil(t, err)
+
+	encoded, err := json.Marshal(event)
+	assert.Nil(t, err)
+	var fields map[string]interface{}
+	assert.Nil(t, json.Unmarshal(encoded, &fields))
+	assert.Equal(t, "respondent.created", fields["type"])
+	assert.Equal(t, float64(1), fields["version"])
+	assert.Equal(t, "be70e086-7bbc-461c-a565-5b454d748a71", fields["data"].(map[string]interface{})["respondentId"])
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	first, _ := New(RespondentCreated, RespondentCreatedVersion, RespondentCreatedData{})
+	second, _ := New(EnrolmentStatusChanged, EnrolmentStatusChangedVersion, EnrolmentStatusChangedData{})
+
+	assert.Nil(t, m.Publish(ctx, first))
+	assert.Nil(t, m.Publish(ctx, second))
+
+	assert.Equal(t, []Event{first, second}, m.Events())
+	assert.Nil(t, m.Close())
+}
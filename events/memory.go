@@ -0,0 +1,37 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a publisher which keeps the events published to it, for tests and running the service locally
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemory returns an in-memory publisher with nothing published
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Publish keeps the event
+func (m *Memory) Publish(ctx context.Context, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+// Events returns the events published so far, in the order they were published
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event{}, m.events...)
+}
+
+// Close does nothing, as there's nothing to stop
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+)
+
+// PubSub publishes events to a Google Pub/Sub topic. Each message's data is the event's JSON, and its attributes are
+// the event's type and version, so that subscriptions can filter on them.
+type PubSub struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+// NewPubSub returns a publisher to the topic in the project provided, which must already exist. If the
+// PUBSUB_EMULATOR_HOST environment variable is set, the topic is on the Pub/Sub emulator at that address instead.
+func NewPubSub(ctx context.Context, projectID, topicID string, opts ...option.ClientOption) (*PubSub, error) {
+	client, err := pubsub.NewClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("can't create Pub/Sub client: %w", err)
+	}
+
+	topic := client.Topic(topicID)
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("can't check Pub/Sub topic %s exists: %w", topicID, err)
+	}
+	if !exists {
+		client.Close()
+		return nil, fmt.Errorf("topic %s doesn't exist in Pub/Sub project %s", topicID, projectID)
+	}
+	return &PubSub{client: client, topic: topic}, nil
+}
+
+// Publish sends the event to the topic, and waits for Pub/Sub to accept it
+func (p *PubSub) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	result := p.topic.Publish(ctx, &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"eventId":      event.ID,
+			"eventType":    event.Type,
+			"eventVersion": strconv.Itoa(event.Version),
+		},
+	})
+	if _, err = result.Get(ctx); err != nil {
+		return fmt.Errorf("can't publish %s event to Pub/Sub: %w", event.Type, err)
+	}
+	return nil
+}
+
+// Close sends any messages still waiting to be sent, then closes the connection to Pub/Sub
+func (p *PubSub) Close() error {
+	p.topic.Stop()
+	return p.client.Close()
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+// Returns client options connecting to a fake Pub/Sub server with the topic provided, which is closed at the end of
+// the test
+func fakePubSub(t *testing.T, topicID string) (*pstest.Server, []option.ClientOption) {
+	server := pstest.NewServer()
+	conn, err := grpc.Dial(server.Addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal("Error connecting to fake Pub/Sub server, ", err.Error())
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close()
+	})
+	opts := []option.ClientOption{option.WithGRPCConn(conn)}
+
+	if topicID != "" {
+		client, err := pubsub.NewClient(ctx, "ras-rm-test", opts...)
+		if err != nil {
+			t.Fatal("Error creating Pub/Sub client, ", err.Error())
+		}
+		if _, err = client.CreateTopic(ctx, topicID); err != nil {
+			t.Fatal("Error creating Pub/Sub topic, ", err.Error())
+		}
+	}
+	return server, opts
+}
+
+func TestPubSubPublishesEventWithAttributes(t *testing.T) {
+	server, opts := fakePubSub(t, "party-events")
+	publisher, err := NewPubSub(ctx, "ras-rm-test", "party-events", opts...)
+	if err != nil {
+		t.Fatal("Error creating publisher, ", err.Error())
+	}
+	event, _ := New(RespondentCreated, RespondentCreatedVersion, RespondentCreatedData{RespondentID: "be70e086-7bbc-461c-a565-5b454d748a71"})
+
+	assert.Nil(t, publisher.Publish(ctx, event))
+	assert.Nil(t, publisher.Close())
+
+	messages := server.Messages()
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, map[string]string{"eventId": event.ID, "eventType": "respondent.created", "eventVersion": "1"}, messages[0].Attributes)
+	var published Event
+	assert.Nil(t, json.Unmarshal(messages[0].Data, &published))
+	assert.Equal(t, event.ID, published.ID)
+	assert.JSONEq(t, string(event.Data), string(published.Data))
+}
+
+func TestNewPubSubFailsIfTopicMissing(t *testing.T) {
+	_, opts := fakePubSub(t, "")
+
+	_, err := NewPubSub(ctx, "ras-rm-test", "party-events", opts...)
+
+	assert.Equal(t, "topic party-events doesn't exist in Pub/Sub project ras-rm-test", err.Error())
+}
+
+// Publishes to the Pub/Sub emulator, if there's one to publish to, e.g. one started with
+// gcloud beta emulators pubsub start --project=ras-rm-test
+func TestPubSubPublishesToEmulator(t *testing.T) {
+	if os.Getenv("PUBSUB_EMULATOR_HOST") == "" {
+		t.Skip("PUBSUB_EMULATOR_HOST isn't set")
+	}
+	client, err := pubsub.NewClient(ctx, "ras-rm-test")
+	if err != nil {
+		t.Fatal("Error creating Pub/Sub client, ", err.Error())
+	}
+	defer client.Close()
+	topic, err := client.CreateTopic(ctx, "party-events-"+t.Name())
+	if err != nil {
+		t.Fatal("Error creating Pub/Sub topic, ", err.Error())
+	}
+	defer topic.Delete(ctx)
+	subscription, err := client.CreateSubscription(ctx, topic.ID(), pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal("Error creating Pub/Sub subscription, ", err.Error())
+	}
+	defer subscription.Delete(ctx)
+
+	publisher, err := NewPubSub(ctx, "ras-rm-test", topic.ID())
+	if err != nil {
+		t.Fatal("Error creating publisher, ", err.Error())
+	}
+	defer publisher.Close()
+	event, _ := New(RespondentCreated, RespondentCreatedVersion, RespondentCreatedData{RespondentID: "be70e086-7bbc-461c-a565-5b454d748a71"})
+	assert.Nil(t, publisher.Publish(ctx, event))
+
+	received := make(chan *pubsub.Message, 1)
+	receiveCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	go subscription.Receive(receiveCtx, func(ctx context.Context, message *pubsub.Message) {
+		message.Ack()
+		received <- message
+		cancel()
+	})
+	select {
+	case message := <-received:
+		assert.Equal(t, "respondent.created", message.Attributes["eventType"])
+	case <-receiveCtx.Done():
+		t.Fatal("Event wasn't received from the emulator")
+	}
+}
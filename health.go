@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+)
+
+// Checks one thing the service depends on, returning an error if it's unusable
+type healthCheck func(ctx context.Context) error
+
+// Returns the checks a pod must pass to be sent traffic, by component name
+func readinessChecks() map[string]healthCheck {
+	checks := map[string]healthCheck{
+		"database": func(ctx context.Context) error {
+			if db == nil {
+				return errors.New("Database connection could not be found")
+			}
+			return db.PingContext(ctx)
+		},
+	}
+	if viper.GetBool("health_check_services") {
+		checks["iac"] = getIACClient().Ping
+		checks["case"] = getCaseClient().Ping
+		checks["collectionExercise"] = getCollectionExerciseClient().Ping
+	}
+	return checks
+}
+
+// Runs the checks at the same time, each with the health check timeout
+func runHealthChecks(ctx context.Context, checks map[string]healthCheck) models.Health {
+	health := models.Health{Status: "UP", Components: map[string]models.ComponentHealth{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check healthCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, viper.GetDuration("health_check_timeout"))
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			component := models.ComponentHealth{Status: "UP", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				component.Status = "DOWN"
+				component.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			health.Components[name] = component
+			if err != nil {
+				health.Status = "DOWN"
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return health
+}
+
+func getLiveness(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.Health{Status: "UP"})
+}
+
+func getReadiness(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	health := runHealthChecks(r.Context(), readinessChecks())
+
+	w.Header().Set("Content-Type", "application/json")
+	if health.Status != "UP" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func getHealth(t *testing.T, path string) models.Health {
+	req := httptest.NewRequest("GET", path, nil)
+	router.ServeHTTP(resp, req)
+
+	var health models.Health
+	err := json.NewDecoder(resp.Body).Decode(&health)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET "+path+"', ", err.Error())
+	}
+	return health
+}
+
+func TestLiveness(t *testing.T) {
+	setup()
+	db = nil
+
+	health := getHealth(t, "/v2/health/live")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "UP", health.Status)
+}
+
+func TestReadiness(t *testing.T) {
+	setup()
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+	mock.ExpectPing()
+
+	health := getHealth(t, "/v2/health/ready")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "UP", health.Status)
+	assert.Equal(t, 1, len(health.Components))
+	assert.Equal(t, "UP", health.Components["database"].Status)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReadinessReturns503IfDatabaseUnreachable(t *testing.T) {
+	setup()
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+
+	health := getHealth(t, "/v2/health/ready")
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "DOWN", health.Status)
+	assert.Equal(t, "DOWN", health.Components["database"].Status)
+	assert.Equal(t, "connection refused", health.Components["database"].Error)
+}
+
+func TestReadinessChecksServicesIfEnabled(t *testing.T) {
+	setup()
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+	mock.ExpectPing()
+	services := useFakeServices(t)
+	viper.Set("health_check_services", true)
+	defer viper.Set("health_check_services", false)
+
+	// The fake serves every service from one URL, so make only the Case service look broken
+	caseClient = nil
+	viper.Set("case_service", services.URL+"/broken")
+	defer viper.Set("case_service", "http://localhost:8171")
+
+	health := getHealth(t, "/v2/health/ready")
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "DOWN", health.Status)
+	assert.Equal(t, 4, len(health.Components))
+	assert.Equal(t, "UP", health.Components["database"].Status)
+	assert.Equal(t, "UP", health.Components["iac"].Status)
+	assert.Equal(t, "UP", health.Components["collectionExercise"].Status)
+	assert.Equal(t, "DOWN", health.Components["case"].Status)
+	assert.Equal(t, "Couldn't communicate with Case service: Received status code 404", health.Components["case"].Error)
+}
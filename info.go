@@ -1,19 +1,50 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"runtime"
+	"time"
 
+	"github.com/ONSdigital/ras-rm-party/migrations"
 	"github.com/ONSdigital/ras-rm-party/models"
 	"github.com/julienschmidt/httprouter"
 	"github.com/spf13/viper"
 )
 
+// When the service started, for reporting its uptime
+var startTime = time.Now()
+
 func getInfo(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	build := models.GetBuildInfo()
+
+	// The version configured for the deployment takes precedence over the one built in
+	version := viper.GetString("app_version")
+	if version == "unknown" && build.Version != "" {
+		version = build.Version
+	}
+
 	info := models.Info{
-		Name:    viper.GetString("service_name"),
-		Version: viper.GetString("app_version"),
+		Name:      viper.GetString("service_name"),
+		Version:   version,
+		Branch:    build.Branch,
+		Built:     build.Built,
+		Commit:    build.Commit,
+		Origin:    build.Origin,
+		GoVersion: runtime.Version(),
+		Uptime:    time.Since(startTime).Round(time.Second).String(),
 	}
+
+	// Info should still be available without the database, so the schema version is left out if it can't be found
+	if db != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), viper.GetDuration("health_check_timeout"))
+		defer cancel()
+		if schemaVersion, err := migrations.CurrentVersion(ctx, db); err == nil {
+			info.SchemaVersion = &schemaVersion
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(info)
 }
@@ -2,11 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ONSdigital/ras-rm-party/models"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -41,3 +45,67 @@ func TestInfoReturns301WithTrailingBackslash(t *testing.T) {
 	assert.Equal(t, http.StatusMovedPermanently, resp.Code)
 	assert.Equal(t, "/v2/info", resp.HeaderMap.Get("Location"))
 }
+
+func TestInfoReportsRuntimeAndSchemaVersion(t *testing.T) {
+	setup()
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+	mock.ExpectQuery("SELECT COALESCE(.+) FROM partysvc.schema_version").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+
+	req := httptest.NewRequest("GET", "/v2/info", nil)
+	router.ServeHTTP(resp, req)
+
+	var infoResp models.Info
+	err = json.NewDecoder(resp.Body).Decode(&infoResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /info', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, runtime.Version(), infoResp.GoVersion)
+	assert.NotEmpty(t, infoResp.Uptime)
+	assert.Equal(t, 3, *infoResp.SchemaVersion)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestInfoLeavesOutSchemaVersionIfDatabaseUnavailable(t *testing.T) {
+	setup()
+	var mock sqlmock.Sqlmock
+	var err error
+
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+	mock.ExpectQuery("SELECT COALESCE(.+) FROM partysvc.schema_version").WillReturnError(fmt.Errorf("connection refused"))
+
+	req := httptest.NewRequest("GET", "/v2/info", nil)
+	router.ServeHTTP(resp, req)
+
+	var infoResp models.Info
+	err = json.NewDecoder(resp.Body).Decode(&infoResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /info', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, viper.GetString("service_name"), infoResp.Name)
+	assert.Nil(t, infoResp.SchemaVersion)
+}
+
+func TestInfoEchoesRequestID(t *testing.T) {
+	setup()
+	db = nil
+
+	req := httptest.NewRequest("GET", "/v2/info", nil)
+	req.Header.Set("X-Request-ID", "frontstage-1234")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "frontstage-1234", resp.Header().Get("X-Request-ID"))
+}
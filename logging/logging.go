@@ -0,0 +1,98 @@
+// Package logging provides the service's structured logger, and ties the lines logged while handling a request to
+// that request through its ID.
+package logging
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestIDHeader is the header a request's ID is accepted from, echoed in and forwarded on
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+var logger = zap.NewNop()
+
+// Configure sets up the logger with the level provided (e.g. "debug", "info", "warn" or "error") and format, which
+// is either "json" or "console" for people reading it locally
+func Configure(level, format, service string) error {
+	var zapLevel zapcore.Level
+	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+
+	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(zapLevel)
+	config.Encoding = format
+	config.EncoderConfig.TimeKey = "time"
+	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	if format == "console" {
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+
+	configured, err := config.Build(zap.Fields(zap.String("service", service)))
+	if err != nil {
+		return err
+	}
+	SetLogger(configured)
+	return nil
+}
+
+// SetLogger replaces the logger, e.g. with an observed one in tests
+func SetLogger(l *zap.Logger) {
+	logger = l
+}
+
+// Logger returns the logger for work which isn't part of a request
+func Logger() *zap.Logger {
+	return logger
+}
+
+// FromContext returns the logger for the request the context belongs to, which includes the request's ID, and the
+// trace it's part of, in every line it logs
+func FromContext(ctx context.Context) *zap.Logger {
+	var fields []zap.Field
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		fields = append(fields, zap.String("trace_id", span.TraceID().String()), zap.String("span_id", span.SpanID().String()))
+	}
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
+}
+
+// WithRequestID returns a copy of the context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the request the context belongs to, or an empty string if it has none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Middleware gives each request an ID, taken from its X-Request-ID header if the caller sent one, and echoes it in the
+// response
+func Middleware(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h(w, r.WithContext(WithRequestID(r.Context(), id)), ps)
+	}
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	var seen string
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		seen = RequestID(r.Context())
+	})
+
+	resp := httptest.NewRecorder()
+	handler(resp, httptest.NewRequest("GET", "/v2/info", nil), nil)
+
+	_, err := uuid.Parse(seen)
+	assert.Nil(t, err)
+	assert.Equal(t, seen, resp.Header().Get(RequestIDHeader))
+}
+
+func TestMiddlewareAcceptsCallersRequestID(t *testing.T) {
+	var seen string
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		seen = RequestID(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/v2/info", nil)
+	req.Header.Set(RequestIDHeader, "frontstage-1234")
+	resp := httptest.NewRecorder()
+	handler(resp, req, nil)
+
+	assert.Equal(t, "frontstage-1234", seen)
+	assert.Equal(t, "frontstage-1234", resp.Header().Get(RequestIDHeader))
+}
+
+func TestFromContextLogsRequestID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	SetLogger(zap.New(core))
+	defer SetLogger(zap.NewNop())
+
+	FromContext(WithRequestID(context.Background(), "frontstage-1234")).Info("Successfully deleted respondent")
+	FromContext(context.Background()).Info("Shutting down Party service...")
+
+	entries := logs.AllUntimed()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "frontstage-1234", entries[0].ContextMap()["request_id"])
+	assert.NotContains(t, entries[1].ContextMap(), "request_id")
+}
+
+func TestConfigureRejectsUnknownLevel(t *testing.T) {
+	assert.NotNil(t, Configure("loud", "json", "ras-rm-party"))
+	assert.Nil(t, Configure("debug", "json", "ras-rm-party"))
+	SetLogger(zap.NewNop())
+}
+
+func TestFromContextLogsTraceID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	SetLogger(zap.New(core))
+	defer SetLogger(zap.NewNop())
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	FromContext(spanCtx).Info("Successfully deleted respondent")
+
+	entries := logs.AllUntimed()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entries[0].ContextMap()["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", entries[0].ContextMap()["span_id"])
+}
@@ -3,64 +3,247 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/ONSdigital/ras-rm-party/auth"
+	"github.com/ONSdigital/ras-rm-party/clients"
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/metrics"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/ONSdigital/ras-rm-party/tracing"
 	"github.com/julienschmidt/httprouter"
+	"github.com/lib/pq"
 	"github.com/spf13/viper"
-
-	_ "github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
-var wg sync.WaitGroup
 var db *sql.DB
+var httpClient *http.Client
 
-func auth(h httprouter.Handle, requiredUser, requiredPassword string) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		user, password, hasAuth := r.BasicAuth()
+// Stores to use in place of the database, e.g. in tests
+var respondentStore store.RespondentStore
+var businessStore store.BusinessStore
+var outboxStore store.OutboxStore
+var webhookStore store.WebhookStore
 
-		if hasAuth && user == requiredUser && password == requiredPassword {
-			h(w, r, ps)
-		} else {
-			w.Header().Set("WWW-Authenticate", "Basic realm=Restricted")
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		}
+// Returns the store for respondents, or nil if there's nothing to store them in
+func getRespondentStore() store.RespondentStore {
+	if respondentStore != nil {
+		return respondentStore
+	}
+	if db == nil {
+		return nil
+	}
+	return store.NewPostgres(db)
+}
+
+// Returns the store for businesses, or nil if there's nothing to store them in
+func getBusinessStore() store.BusinessStore {
+	if businessStore != nil {
+		return businessStore
 	}
+	if db == nil {
+		return nil
+	}
+	return store.NewPostgres(db)
 }
 
-func addRoutes(r *httprouter.Router) {
-	r.GET("/v2/info", getInfo)
-	r.GET("/v2/respondents", auth(getRespondents, viper.GetString("security_user_name"), viper.GetString("security_user_password")))
-	r.POST("/v2/respondents", auth(postRespondents, viper.GetString("security_user_name"), viper.GetString("security_user_password")))
-	r.DELETE("/v2/respondents/:id", auth(deleteRespondents, viper.GetString("security_user_name"), viper.GetString("security_user_password")))
-	r.GET("/v2/respondents/:id", auth(getRespondentsByID, viper.GetString("security_user_name"), viper.GetString("security_user_password")))
-	r.PATCH("/v2/respondents/:id", auth(patchRespondentsByID, viper.GetString("security_user_name"), viper.GetString("security_user_password")))
+// Returns the store for the outbox, or nil if there's nothing to store it in
+func getOutboxStore() store.OutboxStore {
+	if outboxStore != nil {
+		return outboxStore
+	}
+	if db == nil {
+		return nil
+	}
+	return store.NewPostgres(db)
 }
 
-func startServer(r http.Handler, wg *sync.WaitGroup) *http.Server {
-	srv := &http.Server{
-		Handler: r,
-		Addr:    ":" + viper.GetString("port"),
+// Returns the store for webhooks, or nil if there's nothing to store them in
+func getWebhookStore() store.WebhookStore {
+	if webhookStore != nil {
+		return webhookStore
 	}
+	if db == nil {
+		return nil
+	}
+	return store.NewPostgres(db)
+}
 
-	go func() {
-		defer wg.Done()
+// Clients to use in place of the real services, e.g. in tests
+var iacClient clients.IACClient
+var caseClient clients.CaseClient
+var collectionExerciseClient clients.CollectionExerciseClient
 
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatal("Panic running Party service API:", err.Error())
+// Returns the client for the IAC service
+func getIACClient() clients.IACClient {
+	if iacClient != nil {
+		return iacClient
+	}
+	return clients.NewIACClient(viper.GetString("iac_service"), httpClient)
+}
+
+// Returns the client for the Case service
+func getCaseClient() clients.CaseClient {
+	if caseClient != nil {
+		return caseClient
+	}
+	return clients.NewCaseClient(viper.GetString("case_service"), httpClient)
+}
+
+// Returns the client for the Collection Exercise service
+func getCollectionExerciseClient() clients.CollectionExerciseClient {
+	if collectionExerciseClient != nil {
+		return collectionExerciseClient
+	}
+	return clients.NewCollectionExerciseClient(viper.GetString("collection_exercise_service"), httpClient)
+}
+
+// Writes the error response for a failed store operation
+func writeStoreError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var storeErr *store.Error
+	var codeErr *enrolmentCodeError
+	if errors.As(err, &storeErr) {
+		switch storeErr.Kind {
+		case store.Unprocessable:
+			status = http.StatusUnprocessableEntity
+		case store.Missing:
+			status = http.StatusNotFound
+		case store.Conflict:
+			status = http.StatusConflict
 		}
-	}()
+	} else if errors.As(err, &codeErr) {
+		status = codeErr.status
+	}
 
-	return srv
+	w.WriteHeader(status)
+	errorString := models.Error{
+		Error: err.Error(),
+	}
+	json.NewEncoder(w).Encode(errorString)
+}
+
+// Returns the request's context, carrying the client making it as the actor to record changes against in the audit log
+func auditContext(r *http.Request) context.Context {
+	if client := auth.ClientFromContext(r.Context()); client != nil {
+		return store.WithActor(r.Context(), client.Name)
+	}
+	return r.Context()
+}
+
+// Authenticator to use in place of the one configured, e.g. in tests
+var authenticator *auth.Authenticator
+
+// Returns the authenticator for the configured clients. If they can't be loaded, no client is authenticated.
+func getAuthenticator() *auth.Authenticator {
+	if authenticator != nil {
+		return authenticator
+	}
+	a, err := newAuthenticator()
+	if err != nil {
+		logging.Logger().Error("Error loading clients", zap.Error(err))
+		a, _ = auth.New()
+	}
+	return a
+}
+
+// Returns the authenticator for auth_mode: "basic" for basic auth, "jwt" for bearer tokens, or "jwt_with_basic" for
+// bearer tokens with basic auth as a fallback
+func newAuthenticator() (*auth.Authenticator, error) {
+	mode := viper.GetString("auth_mode")
+	var clients []auth.ClientConfig
+	if mode == "basic" || mode == "jwt_with_basic" {
+		var err error
+		if clients, err = auth.LoadClients(viper.GetViper()); err != nil {
+			return nil, err
+		}
+	} else if mode != "jwt" {
+		return nil, errors.New("unknown auth mode " + mode)
+	}
+
+	a, err := auth.New(clients...)
+	if err != nil || mode == "basic" {
+		return a, err
+	}
+
+	tokens, err := auth.LoadTokenConfig(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := auth.NewTokenVerifier(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return a.WithTokens(verifier), nil
+}
+
+func addRoutes(r *httprouter.Router, loader *businessLoader) {
+	a := getAuthenticator()
+
+	handle(r, http.MethodGet, "/v2/info", getInfo)
+	handle(r, http.MethodGet, "/v2/health/live", getLiveness)
+	handle(r, http.MethodGet, "/v2/health/ready", getReadiness)
+	handle(r, http.MethodGet, "/v2/respondents", a.Require(auth.ReadRespondents, getRespondents))
+	handle(r, http.MethodPost, "/v2/respondents", a.Require(auth.WriteRespondents, postRespondents))
+	handle(r, http.MethodDelete, "/v2/respondents/:id", a.Require(auth.DeleteRespondents, deleteRespondents))
+	handle(r, http.MethodGet, "/v2/respondents/:id", a.Require(auth.ReadRespondents, getRespondentsByID))
+	handle(r, http.MethodPatch, "/v2/respondents/:id", a.Require(auth.WriteRespondents, patchRespondentsByID))
+	handle(r, http.MethodGet, "/v2/respondents/:id/history", a.Require(auth.ReadHistory, getRespondentHistory))
+	handle(r, http.MethodGet, "/v2/businesses", a.Require(auth.ReadBusinesses, getBusinesses))
+	handle(r, http.MethodPost, "/v2/businesses", a.Require(auth.WriteBusinesses, postBusinesses))
+	handle(r, http.MethodPost, "/v2/businesses/resolve", a.Require(auth.ReadBusinesses, resolveBusinesses))
+	handle(r, http.MethodGet, "/v2/businesses/:id", a.Require(auth.ReadBusinesses, getBusinessByID))
+	handle(r, http.MethodPatch, "/v2/businesses/:id", a.Require(auth.WriteBusinesses, patchBusinessByID))
+	handle(r, http.MethodGet, "/v2/businesses/:id/history", a.Require(auth.ReadBusinesses, getBusinessHistory))
+	handle(r, http.MethodPut, "/v2/businesses/sample/link/:sampleSummaryId", a.Require(auth.WriteBusinesses, putSampleLink))
+	handleWithBodyLimit(r, http.MethodPost, "/v2/business-loads", viper.GetInt64("business_load_max_bytes"),
+		a.Require(auth.WriteBusinesses, extendDeadline(postBusinessLoads(loader), viper.GetDuration("business_load_timeout"))))
+	handle(r, http.MethodGet, "/v2/business-loads/:id", a.Require(auth.ReadBusinesses, getBusinessLoadByID))
+	handle(r, http.MethodGet, "/v2/outbox/stuck", a.Require(auth.ReadOutbox, getStuckOutboxEntries))
+	handle(r, http.MethodGet, "/v2/webhooks", a.Require(auth.ManageWebhooks, getWebhooks))
+	handle(r, http.MethodPost, "/v2/webhooks", a.Require(auth.ManageWebhooks, postWebhooks))
+	handle(r, http.MethodGet, "/v2/webhooks/:id", a.Require(auth.ManageWebhooks, getWebhookByID))
+	handle(r, http.MethodDelete, "/v2/webhooks/:id", a.Require(auth.ManageWebhooks, deleteWebhookByID))
+	handle(r, http.MethodGet, "/v2/webhooks/:id/deliveries", a.Require(auth.ManageWebhooks, getWebhookDeliveries))
+
+	// The legacy v1 endpoints, at the paths the Python party service served them on, for clients which still call them
+	handle(r, http.MethodPost, "/party-api/v1/parties", a.Require(auth.WriteBusinesses, postParties))
+	handle(r, http.MethodGet, "/party-api/v1/parties/type/B/id/:id", a.Require(auth.ReadBusinesses, getBusinessPartyByID))
+	handle(r, http.MethodGet, "/party-api/v1/parties/type/B/ref/:ref", a.Require(auth.ReadBusinesses, getBusinessPartyByRef))
+	handle(r, http.MethodGet, "/party-api/v1/parties/type/BI/id/:id", a.Require(auth.ReadRespondents, getRespondentPartyByID))
+	handle(r, http.MethodGet, "/party-api/v1/parties/type/BI/ref/:ref", a.Require(auth.ReadRespondents, getRespondentPartyByRef))
+	handle(r, http.MethodPut, "/party-api/v1/businesses/sample/link/:sampleSummaryId", a.Require(auth.WriteBusinesses, putSampleLink))
+
+	r.Handler(http.MethodGet, "/metrics", metrics.Handler())
+}
+
+// Adds the handler for the route, instrumented with metrics, traced, given a request ID and with its body limited
+func handle(r *httprouter.Router, method, path string, h httprouter.Handle) {
+	handleWithBodyLimit(r, method, path, viper.GetInt64("max_request_body_bytes"), h)
+}
+
+// Adds the handler for a route which takes larger (or smaller) bodies than most, limited to maxBodyBytes
+func handleWithBodyLimit(r *httprouter.Router, method, path string, maxBodyBytes int64, h httprouter.Handle) {
+	h = limitBody(h, maxBodyBytes)
+	r.Handle(method, path, logging.Middleware(tracing.Middleware(path, metrics.Instrument(path, h))))
 }
 
 func connectToDB() (*sql.DB, error) {
-	db, err := sql.Open("postgres", viper.GetString("database_uri"))
+	connector, err := pq.NewConnector(viper.GetString("database_uri"))
 	if err != nil {
 		return nil, err
 	}
+	db := sql.OpenDB(tracing.WrapConnector(connector))
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
@@ -72,26 +255,129 @@ func main() {
 	viper.AutomaticEnv()
 	setDefaults()
 
+	if err := logging.Configure(viper.GetString("log_level"), viper.GetString("log_format"), viper.GetString("service_name")); err != nil {
+		log.Fatal("Error configuring logging: ", err.Error())
+	}
+	logger := logging.Logger()
+	defer logger.Sync()
+
 	// Connect to DB
 	var err error
 	if db, err = connectToDB(); err != nil {
-		log.Fatal("Error connecting to Postgres:", err.Error())
+		logger.Fatal("Error connecting to Postgres", zap.Error(err))
+	}
+
+	// Run a subcommand instead of serving, if one was given, before configuring anything only the server needs
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err = runMigrate(context.Background(), db, os.Args[2:], os.Stdout); err != nil {
+				logger.Fatal("Error migrating database schema", zap.Error(err))
+			}
+		case "load-businesses":
+			if err = runLoadBusinesses(context.Background(), getBusinessStore(), os.Args[2:], os.Stdout); err != nil {
+				logger.Fatal("Error loading businesses", zap.Error(err))
+			}
+		default:
+			logger.Fatal("Unknown command", zap.String("command", os.Args[1]))
+		}
+		return
+	}
+
+	stopTracing, err := tracing.Configure(context.Background(), tracing.Config{
+		Exporter:    viper.GetString("tracing_exporter"),
+		File:        viper.GetString("tracing_file"),
+		Endpoint:    viper.GetString("tracing_otlp_endpoint"),
+		Insecure:    viper.GetBool("tracing_otlp_insecure"),
+		SampleRatio: viper.GetFloat64("tracing_sample_ratio"),
+		Service:     viper.GetString("service_name"),
+		Version:     viper.GetString("app_version"),
+	})
+	if err != nil {
+		logger.Fatal("Error configuring tracing", zap.Error(err))
+	}
+
+	if authenticator, err = newAuthenticator(); err != nil {
+		logger.Fatal("Error loading clients", zap.Error(err))
+	}
+
+	if err = metrics.RegisterDB(db, "party"); err != nil {
+		logger.Fatal("Error registering database metrics", zap.Error(err))
 	}
 
-	// Start serving HTTP
+	// Share one pool of connections between the clients for other services
+	httpClient = clients.NewHTTPClient(clients.Config{
+		Timeout:             viper.GetDuration("http_client_timeout"),
+		MaxIdleConnsPerHost: viper.GetInt("http_client_max_idle_conns_per_host"),
+	})
+
+	publisher, err := newPublisher(context.Background())
+	if err != nil {
+		logger.Fatal("Error creating event publisher", zap.Error(err))
+	}
+
+	// Send on the outbox in the background
+	dispatchCtx, stopDispatching := context.WithCancel(context.Background())
+	dispatched := make(chan struct{})
+	go func() {
+		newOutboxDispatcher(getOutboxStore(), getWebhookStore(), publisher).Run(dispatchCtx)
+		close(dispatched)
+	}()
+
+	// Fail the business loads which stopped without finishing, e.g. because the replica running them was killed
+	staleLoads, err := getBusinessStore().FailStaleBusinessLoads(context.Background(), time.Now().Add(-viper.GetDuration("business_load_stale_after")))
+	if err != nil {
+		logger.Error("Error failing stale business loads", zap.Error(err))
+	} else if staleLoads > 0 {
+		logger.Warn("Failed business loads which stopped without finishing", zap.Int("business_loads", staleLoads))
+	}
+
+	// Serve HTTP until Kubernetes, or whoever started us, asks us to stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	router := httprouter.New()
-	addRoutes(router)
+	loader := newBusinessLoader()
+	addRoutes(router, loader)
+	srv := newServer(router)
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		logger.Fatal("Error listening for Party service API", zap.Error(err))
+	}
 
-	wg.Add(1)
-	srv := startServer(router, &wg)
-	wg.Wait()
+	timeout := viper.GetDuration("shutdown_timeout")
+	if err = serve(ctx, srv, listener, viper.GetString("tls_cert_file"), viper.GetString("tls_key_file"), timeout); err != nil {
+		logger.Error("Error serving Party service API", zap.Error(err))
+	}
 
-	log.Println("Shutting down Party service...")
+	// Let the business loads finish, stopping any which are still running at the timeout
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), timeout)
+	if err = loader.Wait(waitCtx); err != nil {
+		logger.Warn("Business loads didn't finish before the shutdown timeout, so were stopped")
+	}
+	cancelWait()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+	// Let the outbox finish what it's dispatching, then flush what's left
+	stopDispatching()
+	select {
+	case <-dispatched:
+	case <-time.After(timeout):
+		logger.Warn("Outbox dispatcher didn't finish before the shutdown timeout")
+	}
 
-	if err = srv.Shutdown(ctx); err != nil {
-		log.Fatal(err)
+	if publisher != nil {
+		if err = publisher.Close(); err != nil {
+			logger.Error("Error closing event publisher", zap.Error(err))
+		}
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = stopTracing(flushCtx); err != nil {
+		logger.Error("Error flushing traces", zap.Error(err))
+	}
+	if err = db.Close(); err != nil {
+		logger.Error("Error closing database connections", zap.Error(err))
 	}
+	logger.Info("Party service stopped")
 }
@@ -2,11 +2,15 @@ package main
 
 import (
 	"database/sql/driver"
+	"net/http"
 	"net/http/httptest"
-	"sync"
 	"testing"
 	"time"
 
+	"github.com/ONSdigital/ras-rm-party/auth"
+	"github.com/ONSdigital/ras-rm-party/clients"
+	"github.com/ONSdigital/ras-rm-party/clients/clientstest"
+	"github.com/ONSdigital/ras-rm-party/store"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/spf13/viper"
@@ -16,7 +20,8 @@ import (
 var router *httprouter.Router
 var resp *httptest.ResponseRecorder
 
-var testWg sync.WaitGroup
+// Runs the business loads posted in tests, so that they can wait for them to finish
+var businessLoads *businessLoader
 
 // Matching functions for sqlmock
 type AnyUUID struct{}
@@ -38,14 +43,102 @@ func setup() {
 	router = httprouter.New()
 	resp = httptest.NewRecorder()
 
-	addRoutes(router)
+	businessLoads = newBusinessLoader()
+	addRoutes(router, businessLoads)
 }
 
-func TestStartServer(t *testing.T) {
+// Makes the handlers use an empty in-memory store until the end of the test
+func useMemoryStore(t *testing.T) *store.Memory {
+	memory := store.NewMemory()
+	respondentStore, businessStore, outboxStore, webhookStore = memory, memory, memory, memory
+	t.Cleanup(func() {
+		respondentStore, businessStore, outboxStore, webhookStore = nil, nil, nil, nil
+	})
+	return memory
+}
+
+// Makes the handlers use a fake of the services they call until the end of the test
+func useFakeServices(t *testing.T) *clientstest.Server {
+	server := clientstest.NewServer()
+	iacClient = clients.NewIACClient(server.URL, nil)
+	caseClient = clients.NewCaseClient(server.URL, nil)
+	collectionExerciseClient = clients.NewCollectionExerciseClient(server.URL, nil)
+	t.Cleanup(func() {
+		iacClient, caseClient, collectionExerciseClient = nil, nil, nil
+		server.Close()
+	})
+	return server
+}
+
+// Makes the routes authenticate the clients provided, rather than those configured, until the end of the test
+func useClients(t *testing.T, clients ...auth.ClientConfig) {
+	a, err := auth.New(clients...)
+	if err != nil {
+		t.Fatal("Error creating authenticator, ", err.Error())
+	}
+	authenticator = a
+	t.Cleanup(func() {
+		authenticator = nil
+	})
+	setup()
+}
+
+func TestRoutesRequireScopes(t *testing.T) {
+	useMemoryStore(t)
+	useClients(t, auth.ClientConfig{Name: "batch", User: "batch", Password: "batch-secret", Scopes: []string{auth.ReadRespondents}})
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/respondents/be70e086-7bdc-4f3a-bc4a-2eb0db5bde0b", nil)
+	req.SetBasicAuth("batch", "batch-secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/v2/respondents/be70e086-7bdc-4f3a-bc4a-2eb0db5bde0b", nil)
+	req.SetBasicAuth("batch", "batch-secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/v2/respondents/be70e086-7bdc-4f3a-bc4a-2eb0db5bde0b", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestNewAuthenticatorModes(t *testing.T) {
 	setDefaults()
-	router := httprouter.New()
-	testWg.Add(1)
-	srv := startServer(router, &testWg)
-	assert.Equal(t, ":"+viper.GetString("port"), srv.Addr)
-	srv.Close()
+	defer viper.Set("auth_mode", "basic")
+
+	viper.Set("auth_mode", "sideways")
+	_, err := newAuthenticator()
+	assert.Equal(t, "unknown auth mode sideways", err.Error())
+
+	viper.Set("auth_mode", "jwt")
+	_, err = newAuthenticator()
+	assert.NotNil(t, err)
+
+	viper.Set("jwt_issuer", "https://auth.example.com")
+	viper.Set("jwt_secret", "a-secret-shared-with-the-issuer")
+	defer viper.Set("jwt_issuer", "")
+	defer viper.Set("jwt_secret", "")
+	for _, mode := range []string{"jwt", "jwt_with_basic", "basic"} {
+		viper.Set("auth_mode", mode)
+		_, err = newAuthenticator()
+		assert.Nil(t, err, mode)
+	}
+}
+
+func TestMetricsAreRecordedForRoutes(t *testing.T) {
+	setup()
+
+	req := httptest.NewRequest("GET", "/v2/info", nil)
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `party_http_requests_total{method="GET",route="/v2/info",status="200"}`)
 }
@@ -0,0 +1,113 @@
+// Package metrics collects Prometheus metrics for the party service: the requests it serves, the calls it makes to
+// other services and the state of its database connection pool.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "party"
+
+// Registry holds every metric the service exposes
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests served, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve requests, by method, route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	outboundRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbound_requests_total",
+		Help:      "Requests made to other services, by service, method and outcome.",
+	}, []string{"service", "method", "outcome"})
+
+	outboundDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "outbound_request_duration_seconds",
+		Help:      "Time taken by requests made to other services, by service, method and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		outboundRequests,
+		outboundDuration,
+	)
+}
+
+// Handler returns the handler serving the metrics for Prometheus to scrape
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB adds the connection pool statistics of the database to the metrics
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Records the status code written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Instrument counts and times the requests served by the handler for the route pattern provided, e.g.
+// /v2/respondents/:id. The pattern is used rather than the path so that IDs don't each get their own metrics.
+func Instrument(route string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		h(recorder, r, ps)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		status := strconv.Itoa(recorder.status)
+		httpRequests.WithLabelValues(r.Method, route, status).Inc()
+		httpDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveOutbound records a request made to another service, and its outcome, e.g. "success", "not_found" or "error"
+func ObserveOutbound(service, method, outcome string, duration time.Duration) {
+	outboundRequests.WithLabelValues(service, method, outcome).Inc()
+	outboundDuration.WithLabelValues(service, method, outcome).Observe(duration.Seconds())
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentRecordsRoutePatternAndStatus(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/v2/things/:id", Instrument("/v2/things/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if ps.ByName("id") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+
+	for _, id := range []string{"1", "2", "missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v2/things/"+id, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/v2/things/:id", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/v2/things/:id", "404")))
+}
+
+func TestHandlerExposesOutboundMetrics(t *testing.T) {
+	ObserveOutbound("Case", "GET", "error", 20*time.Millisecond)
+
+	resp := httptest.NewRecorder()
+	Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	body := resp.Body.String()
+	assert.True(t, strings.Contains(body, `party_outbound_requests_total{method="GET",outcome="error",service="Case"} 1`))
+	assert.True(t, strings.Contains(body, "party_outbound_request_duration_seconds_bucket"))
+	assert.True(t, strings.Contains(body, "go_goroutines"))
+}
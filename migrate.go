@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/migrations"
+)
+
+var errMigrateUsage = errors.New("usage: migrate up|down|status")
+
+// Runs the migrate subcommand, e.g. `ras-rm-party migrate up`, writing what it did to out
+func runMigrate(ctx context.Context, db *sql.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errMigrateUsage
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "Applied %04d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "Schema is up to date")
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err == migrations.ErrNothingToRevert {
+			fmt.Fprintln(out, "No migrations to revert")
+			return nil
+		}
+		if err == migrations.ErrBaseline {
+			fmt.Fprintln(out, "Only the baseline migrations have been applied, which can't be reverted")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Reverted %04d %s\n", reverted.Version, reverted.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedOn.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d %-40s %s\n", status.Migration.Version, status.Migration.Name, state)
+		}
+	default:
+		return errMigrateUsage
+	}
+
+	return nil
+}
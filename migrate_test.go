@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/ras-rm-party/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunMigrateRejectsUnknownCommands(t *testing.T) {
+	for _, args := range [][]string{{}, {"sideways"}, {"up", "down"}} {
+		err := runMigrate(context.Background(), nil, args, &bytes.Buffer{})
+		assert.Equal(t, errMigrateUsage, err)
+	}
+}
+
+func TestRunMigrateStatus(t *testing.T) {
+	migrationDB, mock, err := sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	all, err := migrations.Load()
+	if err != nil {
+		t.Fatal("Error loading migrations, ", err.Error())
+	}
+
+	mock.ExpectExec("CREATE SCHEMA IF NOT EXISTS partysvc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, applied_on FROM partysvc.schema_version").WillReturnRows(sqlmock.NewRows([]string{"version", "applied_on"}))
+
+	var out bytes.Buffer
+	err = runMigrate(context.Background(), migrationDB, []string{"status"}, &out)
+
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "0001 "+all[0].Name)
+	assert.Contains(t, out.String(), "pending")
+}
+
+func TestRunMigrateDownWithNothingApplied(t *testing.T) {
+	migrationDB, mock, err := sqlmock.New()
+	if err != nil {
+		log.Fatalf("Error setting up an SQL mock")
+	}
+
+	mock.ExpectExec("CREATE SCHEMA IF NOT EXISTS partysvc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, applied_on FROM partysvc.schema_version").WillReturnRows(sqlmock.NewRows([]string{"version", "applied_on"}))
+
+	var out bytes.Buffer
+	err = runMigrate(context.Background(), migrationDB, []string{"down"}, &out)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "No migrations to revert\n", out.String())
+}
@@ -0,0 +1,264 @@
+// Package migrations creates and evolves the partysvc schema, using versioned SQL scripts embedded in the binary.
+//
+// Each migration is a pair of scripts in sql/, named <version>_<name>.up.sql and <version>_<name>.down.sql, where
+// the versions are numbered from 1 without gaps. The versions applied so far are recorded in partysvc.schema_version.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var scripts embed.FS
+
+// ErrNothingToRevert is returned when reverting a migration if none have been applied
+var ErrNothingToRevert = errors.New("no migrations have been applied")
+
+// ErrBaseline is returned when reverting a migration if only the baseline migrations have been applied
+var ErrBaseline = errors.New("the baseline migrations can't be reverted")
+
+// BaselineVersion is the version of the last migration creating the tables the Python party service used. Up adopts
+// them, along with its data, if they already exist, so the baseline migrations are never reverted.
+const BaselineVersion = 2
+
+// Migration represents a single, reversible change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status represents whether a migration has been applied to the database, and when
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedOn time.Time
+}
+
+// Load returns all of the embedded migrations, in version order
+func Load() ([]Migration, error) {
+	return load(scripts, "sql")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", name)
+		}
+
+		parts := strings.SplitN(strings.TrimSuffix(name, "."+direction+".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>", name)
+		}
+
+		script, err := fs.ReadFile(fsys, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = migration
+		}
+		if migration.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d has more than one name: %s and %s", version, migration.Name, parts[1])
+		}
+		if direction == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for idx, migration := range migrations {
+		if migration.Version != idx+1 {
+			return nil, fmt.Errorf("migration %d is missing", idx+1)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both an up and a down script", migration.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations against a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	baseline   int
+}
+
+// New creates a migrator for the database provided, using the embedded migrations
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, baseline: BaselineVersion}, nil
+}
+
+// CurrentVersion returns the version of the latest migration applied to the database, or 0 if none have been. Unlike
+// the migrator, it doesn't create the schema_version table if it's missing.
+func CurrentVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM partysvc.schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("can't retrieve schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Creates the schema and the table recording which migrations have been applied, if they don't already exist
+func (m *Migrator) ensureVersionTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS partysvc; "+
+		"CREATE TABLE IF NOT EXISTS partysvc.schema_version (version INTEGER PRIMARY KEY, name TEXT NOT NULL, "+
+		"applied_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now())")
+	if err != nil {
+		return fmt.Errorf("can't create schema_version table: %w", err)
+	}
+	return nil
+}
+
+// Returns when each of the applied migrations was applied, by version
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_on FROM partysvc.schema_version")
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve schema versions: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedOn time.Time
+		if err := rows.Scan(&version, &appliedOn); err != nil {
+			return nil, fmt.Errorf("can't retrieve schema versions: %w", err)
+		}
+		applied[version] = appliedOn
+	}
+	return applied, rows.Err()
+}
+
+// Runs the script and records the change in version within a single transaction
+func (m *Migrator) run(ctx context.Context, script, record string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies every migration which hasn't been applied yet, in version order, returning those it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.run(ctx, migration.Up, "INSERT INTO partysvc.schema_version (version, name, applied_on) VALUES ($1,$2,$3)",
+			migration.Version, migration.Name, time.Now())
+		if err != nil {
+			return done, fmt.Errorf("can't apply migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts the most recently applied migration, returning it, or ErrNothingToRevert, or ErrBaseline if it's one of
+// the baseline migrations
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return Migration{}, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	for idx := len(m.migrations) - 1; idx >= 0; idx-- {
+		migration := m.migrations[idx]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Version <= m.baseline {
+			return Migration{}, ErrBaseline
+		}
+		err := m.run(ctx, migration.Down, "DELETE FROM partysvc.schema_version WHERE version=$1", migration.Version)
+		if err != nil {
+			return Migration{}, fmt.Errorf("can't revert migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		return migration, nil
+	}
+
+	return Migration{}, ErrNothingToRevert
+}
+
+// Status returns whether each migration has been applied, in version order
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, migration := range m.migrations {
+		appliedOn, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedOn: appliedOn})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,47 @@
+-- The Python party service created these tables, so a database it used may already have them, in which case they're kept as they are
+CREATE TABLE IF NOT EXISTS partysvc.business (
+    party_uuid UUID PRIMARY KEY,
+    business_ref TEXT NOT NULL UNIQUE,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS partysvc.respondent (
+    id UUID PRIMARY KEY,
+    status TEXT NOT NULL CHECK (status IN ('CREATED', 'ACTIVE', 'SUSPENDED')),
+    email_address TEXT NOT NULL UNIQUE,
+    first_name TEXT NOT NULL,
+    last_name TEXT NOT NULL,
+    telephone TEXT NOT NULL,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS partysvc.business_respondent (
+    business_id UUID NOT NULL REFERENCES partysvc.business (party_uuid),
+    respondent_id UUID NOT NULL REFERENCES partysvc.respondent (id),
+    status TEXT NOT NULL CHECK (status IN ('ACTIVE', 'INACTIVE', 'SUSPENDED', 'ENDED')),
+    effective_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    effective_to TIMESTAMP WITH TIME ZONE,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (business_id, respondent_id)
+);
+
+CREATE TABLE IF NOT EXISTS partysvc.enrolment (
+    business_id UUID NOT NULL,
+    respondent_id UUID NOT NULL,
+    survey_id TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('PENDING', 'ENABLED', 'DISABLED', 'SUSPENDED')),
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (business_id, respondent_id, survey_id),
+    FOREIGN KEY (business_id, respondent_id) REFERENCES partysvc.business_respondent (business_id, respondent_id)
+);
+
+CREATE TABLE IF NOT EXISTS partysvc.pending_enrolment (
+    id SERIAL PRIMARY KEY,
+    case_id UUID NOT NULL,
+    respondent_id UUID NOT NULL REFERENCES partysvc.respondent (id),
+    business_id UUID NOT NULL REFERENCES partysvc.business (party_uuid),
+    survey_id TEXT NOT NULL,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS pending_enrolment_respondent_idx ON partysvc.pending_enrolment (respondent_id);
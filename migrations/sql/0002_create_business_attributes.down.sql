@@ -0,0 +1 @@
+-- Never run, as this is a baseline migration: its tables may hold the Python party service's data
@@ -0,0 +1,13 @@
+-- The Python party service created this table, so a database it used may already have it, in which case it's kept as it is
+CREATE TABLE IF NOT EXISTS partysvc.business_attributes (
+    id SERIAL PRIMARY KEY,
+    business_id UUID NOT NULL REFERENCES partysvc.business (party_uuid),
+    sample_summary_id TEXT,
+    collection_exercise TEXT,
+    name TEXT,
+    trading_as TEXT,
+    attributes JSONB,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS business_attributes_latest_idx ON partysvc.business_attributes (business_id, created_on DESC);
@@ -0,0 +1,12 @@
+CREATE TABLE partysvc.outbox (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    dispatched_on TIMESTAMP WITH TIME ZONE,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX outbox_due_idx ON partysvc.outbox (next_attempt_at) WHERE dispatched_on IS NULL;
@@ -0,0 +1 @@
+DROP TABLE partysvc.audit_log;
@@ -0,0 +1,12 @@
+CREATE TABLE partysvc.audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    respondent_id UUID NOT NULL,
+    business_ids UUID[] NOT NULL DEFAULT '{}',
+    before JSONB,
+    after JSONB,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_log_respondent_idx ON partysvc.audit_log (respondent_id, id);
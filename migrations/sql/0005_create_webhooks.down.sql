@@ -0,0 +1,2 @@
+DROP TABLE partysvc.webhook_delivery;
+DROP TABLE partysvc.webhook;
@@ -0,0 +1 @@
+DROP INDEX partysvc.business_attributes_sample_summary_idx;
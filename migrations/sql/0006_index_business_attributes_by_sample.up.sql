@@ -0,0 +1 @@
+CREATE INDEX business_attributes_sample_summary_idx ON partysvc.business_attributes (sample_summary_id);
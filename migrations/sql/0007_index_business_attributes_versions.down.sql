@@ -0,0 +1,2 @@
+DROP INDEX partysvc.business_attributes_collection_exercise_idx;
+DROP INDEX partysvc.business_attributes_sample_version_idx;
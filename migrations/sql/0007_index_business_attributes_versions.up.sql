@@ -0,0 +1,2 @@
+CREATE INDEX business_attributes_sample_version_idx ON partysvc.business_attributes (business_id, sample_summary_id, created_on DESC);
+CREATE INDEX business_attributes_collection_exercise_idx ON partysvc.business_attributes (business_id, collection_exercise);
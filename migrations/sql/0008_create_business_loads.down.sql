@@ -0,0 +1 @@
+DROP TABLE partysvc.business_load;
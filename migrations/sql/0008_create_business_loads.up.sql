@@ -0,0 +1,10 @@
+CREATE TABLE partysvc.business_load (
+    id UUID PRIMARY KEY,
+    sample_summary_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    total_rows INTEGER NOT NULL,
+    loaded_rows INTEGER NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    completed_on TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1 @@
+ALTER TABLE partysvc.business_load DROP COLUMN updated_on;
@@ -0,0 +1 @@
+ALTER TABLE partysvc.business_load ADD COLUMN updated_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
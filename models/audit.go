@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type (
+	// AuditEntry represents a change made to a respondent, who made it, and the respondent before and after it
+	AuditEntry struct {
+		ID           int64           `json:"id"`
+		Actor        string          `json:"actor"`
+		Action       string          `json:"action"`
+		RespondentID string          `json:"respondentId"`
+		BusinessIDs  []string        `json:"businessIds"`
+		Before       json.RawMessage `json:"before,omitempty"`
+		After        json.RawMessage `json:"after,omitempty"`
+		CreatedOn    time.Time       `json:"createdOn"`
+	}
+
+	// AuditEntries represents the response from 'GET /respondents/{id}/history'
+	AuditEntries struct {
+		Data []AuditEntry `json:"data"`
+	}
+)
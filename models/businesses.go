@@ -0,0 +1,154 @@
+package models
+
+import "time"
+
+type (
+	// BusinessAttributes represents the sample attributes of a single business
+	BusinessAttributes struct {
+		RURef       string `json:"ruRef"`
+		BirthDate   string `json:"birthDate"`
+		CheckLetter string `json:"checkLetter"`
+		Currency    string `json:"currency"`
+		EntName1    string `json:"entName1"`
+		EntName2    string `json:"entName2"`
+		EntName3    string `json:"entName3"`
+		EntRef      string `json:"entRef"`
+		EntRemkr    string `json:"entRemkr"`
+		FormType    string `json:"formType"`
+		FroEmpment  int    `json:"froEmpment"`
+		FroSic2007  string `json:"froSic2007"`
+		FroSic92    string `json:"froSic92"`
+		FroTover    int    `json:"froTover"`
+		InclExcl    string `json:"inclExcl"`
+		LegalStatus string `json:"legalStatus"`
+		Region      string `json:"region"`
+		RUName1     string `json:"ruName1"`
+		RUName2     string `json:"ruName2"`
+		RUName3     string `json:"ruName3"`
+		RUSic2007   string `json:"ruSic2007"`
+		RUSic92     string `json:"ruSic92"`
+		SelType     string `json:"selType"`
+		TradStyle1  string `json:"tradStyle1"`
+		CellNo      int    `json:"cellNo"`
+	}
+
+	// SampleAttributes represents the attributes of a single business in the format they're stored in the database,
+	// which is the format the sample service provides them in
+	SampleAttributes struct {
+		RURef       string `json:"ruref"`
+		BirthDate   string `json:"birthdate"`
+		CheckLetter string `json:"checkletter"`
+		Currency    string `json:"currency"`
+		EntName1    string `json:"entname1"`
+		EntName2    string `json:"entname2"`
+		EntName3    string `json:"entname3"`
+		EntRef      string `json:"entref"`
+		EntRemkr    string `json:"entremkr"`
+		FormType    string `json:"formtype"`
+		FroEmpment  int    `json:"froempment"`
+		FroSic2007  string `json:"frosic2007"`
+		FroSic92    string `json:"frosic92"`
+		FroTover    int    `json:"frotover"`
+		InclExcl    string `json:"inclexcl"`
+		LegalStatus string `json:"legalstatus"`
+		Region      string `json:"region"`
+		RUName1     string `json:"runame1"`
+		RUName2     string `json:"runame2"`
+		RUName3     string `json:"runame3"`
+		RUSic2007   string `json:"rusic2007"`
+		RUSic92     string `json:"rusic92"`
+		SelType     string `json:"seltype"`
+		TradStyle1  string `json:"tradstyle1"`
+		CellNo      int    `json:"cell_no"`
+	}
+
+	// Business represents a single business
+	Business struct {
+		Associations    []Association      `json:"associations"`
+		SampleUnitRef   string             `json:"sampleUnitRef"`
+		SampleSummaryID string             `json:"sampleSummaryId"`
+		ID              string             `json:"id"`
+		Name            string             `json:"name"`
+		TradingAs       string             `json:"tradingAs"`
+		Attributes      BusinessAttributes `json:"attributes"`
+	}
+
+	// BusinessAttributesVersion represents the attributes a business had in a sample, and the collection exercise the
+	// sample was linked to
+	BusinessAttributesVersion struct {
+		ID                   int64              `json:"id"`
+		SampleSummaryID      string             `json:"sampleSummaryId"`
+		CollectionExerciseID string             `json:"collectionExerciseId"`
+		Name                 string             `json:"name"`
+		TradingAs            string             `json:"tradingAs"`
+		Attributes           BusinessAttributes `json:"attributes"`
+		CreatedOn            time.Time          `json:"createdOn"`
+	}
+
+	// BusinessAttributesHistory represents the response from GET /businesses/{id}/history, oldest version first
+	BusinessAttributesHistory struct {
+		Data []BusinessAttributesVersion `json:"data"`
+	}
+
+	// Sample represents a business being in a sample, and the collection exercise the sample has been linked to
+	Sample struct {
+		SampleSummaryID      string `json:"sampleSummaryId"`
+		CollectionExerciseID string `json:"collectionExerciseId"`
+	}
+
+	// Businesses represents the response from all other /businesses endpoints. PATCH also returns the samples the
+	// business is in.
+	Businesses struct {
+		Data    []Business `json:"data"`
+		Samples []Sample   `json:"samples,omitempty"`
+	}
+
+	// BusinessSearch represents the response from GET /businesses, with the total number of matches across all pages
+	BusinessSearch struct {
+		Data  []Business `json:"data"`
+		Total int        `json:"total"`
+		Page  int        `json:"page"`
+		Limit int        `json:"limit"`
+	}
+
+	// PostBusinesses represents the expected format of a POST or PATCH /businesses Request-Body. PATCH may also list
+	// samples to add the business to.
+	PostBusinesses struct {
+		Data    Business `json:"data"`
+		Samples []Sample `json:"samples,omitempty"`
+	}
+
+	// PutSampleLink represents the expected format of a PUT /businesses/sample/link/{sampleSummaryId} Request-Body
+	PutSampleLink struct {
+		CollectionExerciseID string `json:"collectionExerciseId"`
+	}
+
+	// SampleLink represents the response from PUT /businesses/sample/link/{sampleSummaryId}, with the number of
+	// businesses in the sample
+	SampleLink struct {
+		SampleSummaryID      string `json:"sampleSummaryId"`
+		CollectionExerciseID string `json:"collectionExerciseId"`
+		Businesses           int    `json:"businesses"`
+	}
+
+	// ResolveBusinesses represents the expected format of a POST /businesses/resolve Request-Body
+	ResolveBusinesses struct {
+		RURefs []string `json:"ruRefs"`
+	}
+
+	// ResolvedBusiness represents the business found for an RU reference
+	ResolvedBusiness struct {
+		RURef      string             `json:"ruRef"`
+		ID         string             `json:"id"`
+		Name       string             `json:"name"`
+		TradingAs  string             `json:"tradingAs"`
+		Attributes BusinessAttributes `json:"attributes"`
+	}
+
+	// ResolvedBusinesses represents the response from POST /businesses/resolve, with the references no business was
+	// found for
+	ResolvedBusinesses struct {
+		Data     []ResolvedBusiness `json:"data"`
+		NotFound []string           `json:"notFound"`
+	}
+)
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type (
+	// BusinessLoadError represents a row of a sample file which couldn't be loaded. Rows are numbered from 1, not
+	// counting a CSV file's header.
+	BusinessLoadError struct {
+		Row   int    `json:"row"`
+		RURef string `json:"ruRef,omitempty"`
+		Error string `json:"error"`
+	}
+
+	// BusinessLoad represents a job loading the businesses in a sample file, and how far it's got
+	BusinessLoad struct {
+		ID              string              `json:"id"`
+		SampleSummaryID string              `json:"sampleSummaryId"`
+		Status          string              `json:"status"`
+		Rows            int                 `json:"rows"`
+		Loaded          int                 `json:"loaded"`
+		Errors          []BusinessLoadError `json:"errors"`
+		CreatedOn       time.Time           `json:"createdOn"`
+		CompletedOn     *time.Time          `json:"completedOn,omitempty"`
+	}
+
+	// BusinessLoads represents the response from the /business-loads endpoints
+	BusinessLoads struct {
+		Data []BusinessLoad `json:"data"`
+	}
+)
@@ -0,0 +1,16 @@
+package models
+
+type (
+	// ComponentHealth represents the health of something the service depends on
+	ComponentHealth struct {
+		Status    string  `json:"status"`
+		LatencyMs float64 `json:"latencyMs"`
+		Error     string  `json:"error,omitempty"`
+	}
+
+	// Health represents the response from 'GET /health/live' and 'GET /health/ready'
+	Health struct {
+		Status     string                     `json:"status"`
+		Components map[string]ComponentHealth `json:"components,omitempty"`
+	}
+)
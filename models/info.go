@@ -1,9 +1,39 @@
 package models
 
+// Build information, set by the Makefile through the linker's -X flag. They're empty for builds made any other way.
+var (
+	branch  string
+	built   string
+	commit  string
+	origin  string
+	version string
+)
+
 type (
 	// Info represents the response from 'GET /info'
 	Info struct {
-		Name    string `json:"name"`
-		Version string `json:"version"`
+		Name          string `json:"name"`
+		Version       string `json:"version"`
+		Branch        string `json:"branch,omitempty"`
+		Built         string `json:"built,omitempty"`
+		Commit        string `json:"commit,omitempty"`
+		Origin        string `json:"origin,omitempty"`
+		GoVersion     string `json:"goVersion"`
+		Uptime        string `json:"uptime"`
+		SchemaVersion *int   `json:"schemaVersion,omitempty"`
+	}
+
+	// BuildInfo represents how and from where the running binary was built
+	BuildInfo struct {
+		Branch  string
+		Built   string
+		Commit  string
+		Origin  string
+		Version string
 	}
 )
+
+// GetBuildInfo returns the build information linked into the running binary
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{Branch: branch, Built: built, Commit: commit, Origin: origin, Version: version}
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type (
+	// OutboxEntry represents a message recorded alongside a change to the party data, to be sent on once the change
+	// has been committed
+	OutboxEntry struct {
+		ID          int64           `json:"id"`
+		Kind        string          `json:"kind"`
+		Payload     json.RawMessage `json:"payload"`
+		Attempts    int             `json:"attempts"`
+		LastError   string          `json:"lastError,omitempty"`
+		NextAttempt time.Time       `json:"nextAttempt"`
+		CreatedOn   time.Time       `json:"createdOn"`
+	}
+
+	// OutboxEntries represents the response from 'GET /outbox/stuck'
+	OutboxEntries struct {
+		Data []OutboxEntry `json:"data"`
+	}
+)
@@ -0,0 +1,85 @@
+package models
+
+// The legacy v1 /parties representations, as served by the Python party service. Their fields are declared in
+// alphabetical order of their JSON names, as the Python service sorted keys.
+type (
+	// LegacyBusinessAttributes represents the sample attributes of a business in a v1 response. The form type is
+	// given under both of the names it's had. Attributes which aren't stored are left out, as the Python service only
+	// wrote the ones it had; the numeric ones are pointers so that a stored 0 is still written.
+	LegacyBusinessAttributes struct {
+		BirthDate   string `json:"birthdate,omitempty"`
+		CellNo      *int   `json:"cell_no,omitempty"`
+		CheckLetter string `json:"checkletter,omitempty"`
+		Currency    string `json:"currency,omitempty"`
+		EntName1    string `json:"entname1,omitempty"`
+		EntName2    string `json:"entname2,omitempty"`
+		EntName3    string `json:"entname3,omitempty"`
+		EntRef      string `json:"entref,omitempty"`
+		EntRemkr    string `json:"entremkr,omitempty"`
+		FormTypeV1  string `json:"formType,omitempty"`
+		FormType    string `json:"formtype,omitempty"`
+		FroEmpment  *int   `json:"froempment,omitempty"`
+		FroSic2007  string `json:"frosic2007,omitempty"`
+		FroSic92    string `json:"frosic92,omitempty"`
+		FroTover    *int   `json:"frotover,omitempty"`
+		InclExcl    string `json:"inclexcl,omitempty"`
+		LegalStatus string `json:"legalstatus,omitempty"`
+		Region      string `json:"region,omitempty"`
+		RUName1     string `json:"runame1,omitempty"`
+		RUName2     string `json:"runame2,omitempty"`
+		RUName3     string `json:"runame3,omitempty"`
+		RURef       string `json:"ruref,omitempty"`
+		RUSic2007   string `json:"rusic2007,omitempty"`
+		RUSic92     string `json:"rusic92,omitempty"`
+		SelType     string `json:"seltype,omitempty"`
+		TradStyle1  string `json:"tradstyle1,omitempty"`
+	}
+
+	// LegacyAssociation represents a party associated with another in a v1 response: a respondent of a business, or
+	// a business of a respondent
+	LegacyAssociation struct {
+		Enrolments     []Enrolment `json:"enrolments"`
+		ID             string      `json:"id"`
+		Name           string      `json:"name"`
+		SampleUnitRef  string      `json:"sampleUnitRef"`
+		SampleUnitType string      `json:"sampleUnitType"`
+	}
+
+	// LegacyBusiness represents the response from the v1 business party endpoints
+	LegacyBusiness struct {
+		Associations    []LegacyAssociation      `json:"associations"`
+		Attributes      LegacyBusinessAttributes `json:"attributes"`
+		ID              string                   `json:"id"`
+		Name            string                   `json:"name"`
+		SampleSummaryID string                   `json:"sampleSummaryId"`
+		SampleUnitRef   string                   `json:"sampleUnitRef"`
+		SampleUnitType  string                   `json:"sampleUnitType"`
+		TradingAs       string                   `json:"trading_as"`
+	}
+
+	// LegacyRespondentAttributes represents the attributes of a respondent in a v1 response
+	LegacyRespondentAttributes struct {
+		EmailAddress string `json:"emailAddress"`
+		FirstName    string `json:"firstName"`
+		ID           string `json:"id"`
+		LastName     string `json:"lastName"`
+		Telephone    string `json:"telephone"`
+	}
+
+	// LegacyRespondent represents the response from the v1 respondent party endpoints
+	LegacyRespondent struct {
+		Associations   []LegacyAssociation        `json:"associations"`
+		Attributes     LegacyRespondentAttributes `json:"attributes"`
+		SampleUnitType string                     `json:"sampleUnitType"`
+		Status         string                     `json:"status"`
+	}
+
+	// PostParties represents the expected format of a POST /parties Request-Body. Attributes are optional, so that
+	// a business can be added to a sample without changing them.
+	PostParties struct {
+		SampleUnitRef   string                    `json:"sampleUnitRef"`
+		SampleUnitType  string                    `json:"sampleUnitType"`
+		SampleSummaryID string                    `json:"sampleSummaryId"`
+		Attributes      *LegacyBusinessAttributes `json:"attributes"`
+	}
+)
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type (
+	// Webhook represents a callback URL which is sent the events of the types it's subscribed to, signed with its
+	// secret. The secret is only ever provided when the webhook is registered, and never returned.
+	Webhook struct {
+		ID         string    `json:"id"`
+		URL        string    `json:"url"`
+		EventTypes []string  `json:"eventTypes"`
+		Secret     string    `json:"secret,omitempty"`
+		CreatedOn  time.Time `json:"createdOn"`
+	}
+
+	// Webhooks represents the response from 'GET /webhooks'
+	Webhooks struct {
+		Data []Webhook `json:"data"`
+	}
+
+	// PostWebhooks represents the expected format of a POST /webhooks Request-Body
+	PostWebhooks struct {
+		Data Webhook `json:"data"`
+	}
+
+	// WebhookDelivery represents an attempt to deliver an event to a webhook
+	WebhookDelivery struct {
+		ID         int64     `json:"id"`
+		WebhookID  string    `json:"webhookId"`
+		EventID    string    `json:"eventId"`
+		EventType  string    `json:"eventType"`
+		Attempt    int       `json:"attempt"`
+		StatusCode int       `json:"statusCode,omitempty"`
+		Error      string    `json:"error,omitempty"`
+		Succeeded  bool      `json:"succeeded"`
+		CreatedOn  time.Time `json:"createdOn"`
+	}
+
+	// WebhookDeliveries represents the response from 'GET /webhooks/{id}/deliveries'
+	WebhookDeliveries struct {
+		Data []WebhookDelivery `json:"data"`
+	}
+)
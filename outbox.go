@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ONSdigital/ras-rm-party/clients"
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/outbox"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/ONSdigital/ras-rm-party/webhooks"
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Returns a dispatcher for the outbox, handling every kind of entry the service records. Events are published with
+// the publisher provided, or dropped if it's nil, and delivered to the webhooks in the webhook store.
+func newOutboxDispatcher(outboxStore store.OutboxStore, webhookStore store.WebhookStore, publisher events.Publisher) *outbox.Dispatcher {
+	dispatcher := outbox.NewDispatcher(outboxStore, outbox.Config{
+		Interval:   viper.GetDuration("outbox_interval"),
+		BatchSize:  viper.GetInt("outbox_batch_size"),
+		Lease:      viper.GetDuration("outbox_lease"),
+		MinBackoff: viper.GetDuration("outbox_min_backoff"),
+		MaxBackoff: viper.GetDuration("outbox_max_backoff"),
+	})
+	dispatcher.Handle(store.OutboxDeactivateIAC, deactivateEnrolmentCode)
+	dispatcher.Handle(store.OutboxPublishEvent, publishEvent(publisher))
+	dispatcher.Handle(store.OutboxNotifyWebhooks, notifyWebhooks(webhookStore))
+
+	sender := webhooks.NewSender(clients.NewHTTPClient(clients.Config{
+		Timeout:             viper.GetDuration("webhook_timeout"),
+		MaxIdleConnsPerHost: 2,
+		PublicOnly:          !viper.GetBool("webhook_allow_private_hosts"),
+	}))
+	dispatcher.Handle(store.OutboxDeliverWebhook, deliverWebhook(webhookStore, sender, viper.GetInt("webhook_max_attempts")))
+	return dispatcher
+}
+
+// Returns the publisher for event_publisher: "pubsub" to publish to the pubsub_topic in pubsub_project_id, or "none"
+// to drop events, in which case the publisher is nil
+func newPublisher(ctx context.Context) (events.Publisher, error) {
+	switch mode := viper.GetString("event_publisher"); mode {
+	case "none":
+		return nil, nil
+	case "pubsub":
+		return events.NewPubSub(ctx, viper.GetString("pubsub_project_id"), viper.GetString("pubsub_topic"))
+	default:
+		return nil, errors.New("unknown event publisher " + mode)
+	}
+}
+
+// Returns the outbox handler which publishes the event recorded in an entry
+func publishEvent(publisher events.Publisher) outbox.Handler {
+	return func(ctx context.Context, entry models.OutboxEntry) error {
+		var event events.Event
+		if err := json.Unmarshal(entry.Payload, &event); err != nil {
+			return err
+		}
+		if publisher == nil {
+			logging.FromContext(ctx).Debug("Dropped event as there's no publisher", zap.String("event_id", event.ID), zap.String("event_type", event.Type))
+			return nil
+		}
+		return publisher.Publish(ctx, event)
+	}
+}
+
+func getStuckOutboxEntries(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	outboxStore := getOutboxStore()
+	if outboxStore == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	minAttempts := viper.GetInt("outbox_stuck_attempts")
+	if r.URL.Query().Get("minAttempts") != "" {
+		var err error
+		minAttempts, err = strconv.Atoi(r.URL.Query().Get("minAttempts"))
+		if err != nil || minAttempts < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			errorString := models.Error{
+				Error: "Invalid minAttempts: " + r.URL.Query().Get("minAttempts"),
+			}
+			json.NewEncoder(w).Encode(errorString)
+			return
+		}
+	}
+
+	entries, err := outboxStore.StuckOutboxEntries(r.Context(), minAttempts)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.OutboxEntries{Data: entries})
+}
@@ -0,0 +1,178 @@
+// Package outbox dispatches the messages recorded in the store's outbox, retrying with backoff until each one has
+// been handled.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"go.uber.org/zap"
+)
+
+// Handler sends on an outbox entry. Returning an error means the entry will be tried again later, unless it's
+// Permanent.
+type Handler func(ctx context.Context, entry models.OutboxEntry) error
+
+// An error which retrying the entry won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error returned by a handler as one which retrying won't fix, e.g. because the entry's payload
+// can't be decoded, so that the entry is dropped rather than retried
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Config configures how often and how hard a Dispatcher tries to dispatch entries
+type Config struct {
+	// Interval is how long to wait between checking for due entries
+	Interval time.Duration
+	// BatchSize is the most entries to claim at a time
+	BatchSize int
+	// Lease is how long a claimed entry is left for before it can be claimed again, e.g. if the dispatcher crashed
+	Lease time.Duration
+	// MinBackoff is how long to wait before retrying an entry the first time it fails
+	MinBackoff time.Duration
+	// MaxBackoff is the longest to wait before retrying an entry, however many times it's failed
+	MaxBackoff time.Duration
+}
+
+// Dispatcher claims due entries from the outbox and passes them to the handler for their kind
+type Dispatcher struct {
+	store    store.OutboxStore
+	config   Config
+	handlers map[string]Handler
+}
+
+// NewDispatcher returns a dispatcher for the outbox in the store provided, with no handlers
+func NewDispatcher(outbox store.OutboxStore, config Config) *Dispatcher {
+	if config.BatchSize < 1 {
+		config.BatchSize = 1
+	}
+	return &Dispatcher{store: outbox, config: config, handlers: map[string]Handler{}}
+}
+
+// Handle sets the handler for entries of the kind provided. It must be called before the dispatcher is run.
+func (d *Dispatcher) Handle(kind string, handler Handler) {
+	d.handlers[kind] = handler
+}
+
+// Backoff returns how long to wait before the next attempt at an entry which has failed the number of times provided.
+// It doubles with each failure, from min up to max.
+func Backoff(failures int, min, max time.Duration) time.Duration {
+	backoff := min
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= max {
+			return max
+		}
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// Run dispatches due entries every interval until the context is cancelled. Cancelling it stops any more entries
+// being claimed, but the batch being dispatched is finished first, so that Run only returns once its work is recorded.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.dispatchDue(context.Background(), ctx.Done()); err != nil {
+			logging.Logger().Error("Error dispatching outbox entries", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// The ticker may have fired as the context was cancelled
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// DispatchDue claims and dispatches the entries which are currently due, a batch at a time, and returns how many
+// were dispatched successfully
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	return d.dispatchDue(ctx, nil)
+}
+
+// Dispatches due entries as DispatchDue does, but stops after the current batch once stop is closed
+func (d *Dispatcher) dispatchDue(ctx context.Context, stop <-chan struct{}) (int, error) {
+	dispatched := 0
+	for {
+		entries, err := d.store.ClaimOutboxEntries(ctx, d.config.BatchSize, d.config.Lease)
+		if err != nil {
+			return dispatched, err
+		}
+
+		for _, entry := range entries {
+			ok, err := d.dispatch(ctx, entry)
+			if err != nil {
+				// Leave the entry to be claimed again once its lease has passed
+				return dispatched, err
+			}
+			if ok {
+				dispatched++
+			}
+		}
+
+		if len(entries) < d.config.BatchSize {
+			return dispatched, nil
+		}
+		select {
+		case <-stop:
+			return dispatched, nil
+		default:
+		}
+	}
+}
+
+// Passes the entry to its handler, then records the outcome, returning whether it was handled. The error returned is
+// only for failing to record the outcome.
+func (d *Dispatcher) dispatch(ctx context.Context, entry models.OutboxEntry) (bool, error) {
+	var err error
+	handler, ok := d.handlers[entry.Kind]
+	if !ok {
+		err = errors.New("no handler for outbox entries of kind " + entry.Kind)
+	} else {
+		err = handler(ctx, entry)
+	}
+
+	if err == nil {
+		return true, d.store.CompleteOutboxEntry(ctx, entry.ID)
+	}
+	if ctx.Err() != nil {
+		// Shutting down, so don't count the attempt against the entry
+		return false, ctx.Err()
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		logging.Logger().Error("Dropped outbox entry which can't be dispatched", zap.Int64("id", entry.ID), zap.String("kind", entry.Kind),
+			zap.Error(err))
+		return false, d.store.CompleteOutboxEntry(ctx, entry.ID)
+	}
+
+	failures := entry.Attempts + 1
+	logging.Logger().Warn("Error dispatching outbox entry", zap.Int64("id", entry.ID), zap.String("kind", entry.Kind),
+		zap.Int("attempt", failures), zap.Error(err))
+	return false, d.store.RetryOutboxEntry(ctx, entry.ID, err.Error(), time.Now().Add(Backoff(failures, d.config.MinBackoff, d.config.MaxBackoff)))
+}
@@ -0,0 +1,176 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+var config = Config{Interval: 10 * time.Millisecond, BatchSize: 2, Lease: time.Minute, MinBackoff: time.Second, MaxBackoff: time.Minute}
+
+// An outbox which hands out its entries in order, and records what happens to them
+type fakeOutbox struct {
+	entries   []models.OutboxEntry
+	completed []int64
+	retried   map[int64]string
+	next      map[int64]time.Time
+}
+
+func newFakeOutbox(kinds ...string) *fakeOutbox {
+	outbox := &fakeOutbox{retried: map[int64]string{}, next: map[int64]time.Time{}}
+	for idx, kind := range kinds {
+		outbox.entries = append(outbox.entries, models.OutboxEntry{ID: int64(idx + 1), Kind: kind})
+	}
+	return outbox
+}
+
+func (f *fakeOutbox) ClaimOutboxEntries(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error) {
+	if limit > len(f.entries) {
+		limit = len(f.entries)
+	}
+	claimed := f.entries[:limit]
+	f.entries = f.entries[limit:]
+	return claimed, nil
+}
+
+func (f *fakeOutbox) CompleteOutboxEntry(ctx context.Context, id int64) error {
+	f.completed = append(f.completed, id)
+	return nil
+}
+
+func (f *fakeOutbox) RetryOutboxEntry(ctx context.Context, id int64, lastError string, nextAttempt time.Time) error {
+	f.retried[id] = lastError
+	f.next[id] = nextAttempt
+	return nil
+}
+
+func (f *fakeOutbox) StuckOutboxEntries(ctx context.Context, minAttempts int) ([]models.OutboxEntry, error) {
+	return nil, nil
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, Backoff(1, time.Second, time.Minute))
+	assert.Equal(t, 2*time.Second, Backoff(2, time.Second, time.Minute))
+	assert.Equal(t, 32*time.Second, Backoff(6, time.Second, time.Minute))
+	assert.Equal(t, time.Minute, Backoff(7, time.Second, time.Minute))
+	assert.Equal(t, time.Minute, Backoff(1000, time.Second, time.Minute))
+}
+
+func TestDispatchDueCompletesHandledEntries(t *testing.T) {
+	outbox := newFakeOutbox("a", "a", "a")
+	handled := []int64{}
+	dispatcher := NewDispatcher(outbox, config)
+	dispatcher.Handle("a", func(ctx context.Context, entry models.OutboxEntry) error {
+		handled = append(handled, entry.ID)
+		return nil
+	})
+
+	dispatched, err := dispatcher.DispatchDue(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, dispatched)
+	assert.Equal(t, []int64{1, 2, 3}, handled)
+	assert.Equal(t, []int64{1, 2, 3}, outbox.completed)
+}
+
+func TestDispatchDueRetriesFailedEntriesWithBackoff(t *testing.T) {
+	outbox := newFakeOutbox("a", "b")
+	outbox.entries[0].Attempts = 3
+	dispatcher := NewDispatcher(outbox, config)
+	dispatcher.Handle("a", func(ctx context.Context, entry models.OutboxEntry) error {
+		return errors.New("IAC service unavailable")
+	})
+
+	start := time.Now()
+	dispatched, err := dispatcher.DispatchDue(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, dispatched)
+	assert.Empty(t, outbox.completed)
+	assert.Equal(t, "IAC service unavailable", outbox.retried[1])
+	assert.Equal(t, "no handler for outbox entries of kind b", outbox.retried[2])
+	// The fourth failure waits for 8 times the minimum backoff
+	assert.WithinDuration(t, start.Add(8*time.Second), outbox.next[1], time.Second)
+	assert.WithinDuration(t, start.Add(time.Second), outbox.next[2], time.Second)
+}
+
+func TestDispatchDueDropsEntriesWhichFailPermanently(t *testing.T) {
+	outbox := newFakeOutbox("a")
+	dispatcher := NewDispatcher(outbox, config)
+	dispatcher.Handle("a", func(ctx context.Context, entry models.OutboxEntry) error {
+		return Permanent(errors.New("invalid payload"))
+	})
+
+	dispatched, err := dispatcher.DispatchDue(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, dispatched)
+	assert.Equal(t, []int64{1}, outbox.completed)
+	assert.Empty(t, outbox.retried)
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	outbox := newFakeOutbox("a")
+	dispatcher := NewDispatcher(outbox, config)
+	dispatcher.Handle("a", func(ctx context.Context, entry models.OutboxEntry) error {
+		return nil
+	})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.Run(runCtx)
+		close(stopped)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatcher didn't stop when its context was cancelled")
+	}
+	assert.Equal(t, []int64{1}, outbox.completed)
+}
+
+func TestRunFinishesBatchWhenCancelled(t *testing.T) {
+	outbox := newFakeOutbox("a", "a", "a")
+	dispatcher := NewDispatcher(outbox, config)
+	started, release := make(chan struct{}), make(chan struct{})
+	dispatcher.Handle("a", func(ctx context.Context, entry models.OutboxEntry) error {
+		if entry.ID == 1 {
+			close(started)
+			<-release
+		}
+		return ctx.Err()
+	})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.Run(runCtx)
+		close(stopped)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("Dispatcher stopped before finishing its batch")
+	case <-time.After(30 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatcher didn't stop when its context was cancelled")
+	}
+	assert.Equal(t, []int64{1, 2}, outbox.completed)
+	assert.Equal(t, 1, len(outbox.entries))
+}
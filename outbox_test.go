@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStuckOutboxEntries(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+	memory.CreateBusiness(context.Background(), models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001"})
+	memory.CreateRespondent(context.Background(), postReq.Data.Attributes, []store.NewEnrolment{{
+		Code:       "abc1234",
+		CaseID:     "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+		SurveyID:   "0752a892-1a60-40a4-8aa3-2599405a8831",
+	}})
+	// The business's events are the first two entries, then the enrolment code's deactivation
+	for attempt := 0; attempt < 5; attempt++ {
+		memory.RetryOutboxEntry(context.Background(), 3, "Couldn't communicate with IAC service: Received status code 503", time.Now())
+	}
+
+	req := httptest.NewRequest("GET", "/v2/outbox/stuck", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.OutboxEntries
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /outbox/stuck', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, len(response.Data))
+	assert.Equal(t, store.OutboxDeactivateIAC, response.Data[0].Kind)
+	assert.Equal(t, 5, response.Data[0].Attempts)
+	assert.Equal(t, "Couldn't communicate with IAC service: Received status code 503", response.Data[0].LastError)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/outbox/stuck?minAttempts=6", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /outbox/stuck', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, response.Data)
+}
+
+func TestGetStuckOutboxEntriesReturns400IfMinAttemptsInvalid(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/outbox/stuck?minAttempts=lots", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /outbox/stuck', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Invalid minAttempts: lots", errResp.Error)
+}
+
+func TestDeactivateEnrolmentCodeFailsUntilIACServiceConfirms(t *testing.T) {
+	setup()
+	services := useFakeServices(t)
+	entry := models.OutboxEntry{ID: 1, Kind: store.OutboxDeactivateIAC, Payload: json.RawMessage(`{"iac":"abc1234"}`)}
+
+	services.AddIAC(models.IAC{IAC: "abc1234", Active: true})
+	services.Fail("/iacs/abc1234", http.StatusServiceUnavailable)
+	err := deactivateEnrolmentCode(context.Background(), entry)
+	assert.Equal(t, "Couldn't communicate with IAC service: Received status code 503", err.Error())
+
+	// A fresh IAC service which is working again
+	services = useFakeServices(t)
+	services.AddIAC(models.IAC{IAC: "abc1234", Active: true})
+	err = deactivateEnrolmentCode(context.Background(), entry)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"abc1234"}, services.Deactivated())
+}
+
+func TestDeactivateEnrolmentCodeSucceedsIfCodeIsGone(t *testing.T) {
+	setup()
+	useFakeServices(t)
+	entry := models.OutboxEntry{ID: 1, Kind: store.OutboxDeactivateIAC, Payload: json.RawMessage(`{"iac":"abc1234"}`)}
+
+	err := deactivateEnrolmentCode(context.Background(), entry)
+
+	assert.Nil(t, err)
+}
+
+func TestDeactivateEnrolmentCodeDropsInvalidPayloads(t *testing.T) {
+	setup()
+	useFakeServices(t)
+	outboxStore := &singleEntryOutbox{entry: models.OutboxEntry{ID: 1, Kind: store.OutboxDeactivateIAC, Payload: json.RawMessage(`"abc1234"`)}}
+
+	dispatched, err := newOutboxDispatcher(outboxStore, nil, nil).DispatchDue(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, dispatched)
+	assert.True(t, outboxStore.completed)
+	assert.False(t, outboxStore.retried)
+}
+
+// An outbox holding one entry, which records whether it was completed or retried
+type singleEntryOutbox struct {
+	entry     models.OutboxEntry
+	claimed   bool
+	completed bool
+	retried   bool
+}
+
+func (s *singleEntryOutbox) ClaimOutboxEntries(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error) {
+	if s.claimed {
+		return nil, nil
+	}
+	s.claimed = true
+	return []models.OutboxEntry{s.entry}, nil
+}
+
+func (s *singleEntryOutbox) CompleteOutboxEntry(ctx context.Context, id int64) error {
+	s.completed = true
+	return nil
+}
+
+func (s *singleEntryOutbox) RetryOutboxEntry(ctx context.Context, id int64, lastError string, nextAttempt time.Time) error {
+	s.retried = true
+	return nil
+}
+
+func (s *singleEntryOutbox) StuckOutboxEntries(ctx context.Context, minAttempts int) ([]models.OutboxEntry, error) {
+	return nil, nil
+}
+
+func TestPatchRespondentsPublishesEventsOnceDispatched(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+	memory.CreateRespondent(context.Background(), postReq.Data.Attributes, nil)
+	publisher := events.NewMemory()
+	dispatcher := newOutboxDispatcher(memory, memory, publisher)
+	dispatcher.DispatchDue(context.Background())
+
+	jsonOut, err := json.Marshal(models.PostRespondents{Data: models.Respondent{Attributes: models.Attributes{EmailAddress: "robert@boblaw.com"}}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
+	}
+	req := httptest.NewRequest("PATCH", "/v2/respondents/"+postReq.Data.Attributes.ID, bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Nothing is published until the outbox is dispatched
+	assert.Equal(t, 1, len(publisher.Events()))
+
+	// The event is both published and passed on to the webhooks
+	dispatched, err := dispatcher.DispatchDue(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dispatched)
+	published := publisher.Events()
+	assert.Equal(t, 2, len(published))
+	assert.Equal(t, events.RespondentCreated, published[0].Type)
+	assert.Equal(t, events.RespondentEmailChanged, published[1].Type)
+	assert.Equal(t, events.RespondentEmailChangedVersion, published[1].Version)
+	assert.JSONEq(t, `{"respondentId":"`+postReq.Data.Attributes.ID+`","previousEmailAddress":"`+postReq.Data.Attributes.EmailAddress+
+		`","emailAddress":"robert@boblaw.com"}`, string(published[1].Data))
+}
+
+func TestPublishEventDropsEventsWithoutPublisher(t *testing.T) {
+	event, _ := events.New(events.RespondentCreated, events.RespondentCreatedVersion, events.RespondentCreatedData{})
+	payload, _ := json.Marshal(event)
+
+	err := publishEvent(nil)(context.Background(), models.OutboxEntry{ID: 1, Kind: store.OutboxPublishEvent, Payload: payload})
+
+	assert.Nil(t, err)
+}
+
+func TestNewPublisher(t *testing.T) {
+	setDefaults()
+	defer viper.Set("event_publisher", "none")
+
+	publisher, err := newPublisher(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, publisher)
+
+	viper.Set("event_publisher", "kafka")
+	_, err = newPublisher(context.Background())
+	assert.Equal(t, "unknown event publisher kafka", err.Error())
+}
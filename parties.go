@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The sample unit types of the legacy v1 /parties endpoints
+const (
+	businessUnitType   = "B"
+	respondentUnitType = "BI"
+)
+
+// Selects the enrolments to include in a v1 response, from its survey_id and enrolment_status query parameters. With
+// no survey, either every association and enrolment is included or none are, depending on the endpoint.
+type enrolmentFilter struct {
+	surveyID string
+	statuses []string
+	// Whether every association is included when there's no survey
+	all bool
+}
+
+// Returns the filter for the query, or an error message if the survey ID isn't valid. With no survey, every
+// association is included if all is true, and none are if it's false, as the spec for the endpoints fetching parties
+// by ID has it.
+func parseEnrolmentFilter(query url.Values, all bool) (enrolmentFilter, string) {
+	filter := enrolmentFilter{surveyID: query.Get("survey_id"), statuses: query["enrolment_status"]}
+	if filter.surveyID == "" {
+		return enrolmentFilter{all: all}, ""
+	}
+	if _, err := uuid.Parse(filter.surveyID); err != nil {
+		return enrolmentFilter{}, "Invalid value for survey_id: " + filter.surveyID
+	}
+	return filter, ""
+}
+
+// Returns the enrolments which pass the filter, and whether an association with them should be included at all
+func (f enrolmentFilter) apply(enrolments []models.Enrolment) ([]models.Enrolment, bool) {
+	if f.surveyID == "" {
+		return append([]models.Enrolment{}, enrolments...), f.all
+	}
+	filtered := []models.Enrolment{}
+	for _, enrolment := range enrolments {
+		if enrolment.SurveyID == f.surveyID && (len(f.statuses) == 0 || contains(f.statuses, enrolment.EnrolmentStatus)) {
+			filtered = append(filtered, enrolment)
+		}
+	}
+	return filtered, len(filtered) > 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func intPointer(value int) *int {
+	return &value
+}
+
+// Returns the value pointed to, or 0 for an attribute which wasn't given
+func intValue(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// The numeric attributes are always stored, so are always written, even when they're 0
+func toLegacyBusinessAttributes(attributes models.BusinessAttributes) models.LegacyBusinessAttributes {
+	return models.LegacyBusinessAttributes{
+		BirthDate:   attributes.BirthDate,
+		CellNo:      intPointer(attributes.CellNo),
+		CheckLetter: attributes.CheckLetter,
+		Currency:    attributes.Currency,
+		EntName1:    attributes.EntName1,
+		EntName2:    attributes.EntName2,
+		EntName3:    attributes.EntName3,
+		EntRef:      attributes.EntRef,
+		EntRemkr:    attributes.EntRemkr,
+		FormTypeV1:  attributes.FormType,
+		FormType:    attributes.FormType,
+		FroEmpment:  intPointer(attributes.FroEmpment),
+		FroSic2007:  attributes.FroSic2007,
+		FroSic92:    attributes.FroSic92,
+		FroTover:    intPointer(attributes.FroTover),
+		InclExcl:    attributes.InclExcl,
+		LegalStatus: attributes.LegalStatus,
+		Region:      attributes.Region,
+		RUName1:     attributes.RUName1,
+		RUName2:     attributes.RUName2,
+		RUName3:     attributes.RUName3,
+		RURef:       attributes.RURef,
+		RUSic2007:   attributes.RUSic2007,
+		RUSic92:     attributes.RUSic92,
+		SelType:     attributes.SelType,
+		TradStyle1:  attributes.TradStyle1,
+	}
+}
+
+func fromLegacyBusinessAttributes(attributes models.LegacyBusinessAttributes) models.BusinessAttributes {
+	formType := attributes.FormType
+	if formType == "" {
+		formType = attributes.FormTypeV1
+	}
+	return models.BusinessAttributes{
+		RURef:       attributes.RURef,
+		BirthDate:   attributes.BirthDate,
+		CheckLetter: attributes.CheckLetter,
+		Currency:    attributes.Currency,
+		EntName1:    attributes.EntName1,
+		EntName2:    attributes.EntName2,
+		EntName3:    attributes.EntName3,
+		EntRef:      attributes.EntRef,
+		EntRemkr:    attributes.EntRemkr,
+		FormType:    formType,
+		FroEmpment:  intValue(attributes.FroEmpment),
+		FroSic2007:  attributes.FroSic2007,
+		FroSic92:    attributes.FroSic92,
+		FroTover:    intValue(attributes.FroTover),
+		InclExcl:    attributes.InclExcl,
+		LegalStatus: attributes.LegalStatus,
+		Region:      attributes.Region,
+		RUName1:     attributes.RUName1,
+		RUName2:     attributes.RUName2,
+		RUName3:     attributes.RUName3,
+		RUSic2007:   attributes.RUSic2007,
+		RUSic92:     attributes.RUSic92,
+		SelType:     attributes.SelType,
+		TradStyle1:  attributes.TradStyle1,
+		CellNo:      intValue(attributes.CellNo),
+	}
+}
+
+// Returns the business as the v1 endpoints represent it, with the respondent associations which pass the filter. As
+// with the respondent endpoints, a respondent's sample unit reference is their party ID.
+func toLegacyBusiness(business models.Business, filter enrolmentFilter) models.LegacyBusiness {
+	legacy := models.LegacyBusiness{
+		Associations:    []models.LegacyAssociation{},
+		Attributes:      toLegacyBusinessAttributes(business.Attributes),
+		ID:              business.ID,
+		Name:            business.Name,
+		SampleSummaryID: business.SampleSummaryID,
+		SampleUnitRef:   business.SampleUnitRef,
+		SampleUnitType:  businessUnitType,
+		TradingAs:       business.TradingAs,
+	}
+	for _, association := range business.Associations {
+		enrolments, ok := filter.apply(association.Enrolments)
+		if !ok {
+			continue
+		}
+		legacy.Associations = append(legacy.Associations, models.LegacyAssociation{
+			Enrolments:     enrolments,
+			ID:             association.ID,
+			Name:           association.Name,
+			SampleUnitRef:  association.ID,
+			SampleUnitType: respondentUnitType,
+		})
+	}
+	return legacy
+}
+
+// Returns the respondent as the v1 endpoints represent it, with the business associations which pass the filter.
+// Respondents' associations don't carry their businesses' names and references, so those are looked up.
+func toLegacyRespondent(ctx context.Context, respondent models.Respondent, businesses store.BusinessStore, filter enrolmentFilter) (models.LegacyRespondent, error) {
+	legacy := models.LegacyRespondent{
+		Associations: []models.LegacyAssociation{},
+		Attributes: models.LegacyRespondentAttributes{
+			EmailAddress: respondent.Attributes.EmailAddress,
+			FirstName:    respondent.Attributes.FirstName,
+			ID:           respondent.Attributes.ID,
+			LastName:     respondent.Attributes.LastName,
+			Telephone:    respondent.Attributes.Telephone,
+		},
+		SampleUnitType: respondentUnitType,
+		Status:         respondent.Status,
+	}
+	for _, association := range respondent.Associations {
+		enrolments, ok := filter.apply(association.Enrolments)
+		if !ok {
+			continue
+		}
+		business, err := businesses.GetBusiness(ctx, association.ID)
+		if err != nil && err != store.ErrNotFound {
+			return models.LegacyRespondent{}, err
+		}
+		legacy.Associations = append(legacy.Associations, models.LegacyAssociation{
+			Enrolments:     enrolments,
+			ID:             association.ID,
+			Name:           business.Name,
+			SampleUnitRef:  business.SampleUnitRef,
+			SampleUnitType: businessUnitType,
+		})
+	}
+	return legacy, nil
+}
+
+// Writes a v1 response body escaped as the Python service's was: '&', '<' and '>' are written as they are, and every
+// non-ASCII character is written as a \u escape, or a surrogate pair of them
+func writeLegacyJSON(w http.ResponseWriter, v interface{}) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := w.Write(escapeNonASCII(body.Bytes()))
+	return err
+}
+
+// Escapes the non-ASCII characters in encoded JSON, which can only appear within its strings
+func escapeNonASCII(encoded []byte) []byte {
+	escaped := make([]byte, 0, len(encoded))
+	for len(encoded) > 0 {
+		r, size := utf8.DecodeRune(encoded)
+		switch {
+		case r < utf8.RuneSelf:
+			escaped = append(escaped, encoded[0])
+		case r > 0xffff:
+			r -= 0x10000
+			escaped = append(escaped, fmt.Sprintf(`\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))...)
+		default:
+			escaped = append(escaped, fmt.Sprintf(`\u%04x`, r)...)
+		}
+		encoded = encoded[size:]
+	}
+	return escaped
+}
+
+// Returns the business name made from the RU names in a business's sample attributes, as the Python party service made
+// it
+func businessName(ruNames ...string) string {
+	names := []string{}
+	for _, name := range ruNames {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func postParties(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	var postRequest models.PostParties
+	err := json.NewDecoder(r.Body).Decode(&postRequest)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Invalid JSON",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	missingFields := []string{}
+	if postRequest.SampleUnitRef == "" {
+		missingFields = append(missingFields, "sampleUnitRef")
+	}
+	if postRequest.SampleUnitType == "" {
+		missingFields = append(missingFields, "sampleUnitType")
+	}
+	if postRequest.SampleSummaryID == "" {
+		missingFields = append(missingFields, "sampleSummaryId")
+	}
+	if postRequest.Attributes != nil {
+		if postRequest.Attributes.RUName1 == "" {
+			missingFields = append(missingFields, "runame1")
+		}
+		if postRequest.Attributes.RUName2 == "" {
+			missingFields = append(missingFields, "runame2")
+		}
+		if postRequest.Attributes.RUName3 == "" {
+			missingFields = append(missingFields, "runame3")
+		}
+	}
+
+	if len(missingFields) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Missing required fields: " + strings.Join(missingFields, ", "),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	if postRequest.SampleUnitType != businessUnitType {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Invalid sampleUnitType: " + postRequest.SampleUnitType,
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	// Create the business if it's new, or add its new attributes and sample if it isn't
+	business, err := businesses.GetBusinessByRef(r.Context(), postRequest.SampleUnitRef)
+	exists := err == nil
+	if err != nil && err != store.ErrNotFound {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		business = models.Business{ID: uuid.New().String(), SampleUnitRef: postRequest.SampleUnitRef}
+	}
+	business.SampleSummaryID = postRequest.SampleSummaryID
+	if postRequest.Attributes != nil {
+		business.Name = businessName(postRequest.Attributes.RUName1, postRequest.Attributes.RUName2, postRequest.Attributes.RUName3)
+		business.TradingAs = postRequest.Attributes.TradStyle1
+		business.Attributes = fromLegacyBusinessAttributes(*postRequest.Attributes)
+		business.Attributes.RURef = postRequest.SampleUnitRef
+	}
+
+	if exists {
+		err = businesses.UpdateBusiness(r.Context(), business, nil)
+	} else {
+		business.Associations = []models.Association{}
+		err = businesses.CreateBusiness(r.Context(), business)
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeLegacyJSON(w, toLegacyBusiness(business, enrolmentFilter{all: true}))
+}
+
+// Writes the v1 response for the business found by getBusiness, or the error finding it. Its associations are only
+// included without a survey_id if allAssociations is true.
+func writeLegacyBusiness(w http.ResponseWriter, r *http.Request, allAssociations bool, getBusiness func(context.Context, store.BusinessStore) (models.Business, error)) {
+	filter, invalid := parseEnrolmentFilter(r.URL.Query(), allAssociations)
+	if invalid != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: invalid,
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	businesses := getBusinessStore()
+	if businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	business, err := getBusiness(r.Context(), businesses)
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Business does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeLegacyJSON(w, toLegacyBusiness(business, filter))
+}
+
+func getBusinessPartyByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	businessID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	writeLegacyBusiness(w, r, false, func(ctx context.Context, businesses store.BusinessStore) (models.Business, error) {
+		return businesses.GetBusiness(ctx, businessID.String())
+	})
+}
+
+func getBusinessPartyByRef(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writeLegacyBusiness(w, r, true, func(ctx context.Context, businesses store.BusinessStore) (models.Business, error) {
+		return businesses.GetBusinessByRef(ctx, p.ByName("ref"))
+	})
+}
+
+// Serves the v1 representation of the respondent with the ID provided, which is also their sample unit reference. Their
+// associations are only included without a survey_id if allAssociations is true.
+func writeLegacyRespondent(w http.ResponseWriter, r *http.Request, id string, allAssociations bool) {
+	respondentID, err := uuid.Parse(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + id,
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	filter, invalid := parseEnrolmentFilter(r.URL.Query(), allAssociations)
+	if invalid != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: invalid,
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	respondents := getRespondentStore()
+	businesses := getBusinessStore()
+	if respondents == nil || businesses == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	respondent, err := respondents.GetRespondent(r.Context(), respondentID.String())
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Respondent does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	legacy, err := toLegacyRespondent(r.Context(), respondent, businesses, filter)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeLegacyJSON(w, legacy)
+}
+
+func getRespondentPartyByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writeLegacyRespondent(w, r, p.ByName("id"), false)
+}
+
+// A respondent's sample unit reference is their party ID, so looking them up by it is the same as by ID, except that
+// their associations are included without a survey_id
+func getRespondentPartyByRef(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writeLegacyRespondent(w, r, p.ByName("ref"), true)
+}
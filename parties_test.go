@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/stretchr/testify/assert"
+)
+
+var partiesBusiness = models.Business{
+	ID:              "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+	SampleUnitRef:   "49900000001",
+	SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a",
+	Name:            "Bolts and Ratchets Ltd",
+	TradingAs:       "Bolts R Us",
+	Attributes:      models.BusinessAttributes{RURef: "49900000001", FormType: "0001", RUName1: "Bolts and Ratchets Ltd", CellNo: 1},
+}
+
+// Creates the business, and bob enrolled on a survey for it, in the memory store
+func useMemoryStoreWithParties(t *testing.T) *store.Memory {
+	memory := useMemoryStore(t)
+	if err := memory.CreateBusiness(context.Background(), partiesBusiness); err != nil {
+		t.Fatal("Error creating business, ", err.Error())
+	}
+	err := memory.CreateRespondent(context.Background(), postReq.Data.Attributes, []store.NewEnrolment{{
+		Code:       "abc1234",
+		CaseID:     "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+		BusinessID: partiesBusiness.ID,
+		SurveyID:   "0752a892-1a60-40a4-8aa3-2599405a8831",
+	}})
+	if err != nil {
+		t.Fatal("Error creating respondent, ", err.Error())
+	}
+	return memory
+}
+
+// The v1 representation of the business, with bob's association for the survey, as the legacy spec describes it
+const legacyBusinessJSON = `{"associations":[{"enrolments":[{"enrolmentStatus":"PENDING","surveyId":"0752a892-1a60-40a4-8aa3-2599405a8831"}],` +
+	`"id":"be70e086-7bbc-461c-a565-5b454d748a71","name":"Bob Boblaw","sampleUnitRef":"be70e086-7bbc-461c-a565-5b454d748a71","sampleUnitType":"BI"}],` +
+	`"attributes":{"cell_no":1,"formType":"0001","formtype":"0001","froempment":0,"frotover":0,"runame1":"Bolts and Ratchets Ltd","ruref":"49900000001"},` +
+	`"id":"ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2","name":"Bolts and Ratchets Ltd",` +
+	`"sampleSummaryId":"c9a4f9a5-573e-4870-a114-42279ab2aa3a","sampleUnitRef":"49900000001","sampleUnitType":"B","trading_as":"Bolts R Us"}` + "\n"
+
+func TestGetBusinessPartyByID(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/B/id/"+partiesBusiness.ID+"?survey_id=0752a892-1a60-40a4-8aa3-2599405a8831", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, legacyBusinessJSON, resp.Body.String())
+}
+
+func TestGetBusinessPartyByIDEscapesAsPythonDid(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+	business := partiesBusiness
+	business.Name = "Café <Crêpes> & Co 🥞"
+	business.TradingAs = ""
+	business.Attributes = models.BusinessAttributes{RURef: business.SampleUnitRef, RUName1: business.Name}
+	if err := memory.CreateBusiness(context.Background(), business); err != nil {
+		t.Fatal("Error creating business, ", err.Error())
+	}
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/B/id/"+business.ID, nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `{"associations":[],"attributes":{"cell_no":0,"froempment":0,"frotover":0,"runame1":"Caf\u00e9 <Cr\u00eapes> & Co \ud83e\udd5e","ruref":"49900000001"},`+
+		`"id":"ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2","name":"Caf\u00e9 <Cr\u00eapes> & Co \ud83e\udd5e",`+
+		`"sampleSummaryId":"c9a4f9a5-573e-4870-a114-42279ab2aa3a","sampleUnitRef":"49900000001","sampleUnitType":"B","trading_as":""}`+"\n",
+		resp.Body.String())
+}
+
+func TestGetBusinessPartyByIDOnlyIncludesAssociationsForSurvey(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/B/id/"+partiesBusiness.ID, nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.LegacyBusiness
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /parties/type/B/id/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, partiesBusiness.ID, response.ID)
+	assert.Empty(t, response.Associations)
+}
+
+func TestGetBusinessPartyByIDFiltersEnrolments(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	for query, associations := range map[string]int{
+		"survey_id=0752a892-1a60-40a4-8aa3-2599405a8831":                          1,
+		"survey_id=0752a892-1a60-40a4-8aa3-2599405a8831&enrolment_status=PENDING": 1,
+		"survey_id=0752a892-1a60-40a4-8aa3-2599405a8831&enrolment_status=ENABLED": 0,
+		"survey_id=cb0711c3-0ac8-41d3-ae0e-567e5ea1ef87":                          0,
+		"survey_id=0752a892-1a60-40a4-8aa3-2599405a8831&enrolment_status=ENABLED&" +
+			"enrolment_status=PENDING": 1,
+	} {
+		resp = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/party-api/v1/parties/type/B/id/"+partiesBusiness.ID+"?"+query, nil)
+		req.SetBasicAuth("admin", "secret")
+		router.ServeHTTP(resp, req)
+
+		var response models.LegacyBusiness
+		err := json.NewDecoder(resp.Body).Decode(&response)
+		if err != nil {
+			t.Fatal("Error decoding JSON response from 'GET /parties/type/B/id/{id}', ", err.Error())
+		}
+		assert.Equal(t, http.StatusOK, resp.Code, query)
+		assert.Equal(t, associations, len(response.Associations), query)
+	}
+}
+
+func TestGetBusinessPartyByIDReturns400IfSurveyIDInvalid(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/B/id/"+partiesBusiness.ID+"?survey_id=abc", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /parties/type/B/id/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Invalid value for survey_id: abc", errResp.Error)
+}
+
+func TestGetBusinessPartyByRef(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/B/ref/49900000001", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, legacyBusinessJSON, resp.Body.String())
+}
+
+func TestGetBusinessPartyByRefReturns404IfNotFound(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/B/ref/49900000002", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /parties/type/B/ref/{ref}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Business does not exist", errResp.Error)
+}
+
+func TestGetRespondentPartyByIDAndRef(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	// By ID, associations are only included for a survey
+	for _, path := range []string{
+		"/party-api/v1/parties/type/BI/id/" + postReq.Data.Attributes.ID + "?survey_id=0752a892-1a60-40a4-8aa3-2599405a8831",
+		"/party-api/v1/parties/type/BI/ref/" + postReq.Data.Attributes.ID,
+	} {
+		resp = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.SetBasicAuth("admin", "secret")
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code, path)
+		assert.Equal(t, `{"associations":[{"enrolments":[{"enrolmentStatus":"PENDING","surveyId":"0752a892-1a60-40a4-8aa3-2599405a8831"}],`+
+			`"id":"ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2","name":"Bolts and Ratchets Ltd","sampleUnitRef":"49900000001","sampleUnitType":"B"}],`+
+			`"attributes":{"emailAddress":"bob@boblaw.com","firstName":"Bob","id":"be70e086-7bbc-461c-a565-5b454d748a71","lastName":"Boblaw",`+
+			`"telephone":"01234567890"},"sampleUnitType":"BI","status":"CREATED"}`+"\n", resp.Body.String(), path)
+	}
+}
+
+func TestGetRespondentPartyByIDReturns404IfNotFound(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/BI/id/"+postReq.Data.Attributes.ID, nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /parties/type/BI/id/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Respondent does not exist", errResp.Error)
+}
+
+// Unlike the Python service's, a respondent's reference is their party ID, so one which isn't a UUID is rejected
+func TestGetRespondentPartyByRefReturns400IfNotAnID(t *testing.T) {
+	setup()
+	useMemoryStoreWithParties(t)
+
+	req := httptest.NewRequest("GET", "/party-api/v1/parties/type/BI/ref/9999012345", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /parties/type/BI/ref/{ref}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Not a valid ID: 9999012345", errResp.Error)
+}
+
+func TestPostPartiesCreatesBusiness(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+
+	req := httptest.NewRequest("POST", "/party-api/v1/parties", bytes.NewBufferString(`{"sampleUnitRef":"49900000001","sampleUnitType":"B",`+
+		`"sampleSummaryId":"c9a4f9a5-573e-4870-a114-42279ab2aa3a","attributes":{"formtype":"0001","runame1":"Bolts and","runame2":"Ratchets",`+
+		`"runame3":"Ltd","tradstyle1":"Bolts R Us","cell_no":1}}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.LegacyBusiness
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /parties', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Bolts and Ratchets Ltd", response.Name)
+	assert.Equal(t, "Bolts R Us", response.TradingAs)
+	assert.Equal(t, "0001", response.Attributes.FormTypeV1)
+	assert.Equal(t, "49900000001", response.Attributes.RURef)
+
+	business, err := memory.GetBusiness(context.Background(), response.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "49900000001", business.SampleUnitRef)
+	assert.Equal(t, "c9a4f9a5-573e-4870-a114-42279ab2aa3a", business.SampleSummaryID)
+	assert.Equal(t, 1, business.Attributes.CellNo)
+}
+
+func TestPostPartiesUpdatesExistingBusiness(t *testing.T) {
+	setup()
+	memory := useMemoryStoreWithParties(t)
+
+	req := httptest.NewRequest("POST", "/party-api/v1/parties", bytes.NewBufferString(`{"sampleUnitRef":"49900000001","sampleUnitType":"B",`+
+		`"sampleSummaryId":"4e29d2e9-f3b5-4e8c-9d3a-2b8e7e0c5f11"}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.LegacyBusiness
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /parties', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, partiesBusiness.ID, response.ID)
+	assert.Equal(t, 1, len(response.Associations))
+
+	// The attributes are left as they were, as none were provided
+	business, err := memory.GetBusiness(context.Background(), partiesBusiness.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "4e29d2e9-f3b5-4e8c-9d3a-2b8e7e0c5f11", business.SampleSummaryID)
+	assert.Equal(t, partiesBusiness.Name, business.Name)
+	assert.Equal(t, partiesBusiness.Attributes, business.Attributes)
+}
+
+func TestPostPartiesReturns400IfInvalid(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	for body, expected := range map[string]string{
+		`{}`: "Missing required fields: sampleUnitRef, sampleUnitType, sampleSummaryId",
+		`{"sampleUnitRef":"49900000001","sampleUnitType":"B","sampleSummaryId":"c9a4f9a5-573e-4870-a114-42279ab2aa3a","attributes":{"runame1":"Bolts"}}`: "Missing required fields: runame2, runame3",
+		`{"sampleUnitRef":"49900000001","sampleUnitType":"BI","sampleSummaryId":"c9a4f9a5-573e-4870-a114-42279ab2aa3a"}`:                                 "Invalid sampleUnitType: BI",
+		`{"sampleUnitRef":`: "Invalid JSON",
+	} {
+		resp = httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/party-api/v1/parties", bytes.NewBufferString(body))
+		req.SetBasicAuth("admin", "secret")
+		router.ServeHTTP(resp, req)
+
+		var errResp models.Error
+		err := json.NewDecoder(resp.Body).Decode(&errResp)
+		if err != nil {
+			t.Fatal("Error decoding JSON response from 'POST /parties', ", err.Error())
+		}
+		assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		assert.Equal(t, expected, errResp.Error, body)
+	}
+}
@@ -0,0 +1,190 @@
+// Package query builds parameterised SQL statements, so that values provided by callers are only ever passed to the
+// database as arguments and never become part of the statement text.
+//
+// Conditions are written using ? as the placeholder for each argument, which is rewritten to Postgres' positional
+// $n form when the statement is built. Column names and conditions must only ever come from the code itself.
+package query
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrNoChanges is returned when building an UPDATE statement with nothing to set
+var ErrNoChanges = errors.New("no columns to update")
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// LikeContains returns a pattern for LIKE/ILIKE which matches any value containing the one provided, treating any
+// wildcards within it literally
+func LikeContains(value string) string {
+	return "%" + likeEscaper.Replace(value) + "%"
+}
+
+type condition struct {
+	clause string
+	args   []interface{}
+}
+
+// Rewrites the ? placeholders in a clause to $n, starting from the argument number after next
+func numberPlaceholders(sb *strings.Builder, clause string, next *int) {
+	for _, c := range clause {
+		if c == '?' {
+			*next++
+			sb.WriteString("$" + strconv.Itoa(*next))
+		} else {
+			sb.WriteRune(c)
+		}
+	}
+}
+
+func writeWhere(sb *strings.Builder, conditions []condition, args *[]interface{}) {
+	for idx, cond := range conditions {
+		if idx == 0 {
+			sb.WriteString(" WHERE ")
+		} else {
+			sb.WriteString(" AND ")
+		}
+		next := len(*args)
+		numberPlaceholders(sb, cond.clause, &next)
+		*args = append(*args, cond.args...)
+	}
+}
+
+// Select builds a SELECT statement from a fixed base with optional conditions, ordering and pagination
+type Select struct {
+	base       string
+	conditions []condition
+	orderBy    string
+	limit      *int
+	offset     *int
+}
+
+// NewSelect starts a SELECT statement from the base provided, which should contain everything up to (but not
+// including) the WHERE clause
+func NewSelect(base string) *Select {
+	return &Select{base: base}
+}
+
+// Where adds a condition which must be met, using ? as the placeholder for each of the args
+func (s *Select) Where(clause string, args ...interface{}) *Select {
+	s.conditions = append(s.conditions, condition{clause: clause, args: args})
+	return s
+}
+
+// WhereEquals adds a condition that the column must equal the value provided
+func (s *Select) WhereEquals(column string, value interface{}) *Select {
+	return s.Where(column+"=?", value)
+}
+
+// OrderBy sets the ORDER BY clause
+func (s *Select) OrderBy(columns string) *Select {
+	s.orderBy = columns
+	return s
+}
+
+// Limit sets the maximum number of rows to return
+func (s *Select) Limit(limit int) *Select {
+	s.limit = &limit
+	return s
+}
+
+// Offset sets the number of rows to skip
+func (s *Select) Offset(offset int) *Select {
+	s.offset = &offset
+	return s
+}
+
+// Build returns the statement and the arguments to execute it with
+func (s *Select) Build() (string, []interface{}) {
+	var sb strings.Builder
+	args := []interface{}{}
+
+	sb.WriteString(s.base)
+	writeWhere(&sb, s.conditions, &args)
+
+	if s.orderBy != "" {
+		sb.WriteString(" ORDER BY " + s.orderBy)
+	}
+	if s.limit != nil {
+		args = append(args, *s.limit)
+		sb.WriteString(" LIMIT $" + strconv.Itoa(len(args)))
+	}
+	if s.offset != nil {
+		args = append(args, *s.offset)
+		sb.WriteString(" OFFSET $" + strconv.Itoa(len(args)))
+	}
+
+	return sb.String(), args
+}
+
+// Count returns a statement with the same conditions but a different base (e.g. "SELECT COUNT(*) FROM ..."), ignoring
+// any ordering or pagination
+func (s *Select) Count(base string) (string, []interface{}) {
+	var sb strings.Builder
+	args := []interface{}{}
+
+	sb.WriteString(base)
+	writeWhere(&sb, s.conditions, &args)
+
+	return sb.String(), args
+}
+
+// Update builds an UPDATE statement for a single table
+type Update struct {
+	table      string
+	columns    []string
+	values     []interface{}
+	conditions []condition
+}
+
+// NewUpdate starts an UPDATE statement for the table provided
+func NewUpdate(table string) *Update {
+	return &Update{table: table}
+}
+
+// Set adds a column to update to the value provided
+func (u *Update) Set(column string, value interface{}) *Update {
+	u.columns = append(u.columns, column)
+	u.values = append(u.values, value)
+	return u
+}
+
+// Where adds a condition which rows must meet to be updated, using ? as the placeholder for each of the args
+func (u *Update) Where(clause string, args ...interface{}) *Update {
+	u.conditions = append(u.conditions, condition{clause: clause, args: args})
+	return u
+}
+
+// WhereEquals adds a condition that the column must equal the value provided
+func (u *Update) WhereEquals(column string, value interface{}) *Update {
+	return u.Where(column+"=?", value)
+}
+
+// HasChanges reports whether any columns have been set
+func (u *Update) HasChanges() bool {
+	return len(u.columns) > 0
+}
+
+// Build returns the statement and the arguments to execute it with, or ErrNoChanges if no columns have been set
+func (u *Update) Build() (string, []interface{}, error) {
+	if !u.HasChanges() {
+		return "", nil, ErrNoChanges
+	}
+
+	var sb strings.Builder
+	args := []interface{}{}
+
+	sb.WriteString("UPDATE " + u.table + " SET ")
+	for idx, column := range u.columns {
+		if idx > 0 {
+			sb.WriteString(", ")
+		}
+		args = append(args, u.values[idx])
+		sb.WriteString(column + "=$" + strconv.Itoa(len(args)))
+	}
+	writeWhere(&sb, u.conditions, &args)
+
+	return sb.String(), args, nil
+}
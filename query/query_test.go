@@ -0,0 +1,98 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var hostileValues = []string{
+	"' OR '1'='1",
+	"'; DROP TABLE partysvc.respondent; --",
+	"$1",
+	"?",
+	"\\'; SELECT pg_sleep(10); --",
+	"1 UNION SELECT * FROM pg_user",
+}
+
+func TestSelectWithNoConditions(t *testing.T) {
+	statement, args := NewSelect("SELECT id FROM partysvc.respondent").Build()
+
+	assert.Equal(t, "SELECT id FROM partysvc.respondent", statement)
+	assert.Empty(t, args)
+}
+
+func TestSelectNumbersPlaceholdersInOrder(t *testing.T) {
+	statement, args := NewSelect("SELECT id FROM partysvc.respondent r").
+		WhereEquals("r.first_name", "Bob").
+		Where("(r.last_name=? OR r.email_address=?)", "Boblaw", "bob@boblaw.com").
+		OrderBy("r.last_name").
+		Limit(10).
+		Offset(20).
+		Build()
+
+	assert.Equal(t, "SELECT id FROM partysvc.respondent r WHERE r.first_name=$1 AND (r.last_name=$2 OR r.email_address=$3) "+
+		"ORDER BY r.last_name LIMIT $4 OFFSET $5", statement)
+	assert.Equal(t, []interface{}{"Bob", "Boblaw", "bob@boblaw.com", 10, 20}, args)
+}
+
+func TestSelectCountIgnoresPagination(t *testing.T) {
+	statement, args := NewSelect("SELECT id FROM partysvc.business b").
+		Where("b.business_ref ILIKE ?", "%499%").
+		OrderBy("b.business_ref").
+		Limit(10).
+		Count("SELECT COUNT(*) FROM partysvc.business b")
+
+	assert.Equal(t, "SELECT COUNT(*) FROM partysvc.business b WHERE b.business_ref ILIKE $1", statement)
+	assert.Equal(t, []interface{}{"%499%"}, args)
+}
+
+func TestSelectNeverIncludesValuesInStatement(t *testing.T) {
+	for _, value := range hostileValues {
+		statement, args := NewSelect("SELECT id FROM partysvc.respondent r").
+			WhereEquals("r.first_name", value).
+			Where("r.last_name ILIKE ?", LikeContains(value)).
+			Build()
+
+		assert.Equal(t, "SELECT id FROM partysvc.respondent r WHERE r.first_name=$1 AND r.last_name ILIKE $2", statement)
+		assert.Equal(t, value, args[0])
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	statement, args, err := NewUpdate("partysvc.respondent").
+		Set("first_name", "Bob").
+		Set("status", "ACTIVE").
+		WhereEquals("id", "be70e086-7bbc-461c-a565-5b454d748a71").
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE partysvc.respondent SET first_name=$1, status=$2 WHERE id=$3", statement)
+	assert.Equal(t, []interface{}{"Bob", "ACTIVE", "be70e086-7bbc-461c-a565-5b454d748a71"}, args)
+}
+
+func TestUpdateWithNoChanges(t *testing.T) {
+	update := NewUpdate("partysvc.respondent").WhereEquals("id", "be70e086-7bbc-461c-a565-5b454d748a71")
+	_, _, err := update.Build()
+
+	assert.False(t, update.HasChanges())
+	assert.Equal(t, ErrNoChanges, err)
+}
+
+func TestUpdateNeverIncludesValuesInStatement(t *testing.T) {
+	for _, value := range hostileValues {
+		statement, args, err := NewUpdate("partysvc.respondent").
+			Set("email_address", value).
+			WhereEquals("id", value).
+			Build()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "UPDATE partysvc.respondent SET email_address=$1 WHERE id=$2", statement)
+		assert.Equal(t, []interface{}{value, value}, args)
+	}
+}
+
+func TestLikeContainsEscapesWildcards(t *testing.T) {
+	assert.Equal(t, "%Bolts%", LikeContains("Bolts"))
+	assert.Equal(t, `%100\% \_pure\_ \\o/%`, LikeContains(`100% _pure_ \o/`))
+}
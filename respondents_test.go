@@ -2,18 +2,33 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/ras-rm-party/auth"
+	"github.com/ONSdigital/ras-rm-party/clients/clientstest"
+	"github.com/ONSdigital/ras-rm-party/events"
 	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
 	"github.com/lib/pq"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/h2non/gock.v1"
 )
 
@@ -39,6 +54,21 @@ var postReq = models.PostRespondents{
 		Status: "ACTIVE",
 	},
 	EnrolmentCodes: []string{"abc1234"}}
+var hostileValues = []string{
+	"' OR '1'='1",
+	"bob@boblaw.com'; DROP TABLE partysvc.respondent; --",
+	"' UNION SELECT usename, passwd, '', '', '', '', '', '', '' FROM pg_shadow --",
+	"\\'; SELECT pg_sleep(10); --",
+}
+
+// Fails any statement which contains a quote or comment, as it can only have got there from a value being concatenated
+var hostileValueQueryMatcher = sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+	if strings.ContainsAny(actualSQL, "'\\") || strings.Contains(actualSQL, "--") {
+		return fmt.Errorf("statement contains a provided value: %s", actualSQL)
+	}
+	return sqlmock.QueryMatcherRegexp.Match(expectedSQL, actualSQL)
+})
+
 var patchReq = models.PostRespondents{
 	Data: models.Respondent{
 		Attributes: models.Attributes{
@@ -218,6 +248,133 @@ func TestGetRespondentsReturns500WhenDBDown(t *testing.T) {
 	assert.Equal(t, "Error querying DB: Connection refused", errResp.Error)
 }
 
+func TestGetRespondentsPassesHostileValuesAsArguments(t *testing.T) {
+	for _, filter := range store.RespondentFilters {
+		for _, value := range hostileValues {
+			setup()
+
+			var mock sqlmock.Sqlmock
+			var err error
+
+			db, mock, err = sqlmock.New(sqlmock.QueryMatcherOption(hostileValueQueryMatcher))
+			if err != nil {
+				log.Fatalf("Error setting up an SQL mock")
+			}
+
+			mock.ExpectQuery(selectQueryRegex).WithArgs(value).WillReturnRows(mock.NewRows(searchRespondentQueryColumns))
+
+			req := httptest.NewRequest("GET", "/v2/respondents?"+url.Values{filter: {value}}.Encode(), nil)
+			req.SetBasicAuth("admin", "secret")
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusNotFound, resp.Code, filter+"="+value)
+			assert.Nil(t, mock.ExpectationsWereMet(), filter+"="+value)
+		}
+	}
+}
+
+func TestGetRespondentsReturns400WhenBadPaginationProvided(t *testing.T) {
+	for _, param := range []string{"offset", "limit"} {
+		for _, value := range append(hostileValues, "-1", "ten") {
+			setup()
+
+			var err error
+			db, _, err = sqlmock.New()
+			if err != nil {
+				log.Fatalf("Error setting up an SQL mock")
+			}
+
+			req := httptest.NewRequest("GET", "/v2/respondents?firstName=Bob&"+url.Values{param: {value}}.Encode(), nil)
+			req.SetBasicAuth("admin", "secret")
+			router.ServeHTTP(resp, req)
+
+			var errResp models.Error
+			err = json.NewDecoder(resp.Body).Decode(&errResp)
+			if err != nil {
+				t.Fatal("Error decoding JSON response from 'GET /respondents', ", err.Error())
+			}
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code, param+"="+value)
+			assert.Equal(t, "Invalid value for "+param+": "+value, errResp.Error)
+		}
+	}
+}
+
+// Expects the outbox entries deactivating the enrolment codes to be recorded in the current transaction
+func expectDeactivationOutboxEntries(mock sqlmock.Sqlmock, codes ...string) {
+	prepared := mock.ExpectPrepare(copyQueryRegex)
+	for _, code := range codes {
+		prepared.ExpectExec().WithArgs(store.OutboxDeactivateIAC, `{"iac":"`+code+`"}`, AnyTime{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// Matches an outbox entry payload which is an event of the type provided
+type eventOfType string
+
+func (e eventOfType) Match(v driver.Value) bool {
+	payload, ok := v.(string)
+	if !ok {
+		return false
+	}
+	var event events.Event
+	return json.Unmarshal([]byte(payload), &event) == nil && event.Type == string(e)
+}
+
+// Expects outbox entries publishing events of the types provided, and notifying webhooks of them, to be recorded in
+// the current transaction
+func expectEventOutboxEntries(mock sqlmock.Sqlmock, eventTypes ...string) {
+	prepared := mock.ExpectPrepare(copyQueryRegex)
+	for _, eventType := range eventTypes {
+		prepared.ExpectExec().WithArgs(store.OutboxPublishEvent, eventOfType(eventType), AnyTime{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
+		prepared.ExpectExec().WithArgs(store.OutboxNotifyWebhooks, eventOfType(eventType), AnyTime{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+var auditedRespondentQueryColumns = []string{"id", "email_address", "first_name", "last_name", "telephone", "status", "business_id", "survey_id", "enrolment_status"}
+var auditQueryRegex = "INSERT INTO partysvc.audit_log (.+)"
+
+// Expects the respondent to be read in the current transaction, as they stand before the change, for the audit log
+func expectAuditedRespondent(mock sqlmock.Sqlmock, id string) {
+	rows := mock.NewRows(auditedRespondentQueryColumns)
+	rows.AddRow(id, "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", nil, nil, nil)
+	mock.ExpectQuery(selectQueryRegex).WithArgs(id).WillReturnRows(rows)
+}
+
+// Mocks the IAC, Case and Collection Exercise service responses which resolve patchReq's enrolment code
+func mockPatchReqEnrolmentCode() {
+	gock.New("http://localhost:8121").Get("/iacs/abc1234").Reply(200).JSON(models.IAC{
+		IAC:         "abc1234",
+		Active:      true,
+		LastUsed:    "2017-05-15T10:00:00Z",
+		CaseID:      "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+		QuestionSet: "H1"})
+	gock.New("http://localhost:8171").Get("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb").Reply(200).JSON(models.Case{
+		ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+		CaseGroup: models.CaseGroup{
+			ID:                   "aa9c8e93-5cd9-4876-a2d3-78a87b972134",
+			CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea",
+		},
+	})
+	gock.New("http://localhost:8145").Get("/collectionexercises/1010b2f2-8668-498a-afee-3c33cdfe42ea").Reply(200).JSON(models.CollectionExercise{
+		ID:       "1010b2f2-8668-498a-afee-3c33cdfe42ea",
+		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
+	})
+}
+
+// Expects the respondent to be found before their enrolment codes are resolved, outside of any transaction
+func expectRespondentExists(mock sqlmock.Sqlmock, id string) {
+	mock.ExpectQuery(selectQueryRegex).WithArgs(id).WillReturnRows(mock.NewRows([]string{"id"}).AddRow(id))
+}
+
+// Expects the change to be recorded in the audit log in the current transaction, against the default client
+func expectAuditEntry(mock sqlmock.Sqlmock, action string) {
+	mock.ExpectExec(auditQueryRegex).WithArgs("default", action, AnyUUID{}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), AnyTime{}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 // POST /respondents
 
 func TestPostRespondents(t *testing.T) {
@@ -285,10 +442,6 @@ func TestPostRespondents(t *testing.T) {
 		SurveyID: "c43cafd8-ece0-410f-9887-0b0b5eb681fb",
 	})
 
-	gock.New("http://localhost:8121").Put("/abc1234").Reply(200)
-
-	gock.New("http://localhost:8121").Put("/abc1235").Reply(200)
-
 	jsonOut, err := json.Marshal(doublePostReq)
 	if err != nil {
 		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
@@ -316,6 +469,9 @@ func TestPostRespondents(t *testing.T) {
 		AnyUUID{}, "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234", "abc1235")
+	expectEventOutboxEntries(mock, events.RespondentCreated)
+	expectAuditEntry(mock, store.AuditCreate)
 	mock.ExpectCommit()
 	mock.ExpectClose()
 
@@ -335,166 +491,6 @@ func TestPostRespondents(t *testing.T) {
 	assert.True(t, gock.IsDone())
 }
 
-func TestPostRespondentsIfIACDeactivationFails(t *testing.T) {
-	// By not setting up the mock properly, we can effectively test an err in http PUT
-	setup()
-	defer gock.Off()
-	var mock sqlmock.Sqlmock
-	var err error
-
-	db, mock, err = sqlmock.New()
-	if err != nil {
-		log.Fatalf("Error setting up an SQL mock")
-	}
-
-	gock.New("http://localhost:8121").Get("/iacs/abc1234").Reply(200).JSON(models.IAC{
-		IAC:         "abc1234",
-		Active:      true,
-		LastUsed:    "2017-05-15T10:00:00Z",
-		CaseID:      "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		QuestionSet: "H1"})
-
-	gock.New("http://localhost:8171").Get("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb").Reply(200).JSON(models.Case{
-		ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		CaseGroup: models.CaseGroup{
-			ID:                   "aa9c8e93-5cd9-4876-a2d3-78a87b972134",
-			CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		},
-	})
-
-	gock.New("http://localhost:8145").Get("/collectionexercises/1010b2f2-8668-498a-afee-3c33cdfe42ea").Reply(200).JSON(models.CollectionExercise{
-		ID:       "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
-	})
-
-	// Calling IAC to deactivate the enrolment code fails, but the whole process still works and sends 200
-
-	jsonOut, err := json.Marshal(postReq)
-	if err != nil {
-		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
-	}
-
-	businessRows := mock.NewRows(searchBusinessesQueryColumns)
-	businessRows.AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
-
-	mock.ExpectPrepare(selectQueryRegex).ExpectQuery().WithArgs(pq.Array([]string{"ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2"})).WillReturnRows(businessRows)
-
-	mock.ExpectBegin()
-	mock.ExpectPrepare(insertQueryRegex).ExpectExec().WithArgs(AnyUUID{}, "CREATED", postReq.Data.Attributes.EmailAddress, postReq.Data.Attributes.FirstName,
-		postReq.Data.Attributes.LastName, postReq.Data.Attributes.Telephone, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectPrepare(copyQueryRegex).ExpectExec().WithArgs("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", AnyUUID{}, "ACTIVE", AnyTime{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectExec(copyQueryRegex).WithArgs("7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb", AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		"0752a892-1a60-40a4-8aa3-2599405a8831", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		"0752a892-1a60-40a4-8aa3-2599405a8831", "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
-	mock.ExpectClose()
-
-	var logCatcher bytes.Buffer
-	log.SetOutput(&logCatcher)
-
-	req := httptest.NewRequest("POST", "/v2/respondents", bytes.NewBuffer(jsonOut))
-	req.SetBasicAuth("admin", "secret")
-	router.ServeHTTP(resp, req)
-
-	var response models.Respondents
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	if err != nil {
-		t.Fatal("Error decoding JSON response from 'POST /respondents', ", err.Error())
-	}
-
-	assert.Equal(t, http.StatusCreated, resp.Code)
-	assert.Contains(t, logCatcher.String(), "Error deactivating enrolment code abc1234:")
-	assert.Equal(t, "Bob", response.Data[0].Attributes.FirstName)
-	assert.True(t, gock.IsDone())
-}
-
-func TestPostRespondentsIfIACDeactivationDoesntReturn200(t *testing.T) {
-	setup()
-	defer gock.Off()
-	var mock sqlmock.Sqlmock
-	var err error
-
-	db, mock, err = sqlmock.New()
-	if err != nil {
-		log.Fatalf("Error setting up an SQL mock")
-	}
-
-	gock.New("http://localhost:8121").Get("/iacs/abc1234").Reply(200).JSON(models.IAC{
-		IAC:         "abc1234",
-		Active:      true,
-		LastUsed:    "2017-05-15T10:00:00Z",
-		CaseID:      "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		QuestionSet: "H1"})
-
-	gock.New("http://localhost:8171").Get("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb").Reply(200).JSON(models.Case{
-		ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		CaseGroup: models.CaseGroup{
-			ID:                   "aa9c8e93-5cd9-4876-a2d3-78a87b972134",
-			CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		},
-	})
-
-	gock.New("http://localhost:8145").Get("/collectionexercises/1010b2f2-8668-498a-afee-3c33cdfe42ea").Reply(200).JSON(models.CollectionExercise{
-		ID:       "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
-	})
-
-	// Calling IAC to deactivate the enrolment code fails, but the whole process still works and sends 200
-	gock.New("http://localhost:8121").Put("/abc1234").Reply(404)
-
-	jsonOut, err := json.Marshal(postReq)
-	if err != nil {
-		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
-	}
-
-	businessRows := mock.NewRows(searchBusinessesQueryColumns)
-	businessRows.AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
-
-	mock.ExpectPrepare(selectQueryRegex).ExpectQuery().WithArgs(pq.Array([]string{"ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2"})).WillReturnRows(businessRows)
-
-	mock.ExpectBegin()
-	mock.ExpectPrepare(insertQueryRegex).ExpectExec().WithArgs(AnyUUID{}, "CREATED", postReq.Data.Attributes.EmailAddress, postReq.Data.Attributes.FirstName,
-		postReq.Data.Attributes.LastName, postReq.Data.Attributes.Telephone, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectPrepare(copyQueryRegex).ExpectExec().WithArgs("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", AnyUUID{}, "ACTIVE", AnyTime{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectExec(copyQueryRegex).WithArgs("7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb", AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		"0752a892-1a60-40a4-8aa3-2599405a8831", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		"0752a892-1a60-40a4-8aa3-2599405a8831", "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
-	mock.ExpectClose()
-
-	var logCatcher bytes.Buffer
-	log.SetOutput(&logCatcher)
-
-	req := httptest.NewRequest("POST", "/v2/respondents", bytes.NewBuffer(jsonOut))
-	req.SetBasicAuth("admin", "secret")
-	router.ServeHTTP(resp, req)
-
-	var response models.Respondents
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	if err != nil {
-		t.Fatal("Error decoding JSON response from 'POST /respondents', ", err.Error())
-	}
-
-	assert.Equal(t, http.StatusCreated, resp.Code)
-	assert.Contains(t, logCatcher.String(), "Error deactivating enrolment code abc1234: Received status code 404 from IAC service")
-	assert.Equal(t, "Bob", response.Data[0].Attributes.FirstName)
-	assert.True(t, gock.IsDone())
-}
-
 func TestPostRespondentsReturns400IfBadJSON(t *testing.T) {
 	setup()
 
@@ -1818,6 +1814,9 @@ func TestPostRespondentsReturns500IfCommitFails(t *testing.T) {
 		"0752a892-1a60-40a4-8aa3-2599405a8831", "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234")
+	expectEventOutboxEntries(mock, events.RespondentCreated)
+	expectAuditEntry(mock, store.AuditCreate)
 	mock.ExpectCommit().WillReturnError(fmt.Errorf("Foreign key violation"))
 	mock.ExpectRollback()
 	mock.ExpectClose()
@@ -1852,10 +1851,13 @@ func TestDeleteRespondentsByID(t *testing.T) {
 	rows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(rows)
 	mock.ExpectBegin()
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.RespondentDeleted)
+	expectAuditEntry(mock, store.AuditDelete)
 	mock.ExpectCommit()
 	mock.ExpectClose()
 
@@ -2004,6 +2006,7 @@ func TestDeleteRespondentsByIDReturns500IfDeletingEnrolmentsFails(t *testing.T)
 	rows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(rows)
 	mock.ExpectBegin()
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectExec(deleteQueryRegex).WillReturnError(fmt.Errorf("SQL error"))
 	mock.ExpectRollback()
 	mock.ExpectClose()
@@ -2036,6 +2039,7 @@ func TestDeleteRespondentsByIDReturns500IfDeletingBusinessRespondentFails(t *tes
 	rows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(rows)
 	mock.ExpectBegin()
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnError(fmt.Errorf("SQL error"))
 	mock.ExpectRollback()
@@ -2069,6 +2073,7 @@ func TestDeleteRespondentsByIDReturns500IfDeletingPendingEnrolmentsFails(t *test
 	rows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(rows)
 	mock.ExpectBegin()
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnError(fmt.Errorf("SQL error"))
@@ -2103,6 +2108,7 @@ func TestDeleteRespondentsByIDReturns500IfDeletingRespondentFails(t *testing.T)
 	rows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(rows)
 	mock.ExpectBegin()
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
@@ -2138,10 +2144,13 @@ func TestDeleteRespondentsByIDReturns500IfTransactionCommitFails(t *testing.T) {
 	rows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(rows)
 	mock.ExpectBegin()
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(deleteQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.RespondentDeleted)
+	expectAuditEntry(mock, store.AuditDelete)
 	mock.ExpectCommit().WillReturnError(fmt.Errorf("Table locked"))
 	mock.ExpectRollback()
 	mock.ExpectClose()
@@ -2383,10 +2392,6 @@ func TestPatchRespondentsByID(t *testing.T) {
 		SurveyID: "c43cafd8-ece0-410f-9887-0b0b5eb681fb",
 	})
 
-	gock.New("http://localhost:8121").Put("/abc1234").Reply(200)
-
-	gock.New("http://localhost:8121").Put("/abc1235").Reply(200)
-
 	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
 	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
 
@@ -2399,8 +2404,10 @@ func TestPatchRespondentsByID(t *testing.T) {
 	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "2711912c-db86-4e1e-9728-fc28db049858", "ENABLED", "ba4274ac-a664-4c3d-8910-18b82a12ce09")
 	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "d4a6c190-50da-4d02-9a78-f4de52d9e6af", "", "")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
 	mock.ExpectPrepare(copyQueryRegex)
@@ -2415,8 +2422,10 @@ func TestPatchRespondentsByID(t *testing.T) {
 		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234", "abc1235")
 	mock.ExpectPrepare(updateQueryRegex).ExpectExec().WithArgs("DISABLED", "be70e086-7bbc-461c-a565-5b454d748a71", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
 		"c43cafd8-ece0-410f-9887-0b0b5eb681fb").WillReturnResult(sqlmock.NewResult(1, 1))
+	expectAuditEntry(mock, store.AuditUpdate)
 	mock.ExpectCommit()
 	mock.ExpectQuery(selectQueryRegex).WillReturnRows(returnRows)
 	mock.ExpectClose()
@@ -2440,338 +2449,103 @@ func TestPatchRespondentsByID(t *testing.T) {
 	assert.Equal(t, 0, len(respondent.Data[0].Associations[2].Enrolments))
 }
 
-func TestPatchRespondentsByIDIfIACDeactivationFails(t *testing.T) {
-	// By not setting up the mock properly, we can effectively test an err in http PUT
+func TestPatchRespondentsByIDPassesHostileValuesAsArguments(t *testing.T) {
+	for _, value := range hostileValues {
+		setDefaults()
+		setup()
+		var err error
+		var mock sqlmock.Sqlmock
+
+		db, mock, err = sqlmock.New(sqlmock.QueryMatcherOption(hostileValueQueryMatcher))
+		if err != nil {
+			log.Fatalf("Error setting up an SQL mock")
+		}
+
+		hostileReq := models.PostRespondents{
+			Data: models.Respondent{
+				Attributes: models.Attributes{
+					EmailAddress: value,
+					FirstName:    value,
+					LastName:     value,
+					Telephone:    value,
+				},
+			},
+		}
+		jsonOut, err := json.Marshal(hostileReq)
+		if err != nil {
+			t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
+		}
+
+		respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
+		respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+		expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
+		mock.ExpectQuery(selectQueryRegex).WithArgs(value).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
+		mock.ExpectExec(updateQueryRegex).WithArgs(value, value, value, value, "be70e086-7bbc-461c-a565-5b454d748a71").WillReturnResult(sqlmock.NewResult(1, 1))
+		expectEventOutboxEntries(mock, events.RespondentEmailChanged)
+		expectAuditEntry(mock, store.AuditUpdate)
+		mock.ExpectCommit()
+		mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(mock.NewRows(searchRespondentQueryColumns))
+
+		req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
+		req.SetBasicAuth("admin", "secret")
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code, value)
+		assert.Nil(t, mock.ExpectationsWereMet(), value)
+	}
+}
+
+func TestPatchRespondentsByIDReturns400IfPassedANonUUID(t *testing.T) {
 	setDefaults()
 	setup()
-	var err error
-	var mock sqlmock.Sqlmock
 
-	db, mock, err = sqlmock.New()
+	req := httptest.NewRequest("PATCH", "/v2/respondents/abc123", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
 	if err != nil {
-		log.Fatalf("Error setting up an SQL mock")
+		t.Fatal("Error decoding JSON response from 'PATCH /respondents/{id}', ", err.Error())
 	}
 
-	doublePatchReq := models.PostRespondents{
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Not a valid ID: abc123", errResp.Error)
+}
+
+func TestPatchRespondentsByIDReturns400IfBadJSON(t *testing.T) {
+	setDefaults()
+	setup()
+
+	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", strings.NewReader("{nonsense: true}"))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /respondents/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Invalid JSON", errResp.Error)
+}
+
+func TestPatchRespondentsByIDReturns400IfIDChanged(t *testing.T) {
+	setDefaults()
+	setup()
+
+	idChangePatchReq := models.PostRespondents{
 		Data: models.Respondent{
 			Attributes: models.Attributes{
 				EmailAddress: "bob@boblaw.com",
 				FirstName:    "Bob",
 				LastName:     "Boblaw",
 				Telephone:    "01234567890",
-			},
-			Status: "ACTIVE",
-			Associations: []models.Association{
-				{
-					ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-					Enrolments: []models.Enrolment{
-						{
-							SurveyID:        "c43cafd8-ece0-410f-9887-0b0b5eb681fb",
-							EnrolmentStatus: "DISABLED",
-						},
-					},
-				},
-			},
-		},
-		EnrolmentCodes: []string{"abc1234", "abc1235"}}
-
-	jsonOut, err := json.Marshal(doublePatchReq)
-	if err != nil {
-		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
-	}
-
-	gock.New("http://localhost:8121").Get("/iacs/abc1234").Reply(200).JSON(models.IAC{
-		IAC:         "abc1234",
-		Active:      true,
-		LastUsed:    "2017-05-15T10:00:00Z",
-		CaseID:      "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		QuestionSet: "H1"})
-
-	gock.New("http://localhost:8121").Get("/iacs/abc1235").Reply(200).JSON(models.IAC{
-		IAC:         "abc1235",
-		Active:      true,
-		LastUsed:    "2017-05-15T10:00:00Z",
-		CaseID:      "fbb2d260-da57-4607-b829-a2bd434a01dd",
-		QuestionSet: "H1"})
-
-	gock.New("http://localhost:8171").Get("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb").Reply(200).JSON(models.Case{
-		ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		CaseGroup: models.CaseGroup{
-			ID:                   "aa9c8e93-5cd9-4876-a2d3-78a87b972134",
-			CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		},
-	})
-
-	gock.New("http://localhost:8171").Get("/cases/fbb2d260-da57-4607-b829-a2bd434a01dd").Reply(200).JSON(models.Case{
-		ID:         "fbb2d260-da57-4607-b829-a2bd434a01dd",
-		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		CaseGroup: models.CaseGroup{
-			ID:                   "3f8dcbaf-d5d4-415f-bb45-c2cb328320eb",
-			CollectionExerciseID: "91b4e876-16af-471e-973e-e3da5ab127bd",
-		},
-	})
-
-	gock.New("http://localhost:8145").Get("/collectionexercises/1010b2f2-8668-498a-afee-3c33cdfe42ea").Reply(200).JSON(models.CollectionExercise{
-		ID:       "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
-	})
-
-	gock.New("http://localhost:8145").Get("/collectionexercises/91b4e876-16af-471e-973e-e3da5ab127bd").Reply(200).JSON(models.CollectionExercise{
-		ID:       "91b4e876-16af-471e-973e-e3da5ab127bd",
-		SurveyID: "c43cafd8-ece0-410f-9887-0b0b5eb681fb",
-	})
-
-	// Calling IAC to deactivate the enrolment code fails, but the whole process still works and sends 200
-
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	businessRespondentRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
-	businessRespondentRows.AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
-
-	returnRows := mock.NewRows(searchRespondentQueryColumns)
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "ENABLED", "5e237abd-f8dc-4cb0-829e-58d5cef8ca4a")
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "DISABLED", "84bc0d0a-ae32-4fb1-aabc-6de370245d62")
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "2711912c-db86-4e1e-9728-fc28db049858", "ENABLED", "ba4274ac-a664-4c3d-8910-18b82a12ce09")
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "d4a6c190-50da-4d02-9a78-f4de52d9e6af", "", "")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectPrepare(updateQueryRegex).ExpectExec().WithArgs("DISABLED", "be70e086-7bbc-461c-a565-5b454d748a71", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		"c43cafd8-ece0-410f-9887-0b0b5eb681fb").WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
-	mock.ExpectQuery(selectQueryRegex).WillReturnRows(returnRows)
-	mock.ExpectClose()
-
-	var logCatcher bytes.Buffer
-	log.SetOutput(&logCatcher)
-
-	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
-	req.SetBasicAuth("admin", "secret")
-	router.ServeHTTP(resp, req)
-
-	var respondent models.Respondents
-	err = json.NewDecoder(resp.Body).Decode(&respondent)
-	if err != nil {
-		t.Fatal("Error decoding JSON response from 'PATCH /respondents/{id}', ", err.Error())
-	}
-
-	assert.Equal(t, http.StatusOK, resp.Code)
-	assert.Equal(t, 1, len(respondent.Data))
-	assert.Equal(t, "be70e086-7bbc-461c-a565-5b454d748a71", respondent.Data[0].Attributes.ID)
-	assert.Equal(t, 3, len(respondent.Data[0].Associations))
-	assert.Equal(t, 2, len(respondent.Data[0].Associations[0].Enrolments))
-	assert.Equal(t, 1, len(respondent.Data[0].Associations[1].Enrolments))
-	assert.Equal(t, 0, len(respondent.Data[0].Associations[2].Enrolments))
-	assert.Contains(t, logCatcher.String(), "Error deactivating enrolment code abc1234:")
-}
-
-func TestPatchRespondentsByIDIfIACDeactivationDoesntReturn200(t *testing.T) {
-	setDefaults()
-	setup()
-	var err error
-	var mock sqlmock.Sqlmock
-
-	db, mock, err = sqlmock.New()
-	if err != nil {
-		log.Fatalf("Error setting up an SQL mock")
-	}
-
-	doublePatchReq := models.PostRespondents{
-		Data: models.Respondent{
-			Attributes: models.Attributes{
-				EmailAddress: "bob@boblaw.com",
-				FirstName:    "Bob",
-				LastName:     "Boblaw",
-				Telephone:    "01234567890",
-			},
-			Status: "ACTIVE",
-			Associations: []models.Association{
-				{
-					ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-					Enrolments: []models.Enrolment{
-						{
-							SurveyID:        "c43cafd8-ece0-410f-9887-0b0b5eb681fb",
-							EnrolmentStatus: "DISABLED",
-						},
-					},
-				},
-			},
-		},
-		EnrolmentCodes: []string{"abc1234", "abc1235"}}
-
-	jsonOut, err := json.Marshal(doublePatchReq)
-	if err != nil {
-		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
-	}
-
-	gock.New("http://localhost:8121").Get("/iacs/abc1234").Reply(200).JSON(models.IAC{
-		IAC:         "abc1234",
-		Active:      true,
-		LastUsed:    "2017-05-15T10:00:00Z",
-		CaseID:      "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		QuestionSet: "H1"})
-
-	gock.New("http://localhost:8121").Get("/iacs/abc1235").Reply(200).JSON(models.IAC{
-		IAC:         "abc1235",
-		Active:      true,
-		LastUsed:    "2017-05-15T10:00:00Z",
-		CaseID:      "fbb2d260-da57-4607-b829-a2bd434a01dd",
-		QuestionSet: "H1"})
-
-	gock.New("http://localhost:8171").Get("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb").Reply(200).JSON(models.Case{
-		ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
-		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		CaseGroup: models.CaseGroup{
-			ID:                   "aa9c8e93-5cd9-4876-a2d3-78a87b972134",
-			CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		},
-	})
-
-	gock.New("http://localhost:8171").Get("/cases/fbb2d260-da57-4607-b829-a2bd434a01dd").Reply(200).JSON(models.Case{
-		ID:         "fbb2d260-da57-4607-b829-a2bd434a01dd",
-		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		CaseGroup: models.CaseGroup{
-			ID:                   "3f8dcbaf-d5d4-415f-bb45-c2cb328320eb",
-			CollectionExerciseID: "91b4e876-16af-471e-973e-e3da5ab127bd",
-		},
-	})
-
-	gock.New("http://localhost:8145").Get("/collectionexercises/1010b2f2-8668-498a-afee-3c33cdfe42ea").Reply(200).JSON(models.CollectionExercise{
-		ID:       "1010b2f2-8668-498a-afee-3c33cdfe42ea",
-		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
-	})
-
-	gock.New("http://localhost:8145").Get("/collectionexercises/91b4e876-16af-471e-973e-e3da5ab127bd").Reply(200).JSON(models.CollectionExercise{
-		ID:       "91b4e876-16af-471e-973e-e3da5ab127bd",
-		SurveyID: "c43cafd8-ece0-410f-9887-0b0b5eb681fb",
-	})
-
-	// Calling IAC to deactivate the enrolment code fails, but the whole process still works and sends 200
-	gock.New("http://localhost:8121").Put("/abc1234").Reply(404)
-
-	gock.New("http://localhost:8121").Put("/abc1235").Reply(200)
-
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	businessRespondentRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
-	businessRespondentRows.AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
-
-	returnRows := mock.NewRows(searchRespondentQueryColumns)
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "ENABLED", "5e237abd-f8dc-4cb0-829e-58d5cef8ca4a")
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "DISABLED", "84bc0d0a-ae32-4fb1-aabc-6de370245d62")
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "2711912c-db86-4e1e-9728-fc28db049858", "ENABLED", "ba4274ac-a664-4c3d-8910-18b82a12ce09")
-	returnRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com", "Bob", "Boblaw", "01234567890", "ACTIVE", "d4a6c190-50da-4d02-9a78-f4de52d9e6af", "", "")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectPrepare(copyQueryRegex)
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, "PENDING", AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WithArgs(AnyUUID{}, AnyUUID{}, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectPrepare(updateQueryRegex).ExpectExec().WithArgs("DISABLED", "be70e086-7bbc-461c-a565-5b454d748a71", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
-		"c43cafd8-ece0-410f-9887-0b0b5eb681fb").WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
-	mock.ExpectQuery(selectQueryRegex).WillReturnRows(returnRows)
-	mock.ExpectClose()
-
-	var logCatcher bytes.Buffer
-	log.SetOutput(&logCatcher)
-
-	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
-	req.SetBasicAuth("admin", "secret")
-	router.ServeHTTP(resp, req)
-
-	var respondent models.Respondents
-	err = json.NewDecoder(resp.Body).Decode(&respondent)
-	if err != nil {
-		t.Fatal("Error decoding JSON response from 'PATCH /respondents/{id}', ", err.Error())
-	}
-
-	assert.Equal(t, http.StatusOK, resp.Code)
-	assert.Equal(t, 1, len(respondent.Data))
-	assert.Equal(t, "be70e086-7bbc-461c-a565-5b454d748a71", respondent.Data[0].Attributes.ID)
-	assert.Equal(t, 3, len(respondent.Data[0].Associations))
-	assert.Equal(t, 2, len(respondent.Data[0].Associations[0].Enrolments))
-	assert.Equal(t, 1, len(respondent.Data[0].Associations[1].Enrolments))
-	assert.Equal(t, 0, len(respondent.Data[0].Associations[2].Enrolments))
-	assert.Contains(t, logCatcher.String(), "Error deactivating enrolment code abc1234:")
-}
-
-func TestPatchRespondentsByIDReturns400IfPassedANonUUID(t *testing.T) {
-	setDefaults()
-	setup()
-
-	req := httptest.NewRequest("PATCH", "/v2/respondents/abc123", nil)
-	req.SetBasicAuth("admin", "secret")
-	router.ServeHTTP(resp, req)
-
-	var errResp models.Error
-	err := json.NewDecoder(resp.Body).Decode(&errResp)
-	if err != nil {
-		t.Fatal("Error decoding JSON response from 'PATCH /respondents/{id}', ", err.Error())
-	}
-
-	assert.Equal(t, http.StatusBadRequest, resp.Code)
-	assert.Equal(t, "Not a valid ID: abc123", errResp.Error)
-}
-
-func TestPatchRespondentsByIDReturns400IfBadJSON(t *testing.T) {
-	setDefaults()
-	setup()
-
-	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", strings.NewReader("{nonsense: true}"))
-	req.SetBasicAuth("admin", "secret")
-	router.ServeHTTP(resp, req)
-
-	var errResp models.Error
-	err := json.NewDecoder(resp.Body).Decode(&errResp)
-	if err != nil {
-		t.Fatal("Error decoding JSON response from 'PATCH /respondents/{id}', ", err.Error())
-	}
-
-	assert.Equal(t, http.StatusBadRequest, resp.Code)
-	assert.Equal(t, "Invalid JSON", errResp.Error)
-}
-
-func TestPatchRespondentsByIDReturns400IfIDChanged(t *testing.T) {
-	setDefaults()
-	setup()
-
-	idChangePatchReq := models.PostRespondents{
-		Data: models.Respondent{
-			Attributes: models.Attributes{
-				EmailAddress: "bob@boblaw.com",
-				FirstName:    "Bob",
-				LastName:     "Boblaw",
-				Telephone:    "01234567890",
-				ID:           "aaaaaaaa-7bbc-461c-a565-5b454d748a71",
+				ID:           "aaaaaaaa-7bbc-461c-a565-5b454d748a71",
 			},
 			Status: "ACTIVE",
 		},
@@ -2829,6 +2603,7 @@ func TestPatchRespondentsByIDReturns400IfBadRespondentStatus(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectRollback()
 	mock.ExpectClose()
@@ -2873,8 +2648,7 @@ func TestPatchRespondentsByIDReturns404IfRespondentNotFound(t *testing.T) {
 		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
 	}
 
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(sqlmock.NewRows(searchRespondentForPatchingQueryColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(sqlmock.NewRows([]string{"id"}))
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -2910,14 +2684,8 @@ func TestPatchRespondentsByIDReturns404IfEnrolmentCodeNotFound(t *testing.T) {
 
 	gock.New("http://localhost:8121").Get("/iacs/abc1234").Reply(404)
 
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectRollback()
+	// The enrolment code is resolved before the transaction is started, so nothing's changed when it can't be
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -2961,14 +2729,8 @@ func TestPatchRespondentsByIDReturns404IfCaseNotFound(t *testing.T) {
 
 	gock.New("http://localhost:8171").Get("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb").Reply(404)
 
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectRollback()
+	// The enrolment code is resolved before the transaction is started, so nothing's changed when it can't be
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -3021,14 +2783,8 @@ func TestPatchRespondentsByIDReturns404IfCollectionExerciseNotFound(t *testing.T
 
 	gock.New("http://localhost:8145").Get("/collectionexercises/1010b2f2-8668-498a-afee-3c33cdfe42ea").Reply(404)
 
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectRollback()
+	// The enrolment code is resolved before the transaction is started, so nothing's changed when it can't be
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -3092,8 +2848,10 @@ func TestPatchRespondentsByIDReturns404IfEnrolmentCouldntBeFoundFromJSON(t *test
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3108,6 +2866,7 @@ func TestPatchRespondentsByIDReturns404IfEnrolmentCouldntBeFoundFromJSON(t *test
 		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234")
 	mock.ExpectPrepare(updateQueryRegex).ExpectExec().WithArgs("DISABLED", "be70e086-7bbc-461c-a565-5b454d748a71", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
 		"c43cafd8-ece0-410f-9887-0b0b5eb681fb").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectRollback()
@@ -3131,6 +2890,7 @@ func TestPatchRespondentsByIDReturns404IfEnrolmentCouldntBeFoundFromJSON(t *test
 func TestPatchRespondentsByIDReturns409IfEmailNotUnique(t *testing.T) {
 	setDefaults()
 	setup()
+	defer gock.Off()
 	var err error
 	var mock sqlmock.Sqlmock
 
@@ -3147,8 +2907,12 @@ func TestPatchRespondentsByIDReturns409IfEmailNotUnique(t *testing.T) {
 	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
 	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
 
+	mockPatchReqEnrolmentCode()
+
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("1"))
 	mock.ExpectClose()
 
@@ -3169,6 +2933,7 @@ func TestPatchRespondentsByIDReturns409IfEmailNotUnique(t *testing.T) {
 func TestPatchRespondentsByIDReturns422IfUpdateRespondentPreparedStatementFails(t *testing.T) {
 	setDefaults()
 	setup()
+	defer gock.Off()
 	var err error
 	var mock sqlmock.Sqlmock
 
@@ -3185,8 +2950,12 @@ func TestPatchRespondentsByIDReturns422IfUpdateRespondentPreparedStatementFails(
 	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
 	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
 
+	mockPatchReqEnrolmentCode()
+
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnError(fmt.Errorf("Connection refused"))
 	mock.ExpectRollback()
@@ -3230,14 +2999,8 @@ func TestPatchRespondentsByIDReturns422IfEnrolmentCodeInactive(t *testing.T) {
 		CaseID:      "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
 		QuestionSet: "H1"})
 
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectRollback()
+	// The enrolment code is resolved before the transaction is started, so nothing's changed when it can't be
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -3298,8 +3061,10 @@ func TestPatchRespondentsByIDReturns422IfBusinessNotFoundToAssociate(t *testing.
 	businessRespondentRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRespondentRows.AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3369,8 +3134,10 @@ func TestPatchRespondentsByIDReturns422IfBusinessRespondentCouldntBeInserted(t *
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3440,8 +3207,10 @@ func TestPatchRespondentsByIDReturns422IfBusinessRespondentCouldntBeCommitted(t
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3512,8 +3281,10 @@ func TestPatchRespondentsByIDReturns422IfEnrolmentCouldntBeInsertedForIAC(t *tes
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3588,8 +3359,10 @@ func TestPatchRespondentsByIDReturns422IfPendingEnrolmentCouldntBeInserted(t *te
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3666,8 +3439,10 @@ func TestPatchRespondentsByIDReturns422IfEnrolmentCouldntBeCommitted(t *testing.
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3745,8 +3520,10 @@ func TestPatchRespondentsByIDReturns422IfPendingEnrolmentCouldntBeCommitted(t *t
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3825,8 +3602,10 @@ func TestPatchRespondentsByIDReturns422IfEnrolmentCouldntBeUpdatedFromJSON(t *te
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -3841,6 +3620,7 @@ func TestPatchRespondentsByIDReturns422IfEnrolmentCouldntBeUpdatedFromJSON(t *te
 		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234")
 	mock.ExpectPrepare(updateQueryRegex).ExpectExec().WithArgs("DISABLED", "be70e086-7bbc-461c-a565-5b454d748a71", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
 		"c43cafd8-ece0-410f-9887-0b0b5eb681fb").WillReturnError(fmt.Errorf("Foreign key violation"))
 	mock.ExpectRollback()
@@ -3890,6 +3670,7 @@ func TestPatchRespondentsByIDReturns500WhenDBNotInit(t *testing.T) {
 func TestPatchRespondentsByIDReturns500IfDBTransactionCouldntBegin(t *testing.T) {
 	setDefaults()
 	setup()
+	defer gock.Off()
 	var err error
 	var mock sqlmock.Sqlmock
 
@@ -3903,6 +3684,9 @@ func TestPatchRespondentsByIDReturns500IfDBTransactionCouldntBegin(t *testing.T)
 		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
 	}
 
+	mockPatchReqEnrolmentCode()
+
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin().WillReturnError(fmt.Errorf("Transaction failed"))
 	mock.ExpectClose()
 
@@ -3923,6 +3707,7 @@ func TestPatchRespondentsByIDReturns500IfDBTransactionCouldntBegin(t *testing.T)
 func TestPatchRespondentsByIDReturns500IfRetrievingRespondentFails(t *testing.T) {
 	setDefaults()
 	setup()
+	defer gock.Off()
 	var err error
 	var mock sqlmock.Sqlmock
 
@@ -3936,6 +3721,9 @@ func TestPatchRespondentsByIDReturns500IfRetrievingRespondentFails(t *testing.T)
 		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
 	}
 
+	mockPatchReqEnrolmentCode()
+
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnError(fmt.Errorf("Connection refused"))
 	mock.ExpectClose()
@@ -3957,6 +3745,7 @@ func TestPatchRespondentsByIDReturns500IfRetrievingRespondentFails(t *testing.T)
 func TestPatchRespondentsByIDReturns500IfCheckingEmailUniquenessFails(t *testing.T) {
 	setDefaults()
 	setup()
+	defer gock.Off()
 	var err error
 	var mock sqlmock.Sqlmock
 
@@ -3973,8 +3762,12 @@ func TestPatchRespondentsByIDReturns500IfCheckingEmailUniquenessFails(t *testing
 	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
 	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
 
+	mockPatchReqEnrolmentCode()
+
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnError(fmt.Errorf("Connection refused"))
 	mock.ExpectClose()
 
@@ -4010,16 +3803,10 @@ func TestPatchRespondentsByIDReturns500IfIACCommunicationsFail(t *testing.T) {
 		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
 	}
 
-	gock.New("http://iac-service").Get("/").Reply(200)
-
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectRollback()
+	gock.New("http://iac-service").Get("/").Reply(200)
+
+	// The enrolment code is resolved before the transaction is started, so nothing's changed when it can't be
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -4063,14 +3850,8 @@ func TestPatchRespondentsByIDReturns500IfCaseCommunicationsFail(t *testing.T) {
 
 	gock.New("http://case-service").Get("/").Reply(200)
 
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectRollback()
+	// The enrolment code is resolved before the transaction is started, so nothing's changed when it can't be
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -4123,14 +3904,8 @@ func TestPatchRespondentsByIDReturns500IfCollectionExerciseCommunicationsFail(t
 
 	gock.New("collection-exercise-service").Get("/").Reply(200)
 
-	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
-	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
-
-	mock.ExpectBegin()
-	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
-	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
-	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectRollback()
+	// The enrolment code is resolved before the transaction is started, so nothing's changed when it can't be
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectClose()
 
 	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
@@ -4187,8 +3962,10 @@ func TestPatchRespondentsByIDReturns500IfRetrievingBusinessRespondentsFails(t *t
 	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
 	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnError(fmt.Errorf("Connection refused"))
@@ -4253,8 +4030,10 @@ func TestPatchRespondentsByIDReturns500IfRetrievingBusinessesFails(t *testing.T)
 	businessRespondentRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRespondentRows.AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -4322,8 +4101,10 @@ func TestPatchRespondentsByIDReturns500IfInsertBusinessRespondentPreparedStateme
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -4393,8 +4174,10 @@ func TestPatchRespondentsByIDReturns500IfInsertEnrolmentFromIACPreparedStatement
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -4466,8 +4249,10 @@ func TestPatchRespondentsByIDReturns500IfInsertPendingEnrolmentPreparedStatement
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -4540,8 +4325,10 @@ func TestPatchRespondentsByIDReturns500IfInsertEnrolmentFromJSONPreparedStatemen
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -4556,6 +4343,7 @@ func TestPatchRespondentsByIDReturns500IfInsertEnrolmentFromJSONPreparedStatemen
 		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234")
 	mock.ExpectPrepare(updateQueryRegex).WillReturnError(fmt.Errorf("Syntax error"))
 	mock.ExpectRollback()
 	mock.ExpectClose()
@@ -4621,8 +4409,10 @@ func TestPatchRespondentsByIDReturns500IfCommitFails(t *testing.T) {
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -4637,8 +4427,11 @@ func TestPatchRespondentsByIDReturns500IfCommitFails(t *testing.T) {
 		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234")
 	mock.ExpectPrepare(updateQueryRegex).ExpectExec().WithArgs("DISABLED", "be70e086-7bbc-461c-a565-5b454d748a71", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
 		"c43cafd8-ece0-410f-9887-0b0b5eb681fb").WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.RespondentEmailChanged)
+	expectAuditEntry(mock, store.AuditUpdate)
 	mock.ExpectCommit().WillReturnError(fmt.Errorf("Table locked"))
 	mock.ExpectRollback()
 	mock.ExpectClose()
@@ -4695,8 +4488,6 @@ func TestPatchRespondentsByIDReturns500IfGetNewRespondentStateFails(t *testing.T
 		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
 	})
 
-	gock.New("http://localhost:8121").Put("/abc1234").Reply(200)
-
 	respondentRows := mock.NewRows(searchRespondentForPatchingQueryColumns)
 	respondentRows.AddRow("be70e086-7bbc-461c-a565-5b454d748a71", "bob@boblaw.com")
 
@@ -4706,8 +4497,10 @@ func TestPatchRespondentsByIDReturns500IfGetNewRespondentStateFails(t *testing.T
 	businessRows := mock.NewRows(searchBusinessRespondentsQueryColumns)
 	businessRows.AddRow("aaaaaaaa-ae27-45c6-ab0f-c8cd9a48ebc2")
 
+	expectRespondentExists(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectBegin()
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(respondentRows)
+	expectAuditedRespondent(mock, "be70e086-7bbc-461c-a565-5b454d748a71")
 	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("0"))
 	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectQuery(selectQueryRegex).WithArgs("be70e086-7bbc-461c-a565-5b454d748a71").WillReturnRows(businessRespondentRows)
@@ -4722,8 +4515,11 @@ func TestPatchRespondentsByIDReturns500IfGetNewRespondentStateFails(t *testing.T
 		AnyUUID{}, AnyTime{}).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDeactivationOutboxEntries(mock, "abc1234")
 	mock.ExpectPrepare(updateQueryRegex).ExpectExec().WithArgs("DISABLED", "be70e086-7bbc-461c-a565-5b454d748a71", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
 		"c43cafd8-ece0-410f-9887-0b0b5eb681fb").WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEventOutboxEntries(mock, events.RespondentEmailChanged)
+	expectAuditEntry(mock, store.AuditUpdate)
 	mock.ExpectCommit()
 	mock.ExpectQuery(selectQueryRegex).WillReturnError(fmt.Errorf("Connection refused"))
 	mock.ExpectClose()
@@ -4742,3 +4538,437 @@ func TestPatchRespondentsByIDReturns500IfGetNewRespondentStateFails(t *testing.T
 	assert.Equal(t, "Update complete. Error querying DB for new respondent state: Connection refused", errResp.Error)
 	assert.True(t, gock.IsDone())
 }
+
+// Behaviour against the in-memory store
+
+// Mocks the services behind enrolment code abc1234, which enrols on a survey for business ba02fad7-...
+func mockEnrolmentCode() {
+	gock.New("http://localhost:8121").Get("/iacs/abc1234").Reply(200).JSON(models.IAC{
+		IAC:    "abc1234",
+		Active: true,
+		CaseID: "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb"})
+
+	gock.New("http://localhost:8171").Get("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb").Reply(200).JSON(models.Case{
+		ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+		CaseGroup: models.CaseGroup{
+			ID:                   "aa9c8e93-5cd9-4876-a2d3-78a87b972134",
+			CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea",
+		},
+	})
+
+	gock.New("http://localhost:8145").Get("/collectionexercises/1010b2f2-8668-498a-afee-3c33cdfe42ea").Reply(200).JSON(models.CollectionExercise{
+		ID:       "1010b2f2-8668-498a-afee-3c33cdfe42ea",
+		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
+	})
+
+}
+
+func TestRespondentLifecycleWithMemoryStore(t *testing.T) {
+	setup()
+	defer gock.Off()
+	memory := useMemoryStore(t)
+	memory.CreateBusiness(context.Background(), models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001"})
+
+	mockEnrolmentCode()
+	jsonOut, err := json.Marshal(postReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/respondents", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.True(t, gock.IsDone())
+
+	resp = httptest.NewRecorder()
+	jsonOut, err = json.Marshal(models.PostRespondents{Data: models.Respondent{
+		Attributes: models.Attributes{Telephone: "09876543210"},
+		Associations: []models.Association{{
+			ID:         "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+			Enrolments: []models.Enrolment{{SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831", EnrolmentStatus: "ENABLED"}},
+		}},
+	}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
+	}
+	req = httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/respondents?surveyId=0752a892-1a60-40a4-8aa3-2599405a8831", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var respondents models.Respondents
+	err = json.NewDecoder(resp.Body).Decode(&respondents)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /respondents', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, len(respondents.Data))
+	assert.Equal(t, "09876543210", respondents.Data[0].Attributes.Telephone)
+	assert.Equal(t, "ENABLED", respondents.Data[0].Associations[0].Enrolments[0].EnrolmentStatus)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestPostRespondentsReturns422IfBusinessMissingWithMemoryStore(t *testing.T) {
+	setup()
+	defer gock.Off()
+	useMemoryStore(t)
+
+	mockEnrolmentCode()
+	jsonOut, err := json.Marshal(postReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/respondents", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /respondents', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Equal(t, "Can't associate with the business for enrolment code: abc1234", errResp.Error)
+}
+
+func TestPatchRespondentsByIDReturns404IfRespondentNotFoundWithMemoryStore(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	jsonOut, err := json.Marshal(patchReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
+	}
+	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'PATCH /respondents/{id}', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Respondent does not exist", errResp.Error)
+}
+
+func addFakeEnrolmentCode(services *clientstest.Server) {
+	services.AddIAC(models.IAC{IAC: "abc1234", Active: true, CaseID: "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb"})
+	services.AddCase(models.Case{
+		ID:         "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+		BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+		CaseGroup:  models.CaseGroup{CollectionExerciseID: "1010b2f2-8668-498a-afee-3c33cdfe42ea"},
+	})
+	services.AddCollectionExercise(models.CollectionExercise{
+		ID:       "1010b2f2-8668-498a-afee-3c33cdfe42ea",
+		SurveyID: "0752a892-1a60-40a4-8aa3-2599405a8831",
+	})
+}
+
+func TestPostRespondentsDeactivatesEnrolmentCodeThroughOutbox(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+	memory.CreateBusiness(context.Background(), models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001"})
+	services := useFakeServices(t)
+	addFakeEnrolmentCode(services)
+
+	jsonOut, err := json.Marshal(postReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/respondents", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Empty(t, services.Deactivated())
+
+	publisher := events.NewMemory()
+	dispatched, err := newOutboxDispatcher(memory, memory, publisher).DispatchDue(context.Background())
+	assert.Nil(t, err)
+	// The business's and respondent's events are each published and passed on to the webhooks
+	assert.Equal(t, 5, dispatched)
+	assert.Equal(t, []string{"abc1234"}, services.Deactivated())
+	assert.Equal(t, 2, len(publisher.Events()))
+	assert.Equal(t, events.BusinessCreated, publisher.Events()[0].Type)
+	assert.Equal(t, events.RespondentCreated, publisher.Events()[1].Type)
+}
+
+func TestPostRespondentsEnrolsOnceForRepeatedEnrolmentCode(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+	memory.CreateBusiness(context.Background(), models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001"})
+	services := useFakeServices(t)
+	addFakeEnrolmentCode(services)
+
+	repeated := postReq
+	repeated.EnrolmentCodes = []string{"abc1234", "abc1234"}
+	jsonOut, err := json.Marshal(repeated)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/respondents", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	respondent, err := memory.GetRespondent(context.Background(), postReq.Data.Attributes.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(respondent.Associations))
+	assert.Equal(t, 1, len(respondent.Associations[0].Enrolments))
+}
+
+func TestPostRespondentsReturns500IfCaseServiceFailsWithFakeServices(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+	services := useFakeServices(t)
+	addFakeEnrolmentCode(services)
+	services.Fail("/cases/7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb", http.StatusBadGateway)
+
+	jsonOut, err := json.Marshal(postReq)
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /respondents', ", err.Error())
+	}
+	req := httptest.NewRequest("POST", "/v2/respondents", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /respondents', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Couldn't communicate with Case service: Received status code 502", errResp.Error)
+	assert.Empty(t, services.Deactivated())
+}
+
+// Adds enrolment codes code0, code1, ... to the fake services, each for a different business
+func addFakeEnrolmentCodes(services *clientstest.Server, count int) []string {
+	codes := []string{}
+	for idx := 0; idx < count; idx++ {
+		code := "code" + strconv.Itoa(idx)
+		services.AddIAC(models.IAC{IAC: code, Active: true, CaseID: "case-" + code})
+		services.AddCase(models.Case{ID: "case-" + code, BusinessID: "business-" + code, CaseGroup: models.CaseGroup{CollectionExerciseID: "collex-" + code}})
+		services.AddCollectionExercise(models.CollectionExercise{ID: "collex-" + code, SurveyID: "survey-" + code})
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+func TestConvertIACsToEnrolmentsIsBoundedAndOrdered(t *testing.T) {
+	setup()
+	services := useFakeServices(t)
+	codes := addFakeEnrolmentCodes(services, 8)
+	services.SetDelay(20 * time.Millisecond)
+	viper.Set("enrolment_lookup_concurrency", 3)
+	defer viper.Set("enrolment_lookup_concurrency", 5)
+
+	enrolments, err := convertIACsToEnrolments(context.Background(), codes)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, services.MaxInFlight())
+	for idx, enrolment := range enrolments {
+		assert.Equal(t, codes[idx], enrolment.Code)
+		assert.Equal(t, "business-"+codes[idx], enrolment.BusinessID)
+		assert.Equal(t, "survey-"+codes[idx], enrolment.SurveyID)
+	}
+}
+
+func TestConvertIACsToEnrolmentsLooksUpRepeatedCodesOnce(t *testing.T) {
+	setup()
+	services := useFakeServices(t)
+	codes := addFakeEnrolmentCodes(services, 2)
+	services.SetDelay(20 * time.Millisecond)
+
+	enrolments, err := convertIACsToEnrolments(context.Background(), []string{codes[0], codes[1], codes[0]})
+
+	assert.Nil(t, err)
+	// Were the repeat looked up separately, it'd be in flight alongside the others
+	assert.Equal(t, 2, services.MaxInFlight())
+	assert.Equal(t, 2, len(enrolments))
+	assert.Equal(t, codes[0], enrolments[0].Code)
+	assert.Equal(t, codes[1], enrolments[1].Code)
+}
+
+func TestConvertIACsToEnrolmentsTracesEachLookup(t *testing.T) {
+	setup()
+	services := useFakeServices(t)
+	codes := addFakeEnrolmentCodes(services, 2)
+	recorder := tracetest.NewSpanRecorder()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, err := convertIACsToEnrolments(context.Background(), codes)
+
+	assert.Nil(t, err)
+	lookups := map[trace.SpanID]int{}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "Resolve enrolment code" {
+			lookups[span.SpanContext().SpanID()] = 0
+		}
+	}
+	assert.Equal(t, 2, len(lookups))
+	for _, span := range recorder.Ended() {
+		if span.Name() != "Resolve enrolment code" {
+			lookups[span.Parent().SpanID()]++
+		}
+	}
+	for _, calls := range lookups {
+		assert.Equal(t, 3, calls)
+	}
+}
+
+func TestConvertIACsToEnrolmentsReportsFirstFailingCode(t *testing.T) {
+	setup()
+	services := useFakeServices(t)
+	codes := addFakeEnrolmentCodes(services, 6)
+	services.Fail("/iacs/code4", http.StatusNotFound)
+	services.Fail("/collectionexercises/collex-code2", http.StatusNotFound)
+
+	for attempt := 0; attempt < 10; attempt++ {
+		_, err := convertIACsToEnrolments(context.Background(), codes)
+
+		var codeErr *enrolmentCodeError
+		assert.True(t, errors.As(err, &codeErr))
+		assert.Equal(t, http.StatusNotFound, codeErr.status)
+		assert.Equal(t, "Collection Exercise not found for enrolment code: code2", codeErr.message)
+	}
+}
+
+func TestConvertIACsToEnrolmentsStopsWhenCancelled(t *testing.T) {
+	setup()
+	services := useFakeServices(t)
+	codes := addFakeEnrolmentCodes(services, 4)
+	services.SetDelay(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := convertIACsToEnrolments(ctx, codes)
+
+	var codeErr *enrolmentCodeError
+	assert.True(t, errors.As(err, &codeErr))
+	assert.Equal(t, http.StatusInternalServerError, codeErr.status)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+// GET /respondents/{id}/history
+
+func TestGetRespondentHistory(t *testing.T) {
+	memory := useMemoryStore(t)
+	useClients(t,
+		auth.ClientConfig{Name: "support-tool", User: "support", Password: "support-secret", Scopes: []string{auth.WriteRespondents}},
+		auth.ClientConfig{Name: "auditor", User: "auditor", Password: "auditor-secret", Scopes: []string{auth.ReadHistory}},
+	)
+	memory.CreateRespondent(store.WithActor(context.Background(), "frontstage"), models.Attributes{
+		ID:           "be70e086-7bbc-461c-a565-5b454d748a71",
+		EmailAddress: "bob@boblaw.com",
+		FirstName:    "Bob",
+		LastName:     "Boblaw",
+	}, nil)
+
+	jsonOut, err := json.Marshal(models.PostRespondents{Data: models.Respondent{Attributes: models.Attributes{Telephone: "09876543210"}}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
+	}
+	req := httptest.NewRequest("PATCH", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("support", "support-secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71/history", nil)
+	req.SetBasicAuth("auditor", "auditor-secret")
+	router.ServeHTTP(resp, req)
+
+	var history models.AuditEntries
+	err = json.NewDecoder(resp.Body).Decode(&history)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /respondents/{id}/history', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 2, len(history.Data))
+	assert.Equal(t, "frontstage", history.Data[0].Actor)
+	assert.Equal(t, store.AuditCreate, history.Data[0].Action)
+	assert.Equal(t, "support-tool", history.Data[1].Actor)
+	assert.Equal(t, store.AuditUpdate, history.Data[1].Action)
+	assert.Contains(t, string(history.Data[1].Before), `"telephone":""`)
+	assert.Contains(t, string(history.Data[1].After), `"telephone":"09876543210"`)
+}
+
+func TestGetRespondentHistoryReturns400IfPassedANonUUID(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/respondents/not-a-uuid/history", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /respondents/{id}/history', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Not a valid ID: not-a-uuid", errResp.Error)
+}
+
+func TestGetRespondentHistoryReturns404WhenNoHistory(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71/history", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /respondents/{id}/history', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "No history found for respondent ID be70e086-7bbc-461c-a565-5b454d748a71", errResp.Error)
+}
+
+func TestGetRespondentHistoryReturns500WhenDBNotInit(t *testing.T) {
+	setup()
+	db = nil
+
+	req := httptest.NewRequest("GET", "/v2/respondents/be70e086-7bbc-461c-a565-5b454d748a71/history", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /respondents/{id}/history', ", err.Error())
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "Database connection could not be found", errResp.Error)
+}
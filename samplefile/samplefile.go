@@ -0,0 +1,201 @@
+// Package samplefile reads the businesses in a sample file, as a CSV file with a header row naming the sample
+// attributes in its columns, or as newline-delimited JSON with one object of sample attributes per line. Problems with
+// single rows are reported against them, so that the rest of the file can still be loaded.
+package samplefile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+)
+
+// The formats a sample file can be in
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+// The longest line of an NDJSON sample file which can be read
+const maxLineBytes = 1 << 20
+
+// Row is a business read from a sample file. Rows are numbered from 1, by record in a CSV file not counting its header,
+// and by line in an NDJSON file.
+type Row struct {
+	Number     int
+	Attributes models.SampleAttributes
+}
+
+// Read returns the rows of the sample file which could be read, and an error for each which couldn't. An error is
+// returned instead if the file as a whole can't be read, e.g. because its header names a column which isn't a sample
+// attribute.
+func Read(r io.Reader, format string) ([]Row, []models.BusinessLoadError, error) {
+	var rows []Row
+	var rowErrors []models.BusinessLoadError
+	var err error
+	switch format {
+	case CSV:
+		rows, rowErrors, err = readCSV(r)
+	case NDJSON:
+		rows, rowErrors, err = readNDJSON(r)
+	default:
+		return nil, nil, fmt.Errorf("unsupported sample file format %q", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	valid := []Row{}
+	firstSeen := map[string]int{}
+	for _, row := range rows {
+		if msg := validate(row.Attributes); msg != "" {
+			rowErrors = append(rowErrors, models.BusinessLoadError{Row: row.Number, RURef: row.Attributes.RURef, Error: msg})
+			continue
+		}
+		if first, ok := firstSeen[row.Attributes.RURef]; ok {
+			rowErrors = append(rowErrors, models.BusinessLoadError{
+				Row:   row.Number,
+				RURef: row.Attributes.RURef,
+				Error: fmt.Sprintf("Duplicate ruref %s, first seen on row %d", row.Attributes.RURef, first),
+			})
+			continue
+		}
+		firstSeen[row.Attributes.RURef] = row.Number
+		valid = append(valid, row)
+	}
+	// Parse errors are found before validation ones
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+	return valid, rowErrors, nil
+}
+
+// Returns the problem with the attributes in a row, or an empty string if there isn't one
+func validate(attributes models.SampleAttributes) string {
+	missingFields := []string{}
+	if attributes.RURef == "" {
+		missingFields = append(missingFields, "ruref")
+	}
+	if attributes.RUName1 == "" {
+		missingFields = append(missingFields, "runame1")
+	}
+	if len(missingFields) > 0 {
+		return "Missing required fields: " + strings.Join(missingFields, ", ")
+	}
+	return ""
+}
+
+// Returns the index of the SampleAttributes field for each of its JSON names
+func attributeFields() map[string]int {
+	fields := map[string]int{}
+	t := reflect.TypeOf(models.SampleAttributes{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		fields[name] = i
+	}
+	return fields
+}
+
+func readCSV(r io.Reader) ([]Row, []models.BusinessLoadError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("sample file is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields := attributeFields()
+	columns := make([]int, len(header))
+	unknown := []string{}
+	for i, name := range header {
+		field, ok := fields[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			unknown = append(unknown, name)
+		}
+		columns[i] = field
+	}
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("unknown columns in sample file: %s", strings.Join(unknown, ", "))
+	}
+
+	rows := []Row{}
+	rowErrors := []models.BusinessLoadError{}
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+				rowErrors = append(rowErrors, models.BusinessLoadError{
+					Row:   number,
+					Error: fmt.Sprintf("Wrong number of fields: expected %d, got %d", len(header), len(record)),
+				})
+				continue
+			}
+			return nil, nil, err
+		}
+
+		var attributes models.SampleAttributes
+		value := reflect.ValueOf(&attributes).Elem()
+		rowErr := ""
+		for i, column := range record {
+			field := value.Field(columns[i])
+			column = strings.TrimSpace(column)
+			if field.Kind() != reflect.Int {
+				field.SetString(column)
+				continue
+			}
+			if column == "" {
+				continue
+			}
+			n, err := strconv.Atoi(column)
+			if err != nil {
+				rowErr = fmt.Sprintf("Not a valid number in %s: %s", header[i], column)
+				break
+			}
+			field.SetInt(int64(n))
+		}
+		if rowErr != "" {
+			rowErrors = append(rowErrors, models.BusinessLoadError{Row: number, RURef: attributes.RURef, Error: rowErr})
+			continue
+		}
+		rows = append(rows, Row{Number: number, Attributes: attributes})
+	}
+	return rows, rowErrors, nil
+}
+
+func readNDJSON(r io.Reader) ([]Row, []models.BusinessLoadError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+
+	rows := []Row{}
+	rowErrors := []models.BusinessLoadError{}
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var attributes models.SampleAttributes
+		if err := json.Unmarshal([]byte(line), &attributes); err != nil {
+			rowErrors = append(rowErrors, models.BusinessLoadError{Row: number, Error: "Invalid JSON: " + err.Error()})
+			continue
+		}
+		rows = append(rows, Row{Number: number, Attributes: attributes})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rows, rowErrors, nil
+}
@@ -0,0 +1,78 @@
+package samplefile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCSV(t *testing.T) {
+	file := "ruref,RUNAME1,runame2,tradstyle1,froempment,cell_no\n" +
+		"49900000001,Acme,Holdings,Acme Trading,50,\n" +
+		"49900000002,\"Widgets, Ltd\",,,,1\n"
+
+	rows, rowErrors, err := Read(strings.NewReader(file), CSV)
+
+	assert.Nil(t, err)
+	assert.Empty(t, rowErrors)
+	assert.Equal(t, []Row{
+		{Number: 1, Attributes: models.SampleAttributes{RURef: "49900000001", RUName1: "Acme", RUName2: "Holdings", TradStyle1: "Acme Trading", FroEmpment: 50}},
+		{Number: 2, Attributes: models.SampleAttributes{RURef: "49900000002", RUName1: "Widgets, Ltd", CellNo: 1}},
+	}, rows)
+}
+
+func TestReadCSVReportsBadRows(t *testing.T) {
+	file := "ruref,runame1,froempment\n" +
+		"49900000001,Acme,50\n" +
+		"49900000002,Widgets\n" +
+		"49900000003,,10\n" +
+		"49900000004,Gadgets,lots\n" +
+		"49900000001,Acme again,5\n"
+
+	rows, rowErrors, err := Read(strings.NewReader(file), CSV)
+
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, []models.BusinessLoadError{
+		{Row: 2, Error: "Wrong number of fields: expected 3, got 2"},
+		{Row: 3, RURef: "49900000003", Error: "Missing required fields: runame1"},
+		{Row: 4, RURef: "49900000004", Error: "Not a valid number in froempment: lots"},
+		{Row: 5, RURef: "49900000001", Error: "Duplicate ruref 49900000001, first seen on row 1"},
+	}, rowErrors)
+}
+
+func TestReadCSVRejectsUnknownColumns(t *testing.T) {
+	_, _, err := Read(strings.NewReader("ruref,runame1,colour\n49900000001,Acme,blue\n"), CSV)
+
+	assert.EqualError(t, err, "unknown columns in sample file: colour")
+}
+
+func TestReadCSVRejectsEmptyFile(t *testing.T) {
+	_, _, err := Read(strings.NewReader(""), CSV)
+
+	assert.EqualError(t, err, "sample file is empty")
+}
+
+func TestReadNDJSON(t *testing.T) {
+	file := `{"ruref":"49900000001","runame1":"Acme","froempment":50}` + "\n" +
+		"\n" +
+		`{"ruref":"49900000002","runame1":` + "\n" +
+		`{"ruref":"49900000003"}` + "\n"
+
+	rows, rowErrors, err := Read(strings.NewReader(file), NDJSON)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Row{{Number: 1, Attributes: models.SampleAttributes{RURef: "49900000001", RUName1: "Acme", FroEmpment: 50}}}, rows)
+	assert.Equal(t, []models.BusinessLoadError{
+		{Row: 3, Error: "Invalid JSON: unexpected end of JSON input"},
+		{Row: 4, RURef: "49900000003", Error: "Missing required fields: runame1"},
+	}, rowErrors)
+}
+
+func TestReadRejectsUnknownFormat(t *testing.T) {
+	_, _, err := Read(strings.NewReader(""), "xml")
+
+	assert.EqualError(t, err, `unsupported sample file format "xml"`)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+)
+
+// The key a request's context holds the connection it was received on under
+type connContextKey struct{}
+
+func newServer(r http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           r,
+		Addr:              ":" + viper.GetString("port"),
+		ReadTimeout:       viper.GetDuration("server_read_timeout"),
+		ReadHeaderTimeout: viper.GetDuration("server_read_header_timeout"),
+		WriteTimeout:      viper.GetDuration("server_write_timeout"),
+		IdleTimeout:       viper.GetDuration("server_idle_timeout"),
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey{}, c)
+		},
+	}
+}
+
+// Gives requests for a route whose bodies take longer to send than most until timeout after they reach the handler
+// to be read and responded to, in place of the server's read and write timeouts. It sets the deadlines of the
+// request's connection, so only applies to HTTP/1 requests; HTTP/2 requests share their connection, so keep the
+// server's timeouts.
+func extendDeadline(h httprouter.Handle, timeout time.Duration) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if conn, ok := r.Context().Value(connContextKey{}).(net.Conn); ok && r.ProtoMajor == 1 {
+			deadline := time.Now().Add(timeout)
+			conn.SetReadDeadline(deadline)
+			conn.SetWriteDeadline(deadline)
+		}
+		h(w, r, ps)
+	}
+}
+
+// Serves HTTP on the listener until the context is cancelled, then stops accepting connections and waits up to the
+// timeout for the requests in flight to finish. HTTPS is served instead if a certificate and key are given.
+func serve(ctx context.Context, srv *http.Server, listener net.Listener, certFile, keyFile string, timeout time.Duration) error {
+	served := make(chan error, 1)
+	go func() {
+		if certFile != "" || keyFile != "" {
+			served <- srv.ServeTLS(listener, certFile, keyFile)
+		} else {
+			served <- srv.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	logging.Logger().Info("Shutting down Party service...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// Rejects requests with a body of more than max bytes. Bodies are streamed to the handler rather than read up front, so
+// one which declares a larger length is rejected before the handler runs, and one which turns out to be larger as it's
+// read gets a 413 response in place of whatever the handler responds with after failing to read it.
+func limitBody(h httprouter.Handle, max int64) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if r.Body == nil || r.Body == http.NoBody {
+			h(w, r, ps)
+			return
+		}
+
+		if r.ContentLength > max {
+			writeBodyTooLarge(w, max)
+			return
+		}
+
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = http.MaxBytesReader(w, body, max)
+		h(&bodyLimitWriter{ResponseWriter: w, body: body, max: max}, r, ps)
+	}
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, max int64) {
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	errorString := models.Error{
+		Error: "Request body must be no more than " + strconv.FormatInt(max, 10) + " bytes",
+	}
+	json.NewEncoder(w).Encode(errorString)
+}
+
+// A request body which counts how much of it has been read
+type countingBody struct {
+	io.ReadCloser
+	read int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+// Replaces the response with a 413 if the handler read more of the request body than it was allowed to, which
+// http.MaxBytesReader stops it doing by failing the read
+type bodyLimitWriter struct {
+	http.ResponseWriter
+	body     *countingBody
+	max      int64
+	written  bool
+	rejected bool
+}
+
+func (w *bodyLimitWriter) WriteHeader(status int) {
+	if w.written {
+		return
+	}
+	w.written = true
+	if w.body.read > w.max {
+		w.rejected = true
+		writeBodyTooLarge(w.ResponseWriter, w.max)
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *bodyLimitWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.rejected {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends what's been written so far, if the underlying writer can, so that handlers streaming a response still
+// can when their request body is limited
+func (w *bodyLimitWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController to find the connection's other features through
+func (w *bodyLimitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServer(t *testing.T) {
+	setDefaults()
+	router := httprouter.New()
+	srv := newServer(router)
+	assert.Equal(t, ":"+viper.GetString("port"), srv.Addr)
+	assert.Equal(t, 5*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 30*time.Second, srv.WriteTimeout)
+}
+
+// Serves a handler which waits to be released before responding, returning the server's address
+func serveBlockingHandler(t *testing.T, ctx context.Context, timeout time.Duration, started, release chan struct{}) (string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening, ", err.Error())
+	}
+	srv := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, srv, listener, "", "", timeout)
+	}()
+	return "http://" + listener.Addr().String(), served
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started, release := make(chan struct{}), make(chan struct{})
+	url, served := serveBlockingHandler(t, ctx, time.Second, started, release)
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post(url+"/v2/respondents", "application/json", nil)
+		assert.Nil(t, err)
+		responses <- resp
+	}()
+	<-started
+	cancel()
+
+	// New connections are refused while the request in flight finishes
+	assert.Eventually(t, func() bool {
+		_, err := http.Get(url + "/v2/info")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-served:
+		t.Fatal("Server stopped before the request in flight finished")
+	default:
+	}
+
+	close(release)
+	resp := <-responses
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Nil(t, <-served)
+}
+
+func TestServeGivesUpOnRequestsAfterTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	url, served := serveBlockingHandler(t, ctx, 20*time.Millisecond, started, release)
+
+	go http.Get(url + "/v2/respondents")
+	<-started
+	cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, <-served)
+}
+
+// Writes a self-signed certificate for 127.0.0.1 and its key to PEM files, returning their paths
+func writeCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Error generating key, ", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ras-rm-party"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Error creating certificate, ", err.Error())
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal("Error encoding key, ", err.Error())
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+	return certFile, keyFile
+}
+
+func TestServeTLS(t *testing.T) {
+	setDefaults()
+	certFile, keyFile := writeCertificate(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening, ", err.Error())
+	}
+	srv := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, srv, listener, certFile, keyFile, time.Second)
+	}()
+
+	pool := x509.NewCertPool()
+	certPEM, _ := ioutil.ReadFile(certFile)
+	pool.AppendCertsFromPEM(certPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/v2/info")
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, resp.TLS)
+	cancel()
+	assert.Nil(t, <-served)
+}
+
+func TestServeTLSWithMissingCertificate(t *testing.T) {
+	setDefaults()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening, ", err.Error())
+	}
+
+	err = serve(context.Background(), newServer(http.NewServeMux()), listener, "missing.crt", "missing.key", time.Second)
+
+	assert.NotNil(t, err)
+}
+
+// Echoes the size of the request body it was given
+func bodySize(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Write([]byte(strconv.Itoa(len(body))))
+}
+
+func TestLimitBodyAllowsBodyUpToLimit(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/respondents", strings.NewReader("0123456789"))
+
+	limitBody(bodySize, 10)(resp, req, nil)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "10", resp.Body.String())
+}
+
+func TestLimitBodyRejectsLargeBody(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/respondents", strings.NewReader("0123456789A"))
+
+	limitBody(bodySize, 10)(resp, req, nil)
+
+	var errResp models.Error
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /v2/respondents', ", err.Error())
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, "Request body must be no more than 10 bytes", errResp.Error)
+}
+
+func TestLimitBodyRejectsLargeBodyWithoutLength(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/respondents", bytes.NewBufferString("0123456789A"))
+	req.ContentLength = -1
+
+	limitBody(bodySize, 10)(resp, req, nil)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+}
+
+func TestLimitBodyReplacesHandlersResponseToLargeBody(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/respondents", bytes.NewBufferString(`{"data": {"attributes": {}}}`))
+	req.ContentLength = -1
+
+	limitBody(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"Invalid JSON"}`))
+		}
+	}, 10)(resp, req, nil)
+
+	var errResp models.Error
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /v2/respondents', ", err.Error())
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, "Request body must be no more than 10 bytes", errResp.Error)
+}
+
+func TestLimitBodyLetsHandlerFlush(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/respondents", strings.NewReader("0123456789"))
+
+	limitBody(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		flusher, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		w.Write([]byte("streamed"))
+		flusher.Flush()
+		assert.Equal(t, resp, w.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+	}, 10)(resp, req, nil)
+
+	assert.True(t, resp.Flushed)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "streamed", resp.Body.String())
+}
+
+func TestLargeBodyIsRejectedOnRoutes(t *testing.T) {
+	setup()
+	viper.Set("max_request_body_bytes", 16)
+	defer viper.Set("max_request_body_bytes", 1<<20)
+	router = httprouter.New()
+	addRoutes(router, businessLoads)
+
+	req := httptest.NewRequest(http.MethodPost, "/v2/respondents", strings.NewReader(`{"data": {"attributes": {}}}`))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+}
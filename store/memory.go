@@ -0,0 +1,884 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+)
+
+// Memory stores parties in memory. It's intended for tests and local development, and holds nothing once the process
+// exits.
+type Memory struct {
+	mu          sync.Mutex
+	respondents map[string]*models.Respondent
+	// Respondent IDs in the order they were created
+	respondentIDs []string
+	businesses    map[string]models.Business
+	// Each business's versions of its attributes, oldest first. The latest is its current state.
+	businessAttributes map[string][]models.BusinessAttributesVersion
+	// How many versions of business attributes have ever been recorded, to number the next one after
+	attributesCount int64
+	// Pending enrolments by respondent ID
+	pendingEnrolments map[string][]NewEnrolment
+	outbox            []memoryOutboxEntry
+	audit             []models.AuditEntry
+	// Webhooks in the order they were registered
+	webhooks   []models.Webhook
+	deliveries []models.WebhookDelivery
+	// How many deliveries have ever been recorded, to number the next one after
+	deliveryCount int64
+	businessLoads map[string]models.BusinessLoad
+	// When each business load last recorded its progress, by ID
+	businessLoadsUpdated map[string]time.Time
+}
+
+type memoryOutboxEntry struct {
+	models.OutboxEntry
+	dispatched bool
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		respondents:          map[string]*models.Respondent{},
+		businesses:           map[string]models.Business{},
+		businessAttributes:   map[string][]models.BusinessAttributesVersion{},
+		pendingEnrolments:    map[string][]NewEnrolment{},
+		businessLoads:        map[string]models.BusinessLoad{},
+		businessLoadsUpdated: map[string]time.Time{},
+	}
+}
+
+func respondentMatches(respondent *models.Respondent, search RespondentSearch) bool {
+	attributeFilters := map[string]string{
+		"firstName":    respondent.Attributes.FirstName,
+		"lastName":     respondent.Attributes.LastName,
+		"emailAddress": respondent.Attributes.EmailAddress,
+		"telephone":    respondent.Attributes.Telephone,
+		"status":       respondent.Status,
+	}
+	for filter, value := range attributeFilters {
+		if want, ok := search.Filters[filter]; ok && want != value {
+			return false
+		}
+	}
+
+	// The business and survey must both match the same enrolment, as they do when joined in the database
+	businessID, filterBusiness := search.Filters["businessId"]
+	surveyID, filterSurvey := search.Filters["surveyId"]
+	if !filterBusiness && !filterSurvey {
+		return true
+	}
+	for _, assoc := range respondent.Associations {
+		if filterBusiness && assoc.ID != businessID {
+			continue
+		}
+		for _, enrolment := range assoc.Enrolments {
+			if !filterSurvey || enrolment.SurveyID == surveyID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SearchRespondents returns all respondents matching the search
+func (m *Memory) SearchRespondents(ctx context.Context, search RespondentSearch) ([]models.Respondent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	respondents := []models.Respondent{}
+	for _, id := range m.respondentIDs {
+		if respondentMatches(m.respondents[id], search) {
+			respondents = append(respondents, copyRespondent(m.respondents[id]))
+		}
+	}
+
+	if search.Offset != nil {
+		if *search.Offset >= len(respondents) {
+			return []models.Respondent{}, nil
+		}
+		respondents = respondents[*search.Offset:]
+	}
+	if search.Limit != nil && *search.Limit < len(respondents) {
+		respondents = respondents[:*search.Limit]
+	}
+
+	return respondents, nil
+}
+
+// GetRespondent returns the respondent with the ID provided, or ErrNotFound
+func (m *Memory) GetRespondent(ctx context.Context, id string) (models.Respondent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	respondent, ok := m.respondents[id]
+	if !ok {
+		return models.Respondent{}, ErrNotFound
+	}
+	return copyRespondent(respondent), nil
+}
+
+// Ensures that all the businesses being newly enrolled with exist
+func (m *Memory) checkBusinessesExist(enrolments []NewEnrolment, businessIDs []string) error {
+	for _, enrolment := range enrolments {
+		if _, ok := m.businesses[enrolment.BusinessID]; !ok && contains(businessIDs, enrolment.BusinessID) {
+			return newError(Unprocessable, "Can't associate with the business for enrolment code: "+enrolment.Code)
+		}
+	}
+	return nil
+}
+
+// CreateRespondent creates a respondent with the ID provided, associated with the businesses and enrolled (pending)
+// on the surveys of the enrolments provided
+func (m *Memory) CreateRespondent(ctx context.Context, respondent models.Attributes, enrolments []NewEnrolment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkBusinessesExist(enrolments, enrolmentBusinessIDs(enrolments)); err != nil {
+		return err
+	}
+	if _, ok := m.respondents[respondent.ID]; ok {
+		return newError(Unprocessable, "Can't create a respondent with ID "+respondent.ID+": ID already exists")
+	}
+	// Email addresses are unique, as the respondent table's constraint has them
+	for _, other := range m.respondents {
+		if other.Attributes.EmailAddress == respondent.EmailAddress {
+			return newError(Conflict, "New email address already in use")
+		}
+	}
+
+	created := &models.Respondent{
+		Attributes:   respondent,
+		Status:       "CREATED",
+		Associations: []models.Association{},
+	}
+	enrol(created, enrolments)
+	m.respondents[respondent.ID] = created
+	m.pendingEnrolments[respondent.ID] = enrolments
+	m.respondentIDs = append(m.respondentIDs, respondent.ID)
+	m.addOutboxEntries(deactivationEntries(enrolments))
+	after := copyRespondent(created)
+	m.addOutboxEntries(respondentEventEntries(nil, &after))
+	m.addAuditEntry(auditEntry(ctx, AuditCreate, respondent.ID, nil, &after))
+
+	return nil
+}
+
+// UpdateRespondent applies all of the changes to the respondent, or none of them
+func (m *Memory) UpdateRespondent(ctx context.Context, id string, update RespondentUpdate) error {
+	// Resolving the enrolments calls other services, so it's done before taking the lock rather than holding up every
+	// other call to the store
+	var enrolments []NewEnrolment
+	if update.ResolveEnrolments != nil {
+		m.mu.Lock()
+		_, ok := m.respondents[id]
+		m.mu.Unlock()
+		if !ok {
+			return ErrNotFound
+		}
+
+		var err error
+		if enrolments, err = update.ResolveEnrolments(); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The respondent may have been deleted while the enrolments were being resolved
+	stored, ok := m.respondents[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if update.Attributes.EmailAddress != "" && update.Attributes.EmailAddress != stored.Attributes.EmailAddress {
+		for _, other := range m.respondents {
+			if other.Attributes.EmailAddress == update.Attributes.EmailAddress {
+				return newError(Conflict, "New email address already in use")
+			}
+		}
+	}
+
+	// Work on a copy so that nothing changes if any part of the update fails
+	respondent := copyRespondent(stored)
+	applyAttributes(&respondent, update)
+
+	newBusinessIDs := []string{}
+	for _, businessID := range enrolmentBusinessIDs(enrolments) {
+		associated := false
+		for _, assoc := range respondent.Associations {
+			if assoc.ID == businessID {
+				associated = true
+				break
+			}
+		}
+		if !associated {
+			newBusinessIDs = append(newBusinessIDs, businessID)
+		}
+	}
+	if err := m.checkBusinessesExist(enrolments, newBusinessIDs); err != nil {
+		return err
+	}
+	enrol(&respondent, enrolments)
+
+	if surveyID, ok := applyEnrolmentStatuses(&respondent, update.EnrolmentStatuses); !ok {
+		return newError(Missing, "Can't find enrolment to update for respondent ID "+id+" and survey ID "+surveyID)
+	}
+
+	before := copyRespondent(stored)
+	*stored = respondent
+	m.pendingEnrolments[id] = append(m.pendingEnrolments[id], enrolments...)
+	m.addOutboxEntries(deactivationEntries(enrolments))
+	after := copyRespondent(stored)
+	m.addOutboxEntries(respondentEventEntries(&before, &after))
+	m.addAuditEntry(auditEntry(ctx, AuditUpdate, id, &before, &after))
+	return nil
+}
+
+// DeleteRespondent deletes the respondent along with their associations and enrolments
+func (m *Memory) DeleteRespondent(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.respondents[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	before := copyRespondent(stored)
+	m.addOutboxEntries(respondentEventEntries(&before, nil))
+	m.addAuditEntry(auditEntry(ctx, AuditDelete, id, &before, nil))
+	delete(m.respondents, id)
+	delete(m.pendingEnrolments, id)
+	for idx, respondentID := range m.respondentIDs {
+		if respondentID == id {
+			m.respondentIDs = append(m.respondentIDs[:idx], m.respondentIDs[idx+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Records the audit log entry, numbering it after those already recorded
+func (m *Memory) addAuditEntry(entry models.AuditEntry) {
+	entry.ID = int64(len(m.audit) + 1)
+	m.audit = append(m.audit, entry)
+}
+
+// RespondentHistory returns the audit log of changes to the respondent, oldest first, which outlives the respondent
+// being deleted
+func (m *Memory) RespondentHistory(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	history := []models.AuditEntry{}
+	for _, entry := range m.audit {
+		if entry.RespondentID == id {
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
+
+// Returns the business with its respondent associations, as they're stored against the respondents
+func (m *Memory) businessWithAssociations(business models.Business) models.Business {
+	business.Associations = []models.Association{}
+	for _, id := range m.respondentIDs {
+		respondent := m.respondents[id]
+		for _, assoc := range respondent.Associations {
+			if assoc.ID != business.ID {
+				continue
+			}
+			business.Associations = append(business.Associations, models.Association{
+				ID:            respondent.Attributes.ID,
+				Name:          strings.TrimSpace(respondent.Attributes.FirstName + " " + respondent.Attributes.LastName),
+				SampleUnitRef: business.SampleUnitRef,
+				Enrolments:    append([]models.Enrolment{}, assoc.Enrolments...),
+			})
+		}
+	}
+	return business
+}
+
+// SearchBusinesses returns the requested page of businesses matching the search, and the total number matching
+func (m *Memory) SearchBusinesses(ctx context.Context, search BusinessSearch) ([]models.Business, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches := []models.Business{}
+	for _, business := range m.businesses {
+		matched := true
+		for _, keyword := range search.Keywords {
+			keyword = strings.ToLower(keyword)
+			if !strings.Contains(strings.ToLower(business.SampleUnitRef), keyword) &&
+				!strings.Contains(strings.ToLower(business.Name), keyword) &&
+				!strings.Contains(strings.ToLower(business.TradingAs), keyword) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, business)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Name != matches[j].Name {
+			return matches[i].Name < matches[j].Name
+		}
+		return matches[i].SampleUnitRef < matches[j].SampleUnitRef
+	})
+
+	total := len(matches)
+	start := (search.Page - 1) * search.Limit
+	if start > total {
+		start = total
+	}
+	end := start + search.Limit
+	if end > total {
+		end = total
+	}
+
+	businesses := []models.Business{}
+	for _, business := range matches[start:end] {
+		businesses = append(businesses, m.businessWithAssociations(business))
+	}
+
+	return businesses, total, nil
+}
+
+// GetBusiness returns the business with the ID provided, or ErrNotFound
+func (m *Memory) GetBusiness(ctx context.Context, id string) (models.Business, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	business, ok := m.businesses[id]
+	if !ok {
+		return models.Business{}, ErrNotFound
+	}
+	return m.businessWithAssociations(business), nil
+}
+
+// GetBusinessByRef returns the business with the RU reference (sample unit ref) provided, or ErrNotFound
+func (m *Memory) GetBusinessByRef(ctx context.Context, ref string) (models.Business, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, business := range m.businesses {
+		if business.SampleUnitRef == ref {
+			return m.businessWithAssociations(business), nil
+		}
+	}
+	return models.Business{}, ErrNotFound
+}
+
+// GetBusinessesByRefs returns the businesses with any of the RU references provided, ordered by reference. Refs which
+// no business has are skipped.
+func (m *Memory) GetBusinessesByRefs(ctx context.Context, refs []string) ([]models.Business, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := map[string]bool{}
+	for _, ref := range refs {
+		wanted[ref] = true
+	}
+	found := []models.Business{}
+	for _, business := range m.businesses {
+		if wanted[business.SampleUnitRef] {
+			found = append(found, m.businessWithAssociations(business))
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].SampleUnitRef < found[j].SampleUnitRef })
+	return found, nil
+}
+
+// CreateBusiness creates a business with the ID provided
+func (m *Memory) CreateBusiness(ctx context.Context, business models.Business) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.businesses[business.ID]; ok {
+		return newError(Unprocessable, "Can't create a business with ID "+business.ID+": ID already exists")
+	}
+	if m.refTaken(business.SampleUnitRef, business.ID) {
+		return newError(Unprocessable, "Can't create a business with ID "+business.ID+": ruRef "+business.SampleUnitRef+" already exists")
+	}
+
+	business.Associations = nil
+	m.businesses[business.ID] = business
+	m.addBusinessAttributes(business, "")
+	m.addOutboxEntries(businessEventEntries(events.BusinessCreated, events.BusinessCreatedVersion, business))
+	return nil
+}
+
+// Returns whether a business other than the one with the ID provided has the RU reference, which like business_ref in
+// the database must be unique
+func (m *Memory) refTaken(ref string, id string) bool {
+	for _, business := range m.businesses {
+		if business.SampleUnitRef == ref && business.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// Records a new version of the business's attributes, which becomes its current state
+func (m *Memory) addBusinessAttributes(business models.Business, collectionExerciseID string) {
+	m.attributesCount++
+	m.businessAttributes[business.ID] = append(m.businessAttributes[business.ID], models.BusinessAttributesVersion{
+		ID:                   m.attributesCount,
+		SampleSummaryID:      business.SampleSummaryID,
+		CollectionExerciseID: collectionExerciseID,
+		Name:                 business.Name,
+		TradingAs:            business.TradingAs,
+		Attributes:           business.Attributes,
+		CreatedOn:            time.Now().UTC(),
+	})
+}
+
+// Records the business's attributes for its sample summary as a new version, unless they're the same as its latest
+// version for the sample. A new version for a sample which has been linked to its collection exercise stays linked.
+func (m *Memory) recordBusinessAttributes(business models.Business) {
+	collectionExerciseID := ""
+	if version := m.businessAttributesFor(business.ID, business.SampleSummaryID); version != nil {
+		if version.Name == business.Name && version.TradingAs == business.TradingAs && version.Attributes == business.Attributes {
+			return
+		}
+		collectionExerciseID = version.CollectionExerciseID
+	}
+	m.addBusinessAttributes(business, collectionExerciseID)
+}
+
+// Returns the latest version of the business's attributes for the sample summary, or nil if it has none
+func (m *Memory) businessAttributesFor(businessID string, sampleSummaryID string) *models.BusinessAttributesVersion {
+	versions := m.businessAttributes[businessID]
+	for idx := len(versions) - 1; idx >= 0; idx-- {
+		if versions[idx].SampleSummaryID == sampleSummaryID {
+			return &versions[idx]
+		}
+	}
+	return nil
+}
+
+// Returns the business with the version of its attributes provided
+func withBusinessAttributes(business models.Business, version models.BusinessAttributesVersion) models.Business {
+	business.SampleSummaryID = version.SampleSummaryID
+	business.Name = version.Name
+	business.TradingAs = version.TradingAs
+	business.Attributes = version.Attributes
+	return business
+}
+
+// UpdateBusiness replaces the stored state of the business with the one provided, and adds it to the samples provided,
+// or returns ErrNotFound. Changed attributes are recorded as a new version for the business's sample summary, leaving
+// the previous ones in its history.
+func (m *Memory) UpdateBusiness(ctx context.Context, business models.Business, samples []models.Sample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.businesses[business.ID]; !ok {
+		return ErrNotFound
+	}
+	if m.refTaken(business.SampleUnitRef, business.ID) {
+		return newError(Unprocessable, "Can't update business for ID "+business.ID+": ruRef "+business.SampleUnitRef+" already exists")
+	}
+
+	m.recordBusinessAttributes(business)
+
+	// A business being added to a sample it has no attributes for gets a copy of its current ones for the sample
+	for _, sample := range samples {
+		if m.businessAttributesFor(business.ID, sample.SampleSummaryID) != nil {
+			versions := m.businessAttributes[business.ID]
+			for idx := range versions {
+				if versions[idx].SampleSummaryID == sample.SampleSummaryID {
+					versions[idx].CollectionExerciseID = sample.CollectionExerciseID
+				}
+			}
+			continue
+		}
+		inSample := business
+		inSample.SampleSummaryID = sample.SampleSummaryID
+		m.addBusinessAttributes(inSample, sample.CollectionExerciseID)
+	}
+
+	versions := m.businessAttributes[business.ID]
+	business.Associations = nil
+	m.businesses[business.ID] = withBusinessAttributes(business, versions[len(versions)-1])
+	m.addOutboxEntries(businessEventEntries(events.BusinessUpdated, events.BusinessUpdatedVersion, business))
+	return nil
+}
+
+// GetBusinessForCollectionExercise returns the business with the ID provided, with the attributes it had in the
+// collection exercise, or ErrNotFound. It's Missing if the business wasn't in the collection exercise.
+func (m *Memory) GetBusinessForCollectionExercise(ctx context.Context, id string, collectionExerciseID string) (models.Business, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	business, ok := m.businesses[id]
+	if !ok {
+		return models.Business{}, ErrNotFound
+	}
+	versions := m.businessAttributes[id]
+	for idx := len(versions) - 1; idx >= 0; idx-- {
+		if versions[idx].CollectionExerciseID == collectionExerciseID {
+			return withBusinessAttributes(m.businessWithAssociations(business), versions[idx]), nil
+		}
+	}
+	return models.Business{}, newError(Missing, "Business ID "+id+" isn't in collection exercise "+collectionExerciseID)
+}
+
+// BusinessAttributesHistory returns every version of the business's attributes, oldest first
+func (m *Memory) BusinessAttributesHistory(ctx context.Context, id string) ([]models.BusinessAttributesVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.BusinessAttributesVersion{}, m.businessAttributes[id]...), nil
+}
+
+// BusinessSamples returns the samples the business is in, in the order it was added to them
+func (m *Memory) BusinessSamples(ctx context.Context, businessID string) ([]models.Sample, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	samples := []models.Sample{}
+	seen := map[string]bool{}
+	for _, version := range m.businessAttributes[businessID] {
+		if version.SampleSummaryID != "" && !seen[version.SampleSummaryID] {
+			seen[version.SampleSummaryID] = true
+			samples = append(samples, models.Sample{SampleSummaryID: version.SampleSummaryID, CollectionExerciseID: version.CollectionExerciseID})
+		}
+	}
+	return samples, nil
+}
+
+// LinkSampleSummary links the sample summary to the collection exercise, for every business in the sample, and returns
+// how many businesses there were
+func (m *Memory) LinkSampleSummary(ctx context.Context, sampleSummaryID string, collectionExerciseID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	linked := 0
+	for _, versions := range m.businessAttributes {
+		inSample := false
+		for idx := range versions {
+			if versions[idx].SampleSummaryID == sampleSummaryID {
+				versions[idx].CollectionExerciseID = collectionExerciseID
+				inSample = true
+			}
+		}
+		if inSample {
+			linked++
+		}
+	}
+	return linked, nil
+}
+
+// LoadBusinesses creates or updates each of the businesses, identified by their RU references, along with their
+// attributes for their sample summary, all or none of them at once. Businesses which don't exist yet are created with
+// the IDs provided, and the IDs of those which do are filled in.
+func (m *Memory) LoadBusinesses(ctx context.Context, businesses []models.Business) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := map[string]string{}
+	for id, business := range m.businesses {
+		existing[business.SampleUnitRef] = id
+	}
+
+	for idx := range businesses {
+		business := businesses[idx]
+		id, found := existing[business.SampleUnitRef]
+		if found {
+			business.ID = id
+			businesses[idx].ID = id
+		} else {
+			// Later rows with the same ref update this business rather than creating another, as business_ref is unique
+			// in the database
+			existing[business.SampleUnitRef] = business.ID
+		}
+
+		m.recordBusinessAttributes(business)
+
+		versions := m.businessAttributes[business.ID]
+		business.Associations = nil
+		m.businesses[business.ID] = withBusinessAttributes(business, versions[len(versions)-1])
+		if found {
+			m.addOutboxEntries(businessEventEntries(events.BusinessUpdated, events.BusinessUpdatedVersion, business))
+		} else {
+			m.addOutboxEntries(businessEventEntries(events.BusinessCreated, events.BusinessCreatedVersion, business))
+		}
+	}
+	return nil
+}
+
+// CreateBusinessLoad records a new job loading businesses from a sample file, with the ID provided
+func (m *Memory) CreateBusinessLoad(ctx context.Context, load models.BusinessLoad) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.businessLoads[load.ID]; ok {
+		return newError(Unprocessable, "Can't create a business load with ID "+load.ID+": ID already exists")
+	}
+	m.businessLoads[load.ID] = copyBusinessLoad(load)
+	m.businessLoadsUpdated[load.ID] = time.Now()
+	return nil
+}
+
+// UpdateBusinessLoad records how far the job loading businesses has got, or returns ErrNotFound
+func (m *Memory) UpdateBusinessLoad(ctx context.Context, load models.BusinessLoad) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.businessLoads[load.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = load.Status
+	stored.Loaded = load.Loaded
+	stored.CompletedOn = load.CompletedOn
+	stored.Errors = load.Errors
+	m.businessLoads[load.ID] = copyBusinessLoad(stored)
+	m.businessLoadsUpdated[load.ID] = time.Now()
+	return nil
+}
+
+// GetBusinessLoad returns the job loading businesses with the ID provided, or ErrNotFound
+func (m *Memory) GetBusinessLoad(ctx context.Context, id string) (models.BusinessLoad, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	load, ok := m.businessLoads[id]
+	if !ok {
+		return models.BusinessLoad{}, ErrNotFound
+	}
+	return copyBusinessLoad(load), nil
+}
+
+// FailStaleBusinessLoads marks the jobs loading businesses which are still running, but haven't recorded any progress
+// since the time provided, as failed, and returns how many there were
+func (m *Memory) FailStaleBusinessLoads(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	failed := 0
+	for id, load := range m.businessLoads {
+		if load.Status != BusinessLoadRunning || !m.businessLoadsUpdated[id].Before(before) {
+			continue
+		}
+		completedOn := now.UTC()
+		load.Status = BusinessLoadFailed
+		load.CompletedOn = &completedOn
+		m.businessLoads[id] = load
+		m.businessLoadsUpdated[id] = now
+		failed++
+	}
+	return failed, nil
+}
+
+// Returns a copy of the business load which shares nothing with the original, as the job carries on changing it
+func copyBusinessLoad(load models.BusinessLoad) models.BusinessLoad {
+	load.Errors = append([]models.BusinessLoadError{}, load.Errors...)
+	if load.CompletedOn != nil {
+		completedOn := *load.CompletedOn
+		load.CompletedOn = &completedOn
+	}
+	return load
+}
+
+func (m *Memory) addOutboxEntries(entries []models.OutboxEntry) {
+	now := time.Now()
+	for _, entry := range entries {
+		entry.ID = int64(len(m.outbox) + 1)
+		entry.NextAttempt = now
+		entry.CreatedOn = now
+		m.outbox = append(m.outbox, memoryOutboxEntry{OutboxEntry: entry})
+	}
+}
+
+// ClaimOutboxEntries returns up to limit entries which are due to be dispatched, oldest first, and stops them being
+// claimed again until the lease has passed
+func (m *Memory) ClaimOutboxEntries(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	claimed := []models.OutboxEntry{}
+	for idx := range m.outbox {
+		if len(claimed) == limit {
+			break
+		}
+		entry := &m.outbox[idx]
+		if entry.dispatched || entry.NextAttempt.After(now) {
+			continue
+		}
+		entry.NextAttempt = now.Add(lease)
+		claimed = append(claimed, entry.OutboxEntry)
+	}
+	return claimed, nil
+}
+
+// CompleteOutboxEntry records that the entry has been dispatched
+func (m *Memory) CompleteOutboxEntry(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.outbox)) {
+		return ErrNotFound
+	}
+	entry := &m.outbox[id-1]
+	entry.Attempts++
+	entry.dispatched = true
+	return nil
+}
+
+// RetryOutboxEntry records a failed attempt to dispatch the entry, and when to try again
+func (m *Memory) RetryOutboxEntry(ctx context.Context, id int64, lastError string, nextAttempt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.outbox)) {
+		return ErrNotFound
+	}
+	entry := &m.outbox[id-1]
+	entry.Attempts++
+	entry.LastError = lastError
+	entry.NextAttempt = nextAttempt
+	return nil
+}
+
+// StuckOutboxEntries returns the entries which still haven't been dispatched after at least minAttempts, oldest first
+func (m *Memory) StuckOutboxEntries(ctx context.Context, minAttempts int) ([]models.OutboxEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stuck := []models.OutboxEntry{}
+	for _, entry := range m.outbox {
+		if !entry.dispatched && entry.Attempts >= minAttempts {
+			stuck = append(stuck, entry.OutboxEntry)
+		}
+	}
+	return stuck, nil
+}
+
+// CreateWebhook registers the webhook, with the ID provided
+func (m *Memory) CreateWebhook(ctx context.Context, webhook models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.webhooks {
+		if existing.ID == webhook.ID {
+			return newError(Unprocessable, "Can't create a webhook with ID "+webhook.ID+": ID already exists")
+		}
+	}
+	webhook.EventTypes = append([]string{}, webhook.EventTypes...)
+	m.webhooks = append(m.webhooks, webhook)
+	return nil
+}
+
+// ListWebhooks returns every webhook, oldest first, without their secrets
+func (m *Memory) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range m.webhooks {
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+// GetWebhook returns the webhook with the ID provided, including its secret, or ErrNotFound
+func (m *Memory) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return models.Webhook{}, ErrNotFound
+}
+
+// DeleteWebhook deletes the webhook and its delivery log, or returns ErrNotFound
+func (m *Memory) DeleteWebhook(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for idx, webhook := range m.webhooks {
+		if webhook.ID == id {
+			m.webhooks = append(m.webhooks[:idx], m.webhooks[idx+1:]...)
+			deliveries := []models.WebhookDelivery{}
+			for _, delivery := range m.deliveries {
+				if delivery.WebhookID != id {
+					deliveries = append(deliveries, delivery)
+				}
+			}
+			m.deliveries = deliveries
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// QueueWebhookDeliveries records an OutboxDeliverWebhook entry for each webhook subscribed to the event, and returns
+// how many there were
+func (m *Memory) QueueWebhookDeliveries(ctx context.Context, event events.Event) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := []models.OutboxEntry{}
+	for _, webhook := range m.webhooks {
+		if subscribed(webhook, event.Type) {
+			entries = append(entries, webhookDeliveryEntry(webhook.ID, event))
+		}
+	}
+	m.addOutboxEntries(entries)
+	return len(entries), nil
+}
+
+// RecordWebhookDelivery adds the attempt to the webhook's delivery log
+func (m *Memory) RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deliveryCount++
+	delivery.ID = m.deliveryCount
+	m.deliveries = append(m.deliveries, delivery)
+	return nil
+}
+
+// WebhookDeliveries returns the webhook's delivery log, most recent first, or ErrNotFound if there's no such webhook
+func (m *Memory) WebhookDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for _, webhook := range m.webhooks {
+		if webhook.ID == webhookID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	for idx := len(m.deliveries) - 1; idx >= 0; idx-- {
+		if m.deliveries[idx].WebhookID == webhookID {
+			deliveries = append(deliveries, m.deliveries[idx])
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,747 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+var bob = models.Attributes{
+	ID:           "be70e086-7bbc-461c-a565-5b454d748a71",
+	EmailAddress: "bob@boblaw.com",
+	FirstName:    "Bob",
+	LastName:     "Boblaw",
+	Telephone:    "01234567890",
+}
+
+var bobsEnrolment = NewEnrolment{
+	Code:       "abc1234",
+	CaseID:     "7bc5d41b-0549-40b3-ba76-42f6d4cf3fdb",
+	BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+	SurveyID:   "0752a892-1a60-40a4-8aa3-2599405a8831",
+}
+
+func newMemoryWithBusiness(t *testing.T) *Memory {
+	m := NewMemory()
+	err := m.CreateBusiness(ctx, models.Business{
+		ID:            "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2",
+		SampleUnitRef: "49900000001",
+		Name:          "Bolts and Ratchets Ltd",
+	})
+	assert.Nil(t, err)
+
+	// Dispatch the business's events, so tests only see the outbox entries they cause
+	entries, err := m.ClaimOutboxEntries(ctx, 10, time.Minute)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.Nil(t, m.CompleteOutboxEntry(ctx, entry.ID))
+	}
+	return m
+}
+
+func TestMemoryCreateAndGetRespondent(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+
+	err := m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment})
+	assert.Nil(t, err)
+
+	respondent, err := m.GetRespondent(ctx, bob.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, bob, respondent.Attributes)
+	assert.Equal(t, "CREATED", respondent.Status)
+	assert.Equal(t, 1, len(respondent.Associations))
+	assert.Equal(t, []models.Enrolment{{SurveyID: bobsEnrolment.SurveyID, EnrolmentStatus: "PENDING"}}, respondent.Associations[0].Enrolments)
+}
+
+func TestMemoryCreateRespondentFailsIfBusinessMissing(t *testing.T) {
+	m := NewMemory()
+
+	err := m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Unprocessable, storeErr.Kind)
+	assert.Equal(t, "Can't associate with the business for enrolment code: abc1234", storeErr.Message)
+
+	_, err = m.GetRespondent(ctx, bob.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemorySearchRespondents(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+	jim := bob
+	jim.ID = "a1f6f1e8-1d9a-4bc4-9a63-0b2b6e5b1c2a"
+	jim.FirstName = "Jim"
+	jim.EmailAddress = "jim@jimbob.com"
+	assert.Nil(t, m.CreateRespondent(ctx, jim, []NewEnrolment{bobsEnrolment}))
+
+	found, err := m.SearchRespondents(ctx, RespondentSearch{Filters: map[string]string{"lastName": "Boblaw"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(found))
+
+	found, err = m.SearchRespondents(ctx, RespondentSearch{Filters: map[string]string{"firstName": "Jim", "surveyId": bobsEnrolment.SurveyID}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, jim.ID, found[0].Attributes.ID)
+
+	offset, limit := 1, 1
+	found, err = m.SearchRespondents(ctx, RespondentSearch{Filters: map[string]string{"lastName": "Boblaw"}, Offset: &offset, Limit: &limit})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, jim.ID, found[0].Attributes.ID)
+
+	found, err = m.SearchRespondents(ctx, RespondentSearch{Filters: map[string]string{"businessId": "3b136c4b-7a14-4904-9e01-13364dd7b972"}})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+}
+
+func TestMemoryUpdateRespondent(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+
+	secondEnrolment := bobsEnrolment
+	secondEnrolment.Code = "abc1235"
+	secondEnrolment.SurveyID = "c43cafd8-ece0-410f-9887-0b0b5eb681fb"
+
+	err := m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		Attributes: models.Attributes{Telephone: "09876543210"},
+		Status:     "ACTIVE",
+		ResolveEnrolments: func() ([]NewEnrolment, error) {
+			return []NewEnrolment{secondEnrolment}, nil
+		},
+		EnrolmentStatuses: []models.Association{{
+			ID:         bobsEnrolment.BusinessID,
+			Enrolments: []models.Enrolment{{SurveyID: bobsEnrolment.SurveyID, EnrolmentStatus: "ENABLED"}},
+		}},
+	})
+	assert.Nil(t, err)
+
+	respondent, err := m.GetRespondent(ctx, bob.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "09876543210", respondent.Attributes.Telephone)
+	assert.Equal(t, "Bob", respondent.Attributes.FirstName)
+	assert.Equal(t, "ACTIVE", respondent.Status)
+	assert.Equal(t, []models.Enrolment{
+		{SurveyID: bobsEnrolment.SurveyID, EnrolmentStatus: "ENABLED"},
+		{SurveyID: secondEnrolment.SurveyID, EnrolmentStatus: "PENDING"},
+	}, respondent.Associations[0].Enrolments)
+}
+
+func TestMemoryUpdateRespondentChangesNothingIfItFails(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+
+	err := m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		Attributes: models.Attributes{FirstName: "Robert"},
+		EnrolmentStatuses: []models.Association{{
+			ID:         bobsEnrolment.BusinessID,
+			Enrolments: []models.Enrolment{{SurveyID: "c43cafd8-ece0-410f-9887-0b0b5eb681fb", EnrolmentStatus: "ENABLED"}},
+		}},
+	})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Missing, storeErr.Kind)
+
+	respondent, err := m.GetRespondent(ctx, bob.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bob", respondent.Attributes.FirstName)
+}
+
+func TestMemoryUpdateRespondentReturnsResolverErrors(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+	resolverErr := errors.New("Enrolment code not found: abc1235")
+
+	err := m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		ResolveEnrolments: func() ([]NewEnrolment, error) {
+			return nil, resolverErr
+		},
+	})
+
+	assert.Equal(t, resolverErr, err)
+}
+
+func TestMemoryUpdateRespondentDoesntLockWhileResolvingEnrolments(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+
+	// The respondent is deleted while the enrolments are resolved, which would deadlock if the store were locked
+	err := m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		ResolveEnrolments: func() ([]NewEnrolment, error) {
+			assert.Nil(t, m.DeleteRespondent(ctx, bob.ID))
+			return []NewEnrolment{bobsEnrolment}, nil
+		},
+	})
+
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryCreateRespondentRejectsEmailInUse(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+	jim := bob
+	jim.ID = "a1f6f1e8-1d9a-4bc4-9a63-0b2b6e5b1c2a"
+
+	err := m.CreateRespondent(ctx, jim, []NewEnrolment{bobsEnrolment})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Conflict, storeErr.Kind)
+	_, err = m.GetRespondent(ctx, jim.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryUpdateRespondentRejectsEmailInUse(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+	jim := bob
+	jim.ID = "a1f6f1e8-1d9a-4bc4-9a63-0b2b6e5b1c2a"
+	jim.EmailAddress = "jim@jimbob.com"
+	assert.Nil(t, m.CreateRespondent(ctx, jim, []NewEnrolment{bobsEnrolment}))
+
+	err := m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{Attributes: models.Attributes{EmailAddress: "jim@jimbob.com"}})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Conflict, storeErr.Kind)
+}
+
+func TestMemoryUpdateRespondentReturnsNotFound(t *testing.T) {
+	m := NewMemory()
+
+	err := m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{Status: "ACTIVE"})
+
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryDeleteRespondent(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+
+	assert.Nil(t, m.DeleteRespondent(ctx, bob.ID))
+
+	_, err := m.GetRespondent(ctx, bob.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, m.DeleteRespondent(ctx, bob.ID))
+
+	published := outboxEvents(t, m)
+	deleted := published[len(published)-1]
+	assert.Equal(t, events.RespondentDeleted, deleted.Type)
+	assert.JSONEq(t, `{"respondentId":"`+bob.ID+`","emailAddress":"`+bob.EmailAddress+`"}`, string(deleted.Data))
+}
+
+func TestMemoryRespondentHistory(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(WithActor(ctx, "frontstage"), bob, []NewEnrolment{bobsEnrolment}))
+	assert.Nil(t, m.UpdateRespondent(WithActor(ctx, "support-tool"), bob.ID, RespondentUpdate{
+		Attributes: models.Attributes{EmailAddress: "robert@boblaw.com"},
+	}))
+	assert.Nil(t, m.DeleteRespondent(ctx, bob.ID))
+
+	history, err := m.RespondentHistory(ctx, bob.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(history))
+
+	assert.Equal(t, "frontstage", history[0].Actor)
+	assert.Equal(t, AuditCreate, history[0].Action)
+	assert.Equal(t, []string{bobsEnrolment.BusinessID}, history[0].BusinessIDs)
+	assert.Nil(t, history[0].Before)
+	assert.Contains(t, string(history[0].After), `"emailAddress":"bob@boblaw.com"`)
+
+	assert.Equal(t, "support-tool", history[1].Actor)
+	assert.Equal(t, AuditUpdate, history[1].Action)
+	assert.Contains(t, string(history[1].Before), `"emailAddress":"bob@boblaw.com"`)
+	assert.Contains(t, string(history[1].After), `"emailAddress":"robert@boblaw.com"`)
+
+	assert.Equal(t, "unknown", history[2].Actor)
+	assert.Equal(t, AuditDelete, history[2].Action)
+	assert.Contains(t, string(history[2].Before), `"emailAddress":"robert@boblaw.com"`)
+	assert.Nil(t, history[2].After)
+}
+
+func TestMemoryRespondentHistoryLeavesOutFailedChanges(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, nil))
+
+	err := m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		ResolveEnrolments: func() ([]NewEnrolment, error) {
+			return nil, errors.New("Enrolment code not found: abc1234")
+		},
+	})
+	assert.NotNil(t, err)
+
+	history, err := m.RespondentHistory(ctx, bob.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, AuditCreate, history[0].Action)
+}
+
+// Returns the events recorded in the outbox, in the order they were recorded
+func outboxEvents(t *testing.T, m *Memory) []events.Event {
+	entries, err := m.ClaimOutboxEntries(ctx, 100, time.Minute)
+	assert.Nil(t, err)
+	published := []events.Event{}
+	for _, entry := range entries {
+		if entry.Kind != OutboxPublishEvent {
+			continue
+		}
+		var event events.Event
+		assert.Nil(t, json.Unmarshal(entry.Payload, &event))
+		published = append(published, event)
+	}
+	return published
+}
+
+func TestMemoryRecordsRespondentEvents(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+
+	published := outboxEvents(t, m)
+	assert.Equal(t, 1, len(published))
+	assert.Equal(t, events.RespondentCreated, published[0].Type)
+	assert.Equal(t, events.RespondentCreatedVersion, published[0].Version)
+	var created events.RespondentCreatedData
+	assert.Nil(t, json.Unmarshal(published[0].Data, &created))
+	assert.Equal(t, bob.ID, created.RespondentID)
+	assert.Equal(t, []events.Enrolment{{BusinessID: bobsEnrolment.BusinessID, SurveyID: bobsEnrolment.SurveyID, Status: "PENDING"}}, created.Enrolments)
+
+	// Changes which aren't published, such as to a telephone number, don't record any events
+	assert.Nil(t, m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{Attributes: models.Attributes{Telephone: "09876543210"}}))
+	assert.Empty(t, outboxEvents(t, m))
+
+	assert.Nil(t, m.UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		Attributes: models.Attributes{EmailAddress: "robert@boblaw.com"},
+		EnrolmentStatuses: []models.Association{{
+			ID:         bobsEnrolment.BusinessID,
+			Enrolments: []models.Enrolment{{SurveyID: bobsEnrolment.SurveyID, EnrolmentStatus: "ENABLED"}},
+		}},
+	}))
+
+	published = outboxEvents(t, m)
+	assert.Equal(t, 2, len(published))
+	assert.Equal(t, events.RespondentEmailChanged, published[0].Type)
+	assert.JSONEq(t, `{"respondentId":"`+bob.ID+`","previousEmailAddress":"bob@boblaw.com","emailAddress":"robert@boblaw.com"}`,
+		string(published[0].Data))
+	assert.Equal(t, events.EnrolmentStatusChanged, published[1].Type)
+	assert.JSONEq(t, `{"respondentId":"`+bob.ID+`","businessId":"`+bobsEnrolment.BusinessID+`","surveyId":"`+bobsEnrolment.SurveyID+
+		`","previousStatus":"PENDING","status":"ENABLED"}`, string(published[1].Data))
+}
+
+func TestMemorySearchBusinesses(t *testing.T) {
+	m := NewMemory()
+	for _, business := range []models.Business{
+		{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972", SampleUnitRef: "49900000002", Name: "Widgets Ltd"},
+		{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001", Name: "Bolts and Ratchets Ltd"},
+		{ID: "6d6c8c35-9b3b-4dba-a4b5-3b8a2a7e6f0e", SampleUnitRef: "50000000001", Name: "Sprockets", TradingAs: "Bolt Supplies"},
+	} {
+		assert.Nil(t, m.CreateBusiness(ctx, business))
+	}
+
+	businesses, total, err := m.SearchBusinesses(ctx, BusinessSearch{Keywords: []string{"BOLT"}, Page: 1, Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "Bolts and Ratchets Ltd", businesses[0].Name)
+	assert.Equal(t, "Sprockets", businesses[1].Name)
+
+	businesses, total, err = m.SearchBusinesses(ctx, BusinessSearch{Keywords: []string{"499", "ltd"}, Page: 2, Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 1, len(businesses))
+	assert.Equal(t, "Widgets Ltd", businesses[0].Name)
+
+	businesses, total, err = m.SearchBusinesses(ctx, BusinessSearch{Keywords: []string{"ltd"}, Page: 3, Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	assert.Empty(t, businesses)
+}
+
+func TestMemoryGetBusinessIncludesAssociations(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	assert.Nil(t, m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment}))
+
+	business, err := m.GetBusiness(ctx, bobsEnrolment.BusinessID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(business.Associations))
+	assert.Equal(t, bob.ID, business.Associations[0].ID)
+	assert.Equal(t, "Bob Boblaw", business.Associations[0].Name)
+	assert.Equal(t, "49900000001", business.Associations[0].SampleUnitRef)
+}
+
+func TestMemoryGetBusinessByRef(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+
+	business, err := m.GetBusinessByRef(ctx, "49900000001")
+	assert.Nil(t, err)
+	assert.Equal(t, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", business.ID)
+
+	_, err = m.GetBusinessByRef(ctx, "49900000002")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryBusinessRefsAreUnique(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	other := models.Business{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972", SampleUnitRef: "49900000001", Name: "Other Ltd"}
+
+	err := m.CreateBusiness(ctx, other)
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Unprocessable, storeErr.Kind)
+	assert.Equal(t, "Can't create a business with ID "+other.ID+": ruRef 49900000001 already exists", err.Error())
+
+	other.SampleUnitRef = "49900000002"
+	assert.Nil(t, m.CreateBusiness(ctx, other))
+	other.SampleUnitRef = "49900000001"
+	err = m.UpdateBusiness(ctx, other, nil)
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Unprocessable, storeErr.Kind)
+}
+
+func TestMemoryGetBusinessesByRefs(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+
+	businesses, err := m.GetBusinessesByRefs(ctx, []string{"49900000002", "49900000001"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(businesses))
+	assert.Equal(t, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", businesses[0].ID)
+}
+
+func TestMemoryUpdateBusiness(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+
+	business, err := m.GetBusiness(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
+	assert.Nil(t, err)
+	business.TradingAs = "Ratchets Direct"
+	assert.Nil(t, m.UpdateBusiness(ctx, business, nil))
+
+	business, err = m.GetBusiness(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
+	assert.Nil(t, err)
+	assert.Equal(t, "Ratchets Direct", business.TradingAs)
+
+	assert.Equal(t, ErrNotFound, m.UpdateBusiness(ctx, models.Business{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972"}, nil))
+}
+
+func TestMemoryBusinessSamples(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	first := models.Sample{SampleSummaryID: "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", CollectionExerciseID: "517a1f82-3440-41dd-933b-b54af5379b39"}
+	second := models.Sample{SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a", CollectionExerciseID: "62f682a9-c223-4f15-942e-93d00d400daf"}
+
+	business, err := m.GetBusiness(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
+	assert.Nil(t, err)
+	business.SampleSummaryID = first.SampleSummaryID
+	assert.Nil(t, m.UpdateBusiness(ctx, business, []models.Sample{second}))
+
+	// The first sample isn't linked to its collection exercise until it's linked as a whole
+	samples, err := m.BusinessSamples(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Sample{{SampleSummaryID: first.SampleSummaryID}, second}, samples)
+
+	linked, err := m.LinkSampleSummary(ctx, first.SampleSummaryID, first.CollectionExerciseID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, linked)
+
+	samples, err = m.BusinessSamples(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Sample{first, second}, samples)
+
+	// Being added to the sample it was already in leaves the business as it was
+	business, err = m.GetBusiness(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, second.SampleSummaryID, business.SampleSummaryID)
+	assert.Nil(t, m.UpdateBusiness(ctx, business, []models.Sample{second}))
+	samples, err = m.BusinessSamples(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(samples))
+}
+
+func TestMemoryBusinessAttributesVersions(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+
+	business, err := m.GetBusiness(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
+	assert.Nil(t, err)
+	business.SampleSummaryID = "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"
+	business.Attributes.FroEmpment = 50
+	assert.Nil(t, m.UpdateBusiness(ctx, business, nil))
+	business.Attributes.FroEmpment = 51
+	assert.Nil(t, m.UpdateBusiness(ctx, business, nil))
+	business.SampleSummaryID = "c9a4f9a5-573e-4870-a114-42279ab2aa3a"
+	business.Attributes.FroEmpment = 55
+	assert.Nil(t, m.UpdateBusiness(ctx, business, nil))
+	linked, err := m.LinkSampleSummary(ctx, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", "517a1f82-3440-41dd-933b-b54af5379b39")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, linked)
+
+	// The business was created without a sample, then had each change to its attributes recorded as a new version
+	history, err := m.BusinessAttributesHistory(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(history))
+	assert.Equal(t, "", history[0].SampleSummaryID)
+	assert.Equal(t, 50, history[1].Attributes.FroEmpment)
+	assert.Equal(t, 51, history[2].Attributes.FroEmpment)
+	assert.Equal(t, "517a1f82-3440-41dd-933b-b54af5379b39", history[1].CollectionExerciseID)
+	assert.Equal(t, "517a1f82-3440-41dd-933b-b54af5379b39", history[2].CollectionExerciseID)
+	assert.Equal(t, 55, history[3].Attributes.FroEmpment)
+
+	// Updating the business without changing it records nothing, and a change to a linked sample stays linked
+	assert.Nil(t, m.UpdateBusiness(ctx, business, nil))
+	business.SampleSummaryID = "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"
+	business.Attributes.FroEmpment = 52
+	assert.Nil(t, m.UpdateBusiness(ctx, business, nil))
+	history, err = m.BusinessAttributesHistory(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(history))
+	assert.Equal(t, "517a1f82-3440-41dd-933b-b54af5379b39", history[4].CollectionExerciseID)
+	samples, err := m.BusinessSamples(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Sample{
+		{SampleSummaryID: "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", CollectionExerciseID: "517a1f82-3440-41dd-933b-b54af5379b39"},
+		{SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a"},
+	}, samples)
+
+	current, err := m.GetBusiness(ctx, business.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 52, current.Attributes.FroEmpment)
+
+	inExercise, err := m.GetBusinessForCollectionExercise(ctx, business.ID, "517a1f82-3440-41dd-933b-b54af5379b39")
+	assert.Nil(t, err)
+	assert.Equal(t, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", inExercise.SampleSummaryID)
+	assert.Equal(t, 52, inExercise.Attributes.FroEmpment)
+
+	_, err = m.GetBusinessForCollectionExercise(ctx, business.ID, "62f682a9-c223-4f15-942e-93d00d400daf")
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Missing, storeErr.Kind)
+
+	_, err = m.GetBusinessForCollectionExercise(ctx, "3b136c4b-7a14-4904-9e01-13364dd7b972", "517a1f82-3440-41dd-933b-b54af5379b39")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryLoadBusinesses(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+	sampleSummaryID := "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"
+	loaded := []models.Business{
+		{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972", SampleUnitRef: "49900000001", SampleSummaryID: sampleSummaryID, Name: "Bolts and Ratchets"},
+		{ID: "c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", SampleUnitRef: "49900000002", SampleSummaryID: sampleSummaryID, Name: "Nuts Ltd"},
+	}
+
+	assert.Nil(t, m.LoadBusinesses(ctx, loaded))
+
+	// The existing business keeps its ID, and the new one gets the one provided
+	assert.Equal(t, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", loaded[0].ID)
+	existing, err := m.GetBusiness(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
+	assert.Nil(t, err)
+	assert.Equal(t, "Bolts and Ratchets", existing.Name)
+	assert.Equal(t, sampleSummaryID, existing.SampleSummaryID)
+	created, err := m.GetBusinessByRef(ctx, "49900000002")
+	assert.Nil(t, err)
+	assert.Equal(t, "c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", created.ID)
+
+	// Loading the sample again records a new version of the attributes which changed, and leaves the rest
+	loaded[1].Name = "Nuts and Bolts Ltd"
+	assert.Nil(t, m.LoadBusinesses(ctx, loaded))
+	history, err := m.BusinessAttributesHistory(ctx, created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "Nuts Ltd", history[0].Name)
+	assert.Equal(t, "Nuts and Bolts Ltd", history[1].Name)
+	history, err = m.BusinessAttributesHistory(ctx, existing.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+
+	entries, err := m.ClaimOutboxEntries(ctx, 10, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(entries))
+}
+
+func TestMemoryLoadBusinessesWithRepeatedRef(t *testing.T) {
+	m := NewMemory()
+	sampleSummaryID := "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"
+	loaded := []models.Business{
+		{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972", SampleUnitRef: "49900000002", SampleSummaryID: sampleSummaryID, Name: "Nuts Ltd"},
+		{ID: "c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", SampleUnitRef: "49900000002", SampleSummaryID: sampleSummaryID, Name: "Nuts and Bolts Ltd"},
+	}
+
+	assert.Nil(t, m.LoadBusinesses(ctx, loaded))
+
+	// The second row updates the business the first created, rather than creating another with the same ref
+	assert.Equal(t, "3b136c4b-7a14-4904-9e01-13364dd7b972", loaded[1].ID)
+	_, err := m.GetBusiness(ctx, "c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a")
+	assert.Equal(t, ErrNotFound, err)
+	business, err := m.GetBusinessByRef(ctx, "49900000002")
+	assert.Nil(t, err)
+	assert.Equal(t, "Nuts and Bolts Ltd", business.Name)
+}
+
+func TestMemoryBusinessLoads(t *testing.T) {
+	m := NewMemory()
+	load := models.BusinessLoad{ID: "8d1bd1a6-5f7f-4d8e-a0a4-6f7d0f3c3a5e", SampleSummaryID: "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1",
+		Status: "RUNNING", Rows: 2, Errors: []models.BusinessLoadError{}}
+	assert.Nil(t, m.CreateBusinessLoad(ctx, load))
+
+	completedOn := time.Now()
+	load.Status = "COMPLETED"
+	load.Loaded = 1
+	load.Errors = append(load.Errors, models.BusinessLoadError{Row: 2, Error: "Missing required fields: runame1"})
+	load.CompletedOn = &completedOn
+	assert.Nil(t, m.UpdateBusinessLoad(ctx, load))
+
+	stored, err := m.GetBusinessLoad(ctx, load.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, load, stored)
+
+	_, err = m.GetBusinessLoad(ctx, "3b136c4b-7a14-4904-9e01-13364dd7b972")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, m.UpdateBusinessLoad(ctx, models.BusinessLoad{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972"}))
+}
+
+func TestMemoryFailStaleBusinessLoads(t *testing.T) {
+	m := NewMemory()
+	stale := models.BusinessLoad{ID: "8d1bd1a6-5f7f-4d8e-a0a4-6f7d0f3c3a5e", Status: BusinessLoadRunning, Errors: []models.BusinessLoadError{}}
+	completed := models.BusinessLoad{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972", Status: BusinessLoadCompleted, Errors: []models.BusinessLoadError{}}
+	assert.Nil(t, m.CreateBusinessLoad(ctx, stale))
+	assert.Nil(t, m.CreateBusinessLoad(ctx, completed))
+	before := time.Now().Add(time.Minute)
+	running := models.BusinessLoad{ID: "5c7a3b5e-2f1d-4c59-8f0a-3c1f5e6d7a8b", Status: BusinessLoadRunning, Errors: []models.BusinessLoadError{}}
+	// A load which has made progress since the cutoff
+	assert.Nil(t, m.CreateBusinessLoad(ctx, running))
+	m.businessLoadsUpdated[running.ID] = before.Add(time.Second)
+
+	failed, err := m.FailStaleBusinessLoads(ctx, before)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, failed)
+	stored, err := m.GetBusinessLoad(ctx, stale.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, BusinessLoadFailed, stored.Status)
+	assert.NotNil(t, stored.CompletedOn)
+	stored, err = m.GetBusinessLoad(ctx, completed.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, BusinessLoadCompleted, stored.Status)
+	stored, err = m.GetBusinessLoad(ctx, running.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, BusinessLoadRunning, stored.Status)
+}
+
+func TestMemoryOutboxRecordsDeactivationsAndRetries(t *testing.T) {
+	m := newMemoryWithBusiness(t)
+
+	err := m.CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment})
+	assert.Nil(t, err)
+
+	entries, err := m.ClaimOutboxEntries(ctx, 10, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, OutboxDeactivateIAC, entries[0].Kind)
+	assert.JSONEq(t, `{"iac":"abc1234"}`, string(entries[0].Payload))
+	assert.Equal(t, OutboxPublishEvent, entries[1].Kind)
+	assert.Equal(t, OutboxNotifyWebhooks, entries[2].Kind)
+	assert.Nil(t, m.CompleteOutboxEntry(ctx, entries[1].ID))
+	assert.Nil(t, m.CompleteOutboxEntry(ctx, entries[2].ID))
+
+	// Claimed entries aren't handed out again until their lease has passed
+	claimedAgain, err := m.ClaimOutboxEntries(ctx, 10, time.Minute)
+	assert.Nil(t, err)
+	assert.Empty(t, claimedAgain)
+
+	err = m.RetryOutboxEntry(ctx, entries[0].ID, "IAC service unavailable", time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+	stuck, err := m.StuckOutboxEntries(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(stuck))
+	assert.Equal(t, "IAC service unavailable", stuck[0].LastError)
+
+	entries, err = m.ClaimOutboxEntries(ctx, 10, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	err = m.CompleteOutboxEntry(ctx, entries[0].ID)
+	assert.Nil(t, err)
+
+	stuck, err = m.StuckOutboxEntries(ctx, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, stuck)
+	assert.Equal(t, ErrNotFound, m.CompleteOutboxEntry(ctx, 6))
+}
+
+var allEventsWebhook = models.Webhook{ID: "6c4a2b5e-4c4e-4b8e-9a44-53a3c4f26e1b", URL: "https://example.com/all", EventTypes: []string{}, Secret: "shh"}
+var businessWebhook = models.Webhook{ID: "0d8e2f5c-3b7a-4c1e-8f6d-2a9b4c7e1f30", URL: "https://example.com/businesses",
+	EventTypes: []string{events.BusinessCreated, events.BusinessUpdated}, Secret: "hush"}
+
+func TestMemoryWebhooks(t *testing.T) {
+	m := NewMemory()
+	assert.Nil(t, m.CreateWebhook(ctx, allEventsWebhook))
+	assert.Nil(t, m.CreateWebhook(ctx, businessWebhook))
+
+	var storeErr *Error
+	assert.True(t, errors.As(m.CreateWebhook(ctx, allEventsWebhook), &storeErr))
+	assert.Equal(t, Unprocessable, storeErr.Kind)
+
+	listed, err := m.ListWebhooks(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(listed))
+	assert.Equal(t, allEventsWebhook.ID, listed[0].ID)
+	assert.Empty(t, listed[0].Secret)
+
+	webhook, err := m.GetWebhook(ctx, businessWebhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, businessWebhook, webhook)
+
+	assert.Nil(t, m.DeleteWebhook(ctx, businessWebhook.ID))
+	assert.Equal(t, ErrNotFound, m.DeleteWebhook(ctx, businessWebhook.ID))
+	_, err = m.GetWebhook(ctx, businessWebhook.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryQueueWebhookDeliveriesOnlyToSubscribers(t *testing.T) {
+	m := NewMemory()
+	assert.Nil(t, m.CreateWebhook(ctx, allEventsWebhook))
+	assert.Nil(t, m.CreateWebhook(ctx, businessWebhook))
+	event, err := events.New(events.RespondentCreated, events.RespondentCreatedVersion, events.RespondentCreatedData{RespondentID: bob.ID})
+	assert.Nil(t, err)
+
+	queued, err := m.QueueWebhookDeliveries(ctx, event)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, queued)
+	entries, err := m.ClaimOutboxEntries(ctx, 10, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, OutboxDeliverWebhook, entries[0].Kind)
+	var payload WebhookDeliveryPayload
+	assert.Nil(t, json.Unmarshal(entries[0].Payload, &payload))
+	assert.Equal(t, allEventsWebhook.ID, payload.WebhookID)
+	assert.Equal(t, event.ID, payload.Event.ID)
+}
+
+func TestMemoryWebhookDeliveries(t *testing.T) {
+	m := NewMemory()
+	assert.Nil(t, m.CreateWebhook(ctx, allEventsWebhook))
+	assert.Nil(t, m.CreateWebhook(ctx, businessWebhook))
+	for attempt := 1; attempt <= 2; attempt++ {
+		assert.Nil(t, m.RecordWebhookDelivery(ctx, models.WebhookDelivery{WebhookID: allEventsWebhook.ID, Attempt: attempt}))
+	}
+	assert.Nil(t, m.RecordWebhookDelivery(ctx, models.WebhookDelivery{WebhookID: businessWebhook.ID, Attempt: 1}))
+
+	deliveries, err := m.WebhookDeliveries(ctx, allEventsWebhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(deliveries))
+	assert.Equal(t, int64(2), deliveries[0].ID)
+	assert.Equal(t, 2, deliveries[0].Attempt)
+
+	// Deleting a webhook deletes its deliveries, but doesn't reuse their IDs
+	assert.Nil(t, m.DeleteWebhook(ctx, businessWebhook.ID))
+	_, err = m.WebhookDeliveries(ctx, businessWebhook.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, m.RecordWebhookDelivery(ctx, models.WebhookDelivery{WebhookID: allEventsWebhook.ID, Attempt: 3}))
+	deliveries, err = m.WebhookDeliveries(ctx, allEventsWebhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), deliveries[0].ID)
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Postgres stores parties in the partysvc schema of a Postgres database
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres creates a store backed by the database provided
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// Ensures that all the businesses being newly enrolled with exist
+func (p *Postgres) checkBusinessesExist(ctx context.Context, enrolments []NewEnrolment, businessIDs []string) error {
+	businessQuery, err := p.db.PrepareContext(ctx, "SELECT party_uuid FROM partysvc.business WHERE party_uuid=ANY($1)")
+	if err != nil {
+		return wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer businessQuery.Close()
+
+	rows, err := businessQuery.QueryContext(ctx, pq.Array(businessIDs))
+	if err != nil {
+		return wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	var existingBusinesses []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		existingBusinesses = append(existingBusinesses, id)
+	}
+
+	for _, enrolment := range enrolments {
+		if contains(businessIDs, enrolment.BusinessID) && !contains(existingBusinesses, enrolment.BusinessID) {
+			// Won't be able to associate with a business we can't find
+			return newError(Unprocessable, "Can't associate with the business for enrolment code: "+enrolment.Code)
+		}
+	}
+
+	return nil
+}
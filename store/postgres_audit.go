@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/lib/pq"
+)
+
+// Selects a respondent as selectRespondentsQuery does, but including any without business associations or enrolments
+const selectAuditedRespondentQuery = "SELECT r.id, r.email_address, r.first_name, r.last_name, r.telephone, r.status, " +
+	"br.business_id, e.survey_id, e.status " +
+	"FROM partysvc.respondent r LEFT JOIN partysvc.business_respondent br ON r.id=br.respondent_id " +
+	"LEFT JOIN partysvc.enrolment e ON br.business_id=e.business_id AND br.respondent_id=e.respondent_id WHERE r.id=$1"
+
+// Returns the respondent as they stand in the transaction, to record in the audit log
+func auditedRespondent(ctx context.Context, tx *sql.Tx, id string) (*models.Respondent, error) {
+	rows, err := tx.QueryContext(ctx, selectAuditedRespondentQuery, id)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	var respondent *models.Respondent
+	for rows.Next() {
+		var attributes models.Attributes
+		var status string
+		var businessID, surveyID, enrolmentStatus sql.NullString
+		err = rows.Scan(&attributes.ID, &attributes.EmailAddress, &attributes.FirstName, &attributes.LastName, &attributes.Telephone,
+			&status, &businessID, &surveyID, &enrolmentStatus)
+		if err != nil {
+			return nil, wrapError(Internal, "Error reading respondent for the audit log: ", err)
+		}
+		if respondent == nil {
+			respondent = &models.Respondent{Attributes: attributes, Status: status, Associations: []models.Association{}}
+		}
+		if !businessID.Valid {
+			continue
+		}
+
+		var association *models.Association
+		for idx := range respondent.Associations {
+			if respondent.Associations[idx].ID == businessID.String {
+				association = &respondent.Associations[idx]
+			}
+		}
+		if association == nil {
+			respondent.Associations = append(respondent.Associations, models.Association{ID: businessID.String, Enrolments: []models.Enrolment{}})
+			association = &respondent.Associations[len(respondent.Associations)-1]
+		}
+		if surveyID.Valid {
+			association.Enrolments = append(association.Enrolments, models.Enrolment{SurveyID: surveyID.String, EnrolmentStatus: enrolmentStatus.String})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(Internal, "Error reading respondent for the audit log: ", err)
+	}
+	if respondent == nil {
+		return nil, ErrNotFound
+	}
+	return respondent, nil
+}
+
+// Records the audit log entry as part of the transaction
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, entry models.AuditEntry) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO partysvc.audit_log (actor, action, respondent_id, business_ids, before, after, created_on) VALUES ($1,$2,$3,$4,$5,$6,$7)",
+		entry.Actor, entry.Action, entry.RespondentID, pq.Array(entry.BusinessIDs), nullableJSON(entry.Before), nullableJSON(entry.After), entry.CreatedOn)
+	if err != nil {
+		return wrapError(Unprocessable, "Can't record the change to respondent ID "+entry.RespondentID+" in the audit log: ", err)
+	}
+	return nil
+}
+
+// Returns the JSON as a value to store, which is NULL if there isn't any
+func nullableJSON(raw []byte) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// RespondentHistory returns the audit log of changes to the respondent, oldest first, which outlives the respondent
+// being deleted
+func (p *Postgres) RespondentHistory(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, actor, action, respondent_id, business_ids, before, after, created_on FROM partysvc.audit_log WHERE respondent_id=$1 ORDER BY id", id)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	history := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after []byte
+		if err = rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.RespondentID, pq.Array(&entry.BusinessIDs), &before, &after, &entry.CreatedOn); err != nil {
+			return nil, wrapError(Internal, "Error reading audit log: ", err)
+		}
+		entry.Before, entry.After = before, after
+		history = append(history, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(Internal, "Error reading audit log: ", err)
+	}
+	return history, nil
+}
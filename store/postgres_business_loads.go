@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/lib/pq"
+)
+
+// Returns the businesses with each ref only once, in the order they first appear. Each has the ID of the first row with
+// its ref, which is the one the business is created with, and everything else from the last.
+func uniqueBusinesses(businesses []models.Business) []models.Business {
+	unique := []models.Business{}
+	indexes := map[string]int{}
+	for _, business := range businesses {
+		idx, ok := indexes[business.SampleUnitRef]
+		if !ok {
+			indexes[business.SampleUnitRef] = len(unique)
+			unique = append(unique, business)
+			continue
+		}
+		id := unique[idx].ID
+		unique[idx] = business
+		unique[idx].ID = id
+	}
+	return unique
+}
+
+// LoadBusinesses creates or updates each of the businesses, identified by their RU references, along with their
+// attributes for their sample summary, all or none of them at once. Businesses which don't exist yet are created with
+// the IDs provided, and the IDs of those which do are filled in.
+//
+// The attributes are copied into a temporary table, so that a new version can be added for each business whose
+// attributes for the sample summary have changed, as UpdateBusiness would, in one statement rather than one per
+// business.
+func (p *Postgres) LoadBusinesses(ctx context.Context, businesses []models.Business) error {
+	if len(businesses) == 0 {
+		return nil
+	}
+
+	// Every row's attributes are recorded at the same time, so a ref repeated in the batch couldn't be told apart from
+	// its earlier rows. It's only loaded once, with the attributes of its last row.
+	loaded := uniqueBusinesses(businesses)
+	refs := make([]string, len(loaded))
+	for idx, business := range loaded {
+		refs[idx] = business.SampleUnitRef
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(Internal, "Error creating DB transaction: ", err)
+	}
+
+	existing, err := existingBusinessIDs(ctx, tx, refs)
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	created := []models.Business{}
+	for idx := range loaded {
+		if id, ok := existing[loaded[idx].SampleUnitRef]; ok {
+			loaded[idx].ID = id
+		} else {
+			created = append(created, loaded[idx])
+		}
+	}
+	ids := map[string]string{}
+	for _, business := range loaded {
+		ids[business.SampleUnitRef] = business.ID
+	}
+	for idx := range businesses {
+		businesses[idx].ID = ids[businesses[idx].SampleUnitRef]
+	}
+
+	if len(created) > 0 {
+		insertBusiness, err := tx.PrepareContext(ctx, pq.CopyIn("partysvc.business", "party_uuid", "business_ref", "created_on"))
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Internal, "Error creating DB prepared statement: ", err)
+		}
+		defer insertBusiness.Close()
+
+		for _, business := range created {
+			_, err = insertBusiness.ExecContext(ctx, business.ID, business.SampleUnitRef, time.Now())
+			if err != nil {
+				tx.Rollback()
+				return wrapError(Unprocessable, "Can't create a business with ID "+business.ID+": ", err)
+			}
+		}
+		_, err = insertBusiness.ExecContext(ctx)
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Unprocessable, "Can't commit businesses: ", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE TEMPORARY TABLE business_load_batch (business_id UUID, sample_summary_id TEXT, name TEXT, "+
+		"trading_as TEXT, attributes JSONB) ON COMMIT DROP")
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Error creating temporary table for businesses: ", err)
+	}
+
+	insertAttributes, err := tx.PrepareContext(ctx, pq.CopyIn("business_load_batch", "business_id", "sample_summary_id", "name", "trading_as", "attributes"))
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Error creating DB prepared statement: ", err)
+	}
+	defer insertAttributes.Close()
+
+	for _, business := range loaded {
+		attributes, err := json.Marshal(models.SampleAttributes(business.Attributes))
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Unprocessable, "Invalid attributes: ", err)
+		}
+		_, err = insertAttributes.ExecContext(ctx, business.ID, business.SampleSummaryID, business.Name, business.TradingAs, string(attributes))
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Unprocessable, "Can't load business attributes for business ID "+business.ID+": ", err)
+		}
+	}
+	_, err = insertAttributes.ExecContext(ctx)
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't commit business attributes: ", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO partysvc.business_attributes (business_id, sample_summary_id, collection_exercise, name, trading_as, "+
+		"attributes, created_on) SELECT l.business_id, l.sample_summary_id, latest.collection_exercise, l.name, l.trading_as, l.attributes, $1 "+
+		"FROM business_load_batch l"+latestSampleAttributesJoin("l.business_id", "l.sample_summary_id")+" WHERE latest.name IS DISTINCT FROM l.name "+
+		"OR latest.trading_as IS DISTINCT FROM l.trading_as OR latest.attributes IS DISTINCT FROM l.attributes", time.Now())
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't create business attributes: ", err)
+	}
+
+	entries := []models.OutboxEntry{}
+	for _, business := range loaded {
+		if _, ok := existing[business.SampleUnitRef]; ok {
+			entries = append(entries, businessEventEntries(events.BusinessUpdated, events.BusinessUpdatedVersion, business)...)
+		} else {
+			entries = append(entries, businessEventEntries(events.BusinessCreated, events.BusinessCreatedVersion, business)...)
+		}
+	}
+	if err = insertOutboxEntries(ctx, tx, entries); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Can't commit database transaction for businesses: ", err)
+	}
+
+	return nil
+}
+
+// Returns the IDs of the businesses which already exist with any of the RU references provided, by reference
+func existingBusinessIDs(ctx context.Context, tx *sql.Tx, refs []string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT party_uuid, business_ref FROM partysvc.business WHERE business_ref=ANY($1)", pq.Array(refs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[string]string{}
+	for rows.Next() {
+		var id, ref string
+		if err = rows.Scan(&id, &ref); err != nil {
+			return nil, err
+		}
+		existing[ref] = id
+	}
+	return existing, rows.Err()
+}
+
+// CreateBusinessLoad records a new job loading businesses from a sample file, with the ID provided
+func (p *Postgres) CreateBusinessLoad(ctx context.Context, load models.BusinessLoad) error {
+	loadErrors, err := json.Marshal(load.Errors)
+	if err != nil {
+		return wrapError(Internal, "Invalid business load errors: ", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, "INSERT INTO partysvc.business_load (id, sample_summary_id, status, total_rows, loaded_rows, errors, created_on, "+
+		"completed_on) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)", load.ID, load.SampleSummaryID, load.Status, load.Rows, load.Loaded, string(loadErrors),
+		load.CreatedOn, load.CompletedOn)
+	if err != nil {
+		return wrapError(Unprocessable, "Can't create a business load with ID "+load.ID+": ", err)
+	}
+	return nil
+}
+
+// UpdateBusinessLoad records how far the job loading businesses has got, or returns ErrNotFound
+func (p *Postgres) UpdateBusinessLoad(ctx context.Context, load models.BusinessLoad) error {
+	loadErrors, err := json.Marshal(load.Errors)
+	if err != nil {
+		return wrapError(Internal, "Invalid business load errors: ", err)
+	}
+
+	res, err := p.db.ExecContext(ctx, "UPDATE partysvc.business_load SET status=$1, loaded_rows=$2, errors=$3, completed_on=$4, updated_on=$5 WHERE id=$6",
+		load.Status, load.Loaded, string(loadErrors), load.CompletedOn, time.Now(), load.ID)
+	if err != nil {
+		return wrapError(Internal, "Can't update business load with ID "+load.ID+": ", err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetBusinessLoad returns the job loading businesses with the ID provided, or ErrNotFound
+func (p *Postgres) GetBusinessLoad(ctx context.Context, id string) (models.BusinessLoad, error) {
+	var load models.BusinessLoad
+	var loadErrors []byte
+	var completedOn sql.NullTime
+	err := p.db.QueryRowContext(ctx, "SELECT id, sample_summary_id, status, total_rows, loaded_rows, errors, created_on, completed_on "+
+		"FROM partysvc.business_load WHERE id=$1", id).
+		Scan(&load.ID, &load.SampleSummaryID, &load.Status, &load.Rows, &load.Loaded, &loadErrors, &load.CreatedOn, &completedOn)
+	if err == sql.ErrNoRows {
+		return models.BusinessLoad{}, ErrNotFound
+	}
+	if err != nil {
+		return models.BusinessLoad{}, wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	if err = json.Unmarshal(loadErrors, &load.Errors); err != nil {
+		return models.BusinessLoad{}, wrapError(Internal, "Error reading business load errors: ", err)
+	}
+	if completedOn.Valid {
+		load.CompletedOn = &completedOn.Time
+	}
+	return load, nil
+}
+
+// FailStaleBusinessLoads marks the jobs loading businesses which are still running, but haven't recorded any progress
+// since the time provided, as failed, and returns how many there were
+func (p *Postgres) FailStaleBusinessLoads(ctx context.Context, before time.Time) (int, error) {
+	now := time.Now()
+	res, err := p.db.ExecContext(ctx, "UPDATE partysvc.business_load SET status=$1, completed_on=$2, updated_on=$2 WHERE status=$3 AND updated_on<$4",
+		BusinessLoadFailed, now, BusinessLoadRunning, before)
+	if err != nil {
+		return 0, wrapError(Internal, "Can't fail stale business loads: ", err)
+	}
+
+	failed, err := res.RowsAffected()
+	if err != nil {
+		return 0, wrapError(Internal, "Error querying DB: ", err)
+	}
+	return int(failed), nil
+}
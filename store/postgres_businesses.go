@@ -0,0 +1,425 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/query"
+	"github.com/lib/pq"
+)
+
+// Joins each business (b) to its most recent set of attributes (ba). Sets created in the same transaction share a
+// created_on, so ties go to the one inserted last.
+const latestBusinessAttributesJoin = " LEFT JOIN LATERAL (SELECT id, sample_summary_id, name, trading_as, attributes FROM partysvc.business_attributes " +
+	"WHERE business_id=b.party_uuid ORDER BY created_on DESC, id DESC LIMIT 1) ba ON true"
+
+// Returns a join to the most recent attributes (latest) of the business for the sample summary, as SQL expressions
+func latestSampleAttributesJoin(businessID, sampleSummaryID string) string {
+	return " LEFT JOIN LATERAL (SELECT collection_exercise, name, trading_as, attributes FROM partysvc.business_attributes WHERE business_id=" +
+		businessID + " AND sample_summary_id=" + sampleSummaryID + " ORDER BY created_on DESC, id DESC LIMIT 1) latest ON true"
+}
+
+const selectBusinessesQuery = "SELECT b.party_uuid, b.business_ref, ba.id, ba.sample_summary_id, ba.name, ba.trading_as, ba.attributes " +
+	"FROM partysvc.business b" + latestBusinessAttributesJoin
+
+func rowsToBusinessesModel(rows *sql.Rows) ([]models.Business, error) {
+	businesses := []models.Business{}
+	for rows.Next() {
+		var attributesID sql.NullInt64
+		var sampleSummaryID, name, tradingAs sql.NullString
+		var attributes []byte
+		business := models.Business{Associations: []models.Association{}}
+
+		err := rows.Scan(
+			&business.ID,
+			&business.SampleUnitRef,
+			&attributesID,
+			&sampleSummaryID,
+			&name,
+			&tradingAs,
+			&attributes,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		business.SampleSummaryID = sampleSummaryID.String
+		business.Name = name.String
+		business.TradingAs = tradingAs.String
+		if len(attributes) > 0 {
+			var sampleAttributes models.SampleAttributes
+			if err := json.Unmarshal(attributes, &sampleAttributes); err != nil {
+				return nil, err
+			}
+			business.Attributes = models.BusinessAttributes(sampleAttributes)
+		}
+
+		businesses = append(businesses, business)
+	}
+
+	return businesses, rows.Err()
+}
+
+func (p *Postgres) getBusinessAssociations(ctx context.Context, businesses []models.Business) error {
+	if len(businesses) == 0 {
+		return nil
+	}
+
+	businessIDs := make([]string, len(businesses))
+	for idx, business := range businesses {
+		businessIDs[idx] = business.ID
+	}
+
+	rows, err := p.db.QueryContext(ctx, "SELECT br.business_id, r.id, r.first_name, r.last_name, e.survey_id, e.status AS enrolment_status "+
+		"FROM partysvc.business_respondent br JOIN partysvc.respondent r ON br.respondent_id=r.id "+
+		"LEFT JOIN partysvc.enrolment e ON br.business_id=e.business_id AND br.respondent_id=e.respondent_id "+
+		"WHERE br.business_id=ANY($1)", pq.Array(businessIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var businessID, respondentID, firstName, lastName string
+		var surveyID, enrolmentStatus sql.NullString
+		if err := rows.Scan(&businessID, &respondentID, &firstName, &lastName, &surveyID, &enrolmentStatus); err != nil {
+			return err
+		}
+
+		for idx := range businesses {
+			business := &businesses[idx]
+			if business.ID != businessID {
+				continue
+			}
+
+			found := false
+			for assocIdx := range business.Associations {
+				if business.Associations[assocIdx].ID == respondentID {
+					found = true
+					// Only add the enrolment if there actually is one
+					if surveyID.Valid && enrolmentStatus.Valid {
+						business.Associations[assocIdx].Enrolments = append(business.Associations[assocIdx].Enrolments,
+							models.Enrolment{SurveyID: surveyID.String, EnrolmentStatus: enrolmentStatus.String})
+					}
+					break
+				}
+			}
+			if !found {
+				association := models.Association{
+					ID:            respondentID,
+					Name:          strings.TrimSpace(firstName + " " + lastName),
+					SampleUnitRef: business.SampleUnitRef,
+					Enrolments:    []models.Enrolment{},
+				}
+				if surveyID.Valid && enrolmentStatus.Valid {
+					association.Enrolments = append(association.Enrolments,
+						models.Enrolment{SurveyID: surveyID.String, EnrolmentStatus: enrolmentStatus.String})
+				}
+				business.Associations = append(business.Associations, association)
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// Retrieves the businesses selected by the query provided, complete with their respondent associations
+func (p *Postgres) queryBusinesses(ctx context.Context, queryString string, args []interface{}) ([]models.Business, error) {
+	rows, err := p.db.QueryContext(ctx, queryString, args...)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	businesses, err := rowsToBusinessesModel(rows)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	if err = p.getBusinessAssociations(ctx, businesses); err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	return businesses, nil
+}
+
+// SearchBusinesses returns the requested page of businesses matching the search, and the total number matching
+func (p *Postgres) SearchBusinesses(ctx context.Context, search BusinessSearch) ([]models.Business, int, error) {
+	// Every keyword must partially match the business name, trading as or reference
+	selectBusinesses := query.NewSelect(selectBusinessesQuery)
+	for _, keyword := range search.Keywords {
+		pattern := query.LikeContains(keyword)
+		selectBusinesses.Where("(b.business_ref ILIKE ? OR ba.name ILIKE ? OR ba.trading_as ILIKE ?)", pattern, pattern, pattern)
+	}
+	selectBusinesses.OrderBy("ba.name, b.business_ref").Limit(search.Limit).Offset((search.Page - 1) * search.Limit)
+
+	var total int
+	countString, args := selectBusinesses.Count("SELECT COUNT(*) FROM partysvc.business b" + latestBusinessAttributesJoin)
+	err := p.db.QueryRowContext(ctx, countString, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, wrapError(Internal, "Error querying DB: ", err)
+	}
+	if total == 0 {
+		return []models.Business{}, 0, nil
+	}
+
+	queryString, args := selectBusinesses.Build()
+	businesses, err := p.queryBusinesses(ctx, queryString, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return businesses, total, nil
+}
+
+// GetBusiness returns the business with the ID provided, or ErrNotFound
+func (p *Postgres) GetBusiness(ctx context.Context, id string) (models.Business, error) {
+	queryString, args := query.NewSelect(selectBusinessesQuery).WhereEquals("b.party_uuid", id).Build()
+	businesses, err := p.queryBusinesses(ctx, queryString, args)
+	if err != nil {
+		return models.Business{}, err
+	}
+	if len(businesses) == 0 {
+		return models.Business{}, ErrNotFound
+	}
+
+	return businesses[0], nil
+}
+
+// GetBusinessForCollectionExercise returns the business with the ID provided, with the attributes it had in the
+// collection exercise, or ErrNotFound. It's Missing if the business wasn't in the collection exercise.
+func (p *Postgres) GetBusinessForCollectionExercise(ctx context.Context, id string, collectionExerciseID string) (models.Business, error) {
+	businesses, err := p.queryBusinesses(ctx, "SELECT b.party_uuid, b.business_ref, ba.id, ba.sample_summary_id, ba.name, ba.trading_as, ba.attributes "+
+		"FROM partysvc.business b JOIN LATERAL (SELECT id, sample_summary_id, name, trading_as, attributes FROM partysvc.business_attributes "+
+		"WHERE business_id=b.party_uuid AND collection_exercise=$1 ORDER BY created_on DESC, id DESC LIMIT 1) ba ON true WHERE b.party_uuid=$2",
+		[]interface{}{collectionExerciseID, id})
+	if err != nil {
+		return models.Business{}, err
+	}
+	if len(businesses) > 0 {
+		return businesses[0], nil
+	}
+
+	// Tell a business which doesn't exist apart from one which wasn't in the collection exercise
+	if _, err = p.GetBusiness(ctx, id); err != nil {
+		return models.Business{}, err
+	}
+	return models.Business{}, newError(Missing, "Business ID "+id+" isn't in collection exercise "+collectionExerciseID)
+}
+
+// BusinessAttributesHistory returns every version of the business's attributes, oldest first
+func (p *Postgres) BusinessAttributesHistory(ctx context.Context, id string) ([]models.BusinessAttributesVersion, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, sample_summary_id, collection_exercise, name, trading_as, attributes, created_on "+
+		"FROM partysvc.business_attributes WHERE business_id=$1 ORDER BY created_on, id", id)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	history := []models.BusinessAttributesVersion{}
+	for rows.Next() {
+		var version models.BusinessAttributesVersion
+		var sampleSummaryID, collectionExerciseID, name, tradingAs sql.NullString
+		var attributes []byte
+		err = rows.Scan(&version.ID, &sampleSummaryID, &collectionExerciseID, &name, &tradingAs, &attributes, &version.CreatedOn)
+		if err != nil {
+			return nil, wrapError(Internal, "Error querying DB: ", err)
+		}
+
+		version.SampleSummaryID = sampleSummaryID.String
+		version.CollectionExerciseID = collectionExerciseID.String
+		version.Name = name.String
+		version.TradingAs = tradingAs.String
+		if len(attributes) > 0 {
+			var sampleAttributes models.SampleAttributes
+			if err = json.Unmarshal(attributes, &sampleAttributes); err != nil {
+				return nil, wrapError(Internal, "Error querying DB: ", err)
+			}
+			version.Attributes = models.BusinessAttributes(sampleAttributes)
+		}
+		history = append(history, version)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	return history, nil
+}
+
+// GetBusinessByRef returns the business with the RU reference (sample unit ref) provided, or ErrNotFound
+func (p *Postgres) GetBusinessByRef(ctx context.Context, ref string) (models.Business, error) {
+	queryString, args := query.NewSelect(selectBusinessesQuery).WhereEquals("b.business_ref", ref).Build()
+	businesses, err := p.queryBusinesses(ctx, queryString, args)
+	if err != nil {
+		return models.Business{}, err
+	}
+	if len(businesses) == 0 {
+		return models.Business{}, ErrNotFound
+	}
+
+	return businesses[0], nil
+}
+
+// GetBusinessesByRefs returns the businesses with any of the RU references provided, ordered by reference. Refs which
+// no business has are skipped.
+func (p *Postgres) GetBusinessesByRefs(ctx context.Context, refs []string) ([]models.Business, error) {
+	if len(refs) == 0 {
+		return []models.Business{}, nil
+	}
+	queryString, args := query.NewSelect(selectBusinessesQuery).Where("b.business_ref=ANY(?)", pq.Array(refs)).
+		OrderBy("b.business_ref").Build()
+	return p.queryBusinesses(ctx, queryString, args)
+}
+
+// CreateBusiness creates a business with the ID provided
+func (p *Postgres) CreateBusiness(ctx context.Context, business models.Business) error {
+	attributes, err := json.Marshal(models.SampleAttributes(business.Attributes))
+	if err != nil {
+		return wrapError(Unprocessable, "Invalid attributes: ", err)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(Internal, "Error creating DB transaction: ", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO partysvc.business (party_uuid, business_ref, created_on) VALUES ($1,$2,$3)",
+		business.ID, business.SampleUnitRef, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't create a business with ID "+business.ID+": ", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO partysvc.business_attributes (business_id, sample_summary_id, name, trading_as, attributes, created_on) "+
+		"VALUES ($1,$2,$3,$4,$5,$6)", business.ID, business.SampleSummaryID, business.Name, business.TradingAs, attributes, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't create business attributes for business ID "+business.ID+": ", err)
+	}
+
+	if err = insertOutboxEntries(ctx, tx, businessEventEntries(events.BusinessCreated, events.BusinessCreatedVersion, business)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Can't commit database transaction for business ID "+business.ID+": ", err)
+	}
+
+	return nil
+}
+
+// UpdateBusiness replaces the stored state of the business with the one provided, and adds it to the samples provided,
+// or returns ErrNotFound. Changed attributes are recorded as a new version for the business's sample summary, leaving
+// the previous ones in its history.
+func (p *Postgres) UpdateBusiness(ctx context.Context, business models.Business, samples []models.Sample) error {
+	attributes, err := json.Marshal(models.SampleAttributes(business.Attributes))
+	if err != nil {
+		return wrapError(Unprocessable, "Invalid attributes: ", err)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(Internal, "Error creating DB transaction: ", err)
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE partysvc.business SET business_ref=$1 WHERE party_uuid=$2", business.SampleUnitRef, business.ID)
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't update business for ID "+business.ID+": ", err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		tx.Rollback()
+		return ErrNotFound
+	}
+
+	// A version is only added if the attributes differ from the latest ones for the sample summary, and stays linked to
+	// the sample's collection exercise if it's been linked
+	_, err = tx.ExecContext(ctx, "INSERT INTO partysvc.business_attributes (business_id, sample_summary_id, collection_exercise, name, trading_as, "+
+		"attributes, created_on) SELECT $1, $2, latest.collection_exercise, $3, $4, $5, $6 FROM (SELECT 1) new"+latestSampleAttributesJoin("$1", "$2")+
+		" WHERE latest.name IS DISTINCT FROM $3 OR latest.trading_as IS DISTINCT FROM $4 OR latest.attributes IS DISTINCT FROM $5::jsonb",
+		business.ID, business.SampleSummaryID, business.Name, business.TradingAs, attributes, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't update business attributes for ID "+business.ID+": ", err)
+	}
+
+	// A business being added to a sample it has no attributes for gets a copy of its current ones for the sample
+	for _, sample := range samples {
+		res, err = tx.ExecContext(ctx, "UPDATE partysvc.business_attributes SET collection_exercise=$1 WHERE business_id=$2 AND sample_summary_id=$3",
+			sample.CollectionExerciseID, business.ID, sample.SampleSummaryID)
+		if err == nil {
+			if aff, _ := res.RowsAffected(); aff == 0 {
+				_, err = tx.ExecContext(ctx, "INSERT INTO partysvc.business_attributes (business_id, sample_summary_id, collection_exercise, name, "+
+					"trading_as, attributes, created_on) VALUES ($1,$2,$3,$4,$5,$6,$7)", business.ID, sample.SampleSummaryID, sample.CollectionExerciseID,
+					business.Name, business.TradingAs, attributes, time.Now())
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Unprocessable, "Can't add business ID "+business.ID+" to sample summary "+sample.SampleSummaryID+": ", err)
+		}
+	}
+
+	if err = insertOutboxEntries(ctx, tx, businessEventEntries(events.BusinessUpdated, events.BusinessUpdatedVersion, business)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Can't commit transaction for business ID "+business.ID+": ", err)
+	}
+
+	return nil
+}
+
+// BusinessSamples returns the samples the business is in, in the order it was added to them
+func (p *Postgres) BusinessSamples(ctx context.Context, businessID string) ([]models.Sample, error) {
+	// Every version for a sample has the same collection exercise, as linking the sample links them all
+	rows, err := p.db.QueryContext(ctx, "SELECT sample_summary_id, collection_exercise FROM partysvc.business_attributes "+
+		"WHERE business_id=$1 AND sample_summary_id IS NOT NULL GROUP BY sample_summary_id, collection_exercise ORDER BY MIN(created_on)", businessID)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	samples := []models.Sample{}
+	for rows.Next() {
+		var sampleSummaryID string
+		var collectionExerciseID sql.NullString
+		if err = rows.Scan(&sampleSummaryID, &collectionExerciseID); err != nil {
+			return nil, wrapError(Internal, "Error querying DB: ", err)
+		}
+		// Businesses created without a sample have attributes with an empty sample summary
+		if sampleSummaryID != "" {
+			samples = append(samples, models.Sample{SampleSummaryID: sampleSummaryID, CollectionExerciseID: collectionExerciseID.String})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	return samples, nil
+}
+
+// LinkSampleSummary links the sample summary to the collection exercise, for every business in the sample, and returns
+// how many businesses there were
+func (p *Postgres) LinkSampleSummary(ctx context.Context, sampleSummaryID string, collectionExerciseID string) (int, error) {
+	// A business can have several versions of its attributes for the sample
+	var linked int
+	err := p.db.QueryRowContext(ctx, "WITH linked AS (UPDATE partysvc.business_attributes SET collection_exercise=$1 WHERE sample_summary_id=$2 "+
+		"RETURNING business_id) SELECT COUNT(DISTINCT business_id) FROM linked", collectionExerciseID, sampleSummaryID).Scan(&linked)
+	if err != nil {
+		return 0, wrapError(Unprocessable, "Can't link sample summary "+sampleSummaryID+": ", err)
+	}
+	return linked, nil
+}
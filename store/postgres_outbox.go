@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/lib/pq"
+)
+
+const outboxColumns = "id, kind, payload, attempts, COALESCE(last_error, ''), next_attempt_at, created_on"
+
+// Records the outbox entries as part of the transaction, to be dispatched once it's committed
+func insertOutboxEntries(ctx context.Context, tx *sql.Tx, entries []models.OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	insertOutboxEntry, err := tx.PrepareContext(ctx, pq.CopyIn("partysvc.outbox", "kind", "payload", "next_attempt_at", "created_on"))
+	if err != nil {
+		return wrapError(Internal, "Error creating DB prepared statement: ", err)
+	}
+	defer insertOutboxEntry.Close()
+
+	for _, entry := range entries {
+		_, err = insertOutboxEntry.ExecContext(ctx, entry.Kind, string(entry.Payload), time.Now(), time.Now())
+		if err != nil {
+			return wrapError(Unprocessable, "Can't create an outbox entry of kind "+entry.Kind+": ", err)
+		}
+	}
+	_, err = insertOutboxEntry.ExecContext(ctx)
+	if err != nil {
+		return wrapError(Unprocessable, "Can't commit outbox entries: ", err)
+	}
+
+	return nil
+}
+
+func rowsToOutboxEntries(rows *sql.Rows) ([]models.OutboxEntry, error) {
+	entries := []models.OutboxEntry{}
+	for rows.Next() {
+		var entry models.OutboxEntry
+		var payload []byte
+		err := rows.Scan(&entry.ID, &entry.Kind, &payload, &entry.Attempts, &entry.LastError, &entry.NextAttempt, &entry.CreatedOn)
+		if err != nil {
+			return nil, wrapError(Internal, "Error reading outbox entries: ", err)
+		}
+		entry.Payload = payload
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError(Internal, "Error reading outbox entries: ", err)
+	}
+	return entries, nil
+}
+
+// ClaimOutboxEntries returns up to limit entries which are due to be dispatched, oldest first, and stops them being
+// claimed again until the lease has passed. Entries claimed by another instance at the same time are skipped.
+func (p *Postgres) ClaimOutboxEntries(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error) {
+	now := time.Now()
+	rows, err := p.db.QueryContext(ctx, "UPDATE partysvc.outbox SET next_attempt_at=$1 WHERE id IN "+
+		"(SELECT id FROM partysvc.outbox WHERE dispatched_on IS NULL AND next_attempt_at<=$2 ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED) "+
+		"RETURNING "+outboxColumns, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	entries, err := rowsToOutboxEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING doesn't keep the order of the sub-query
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// CompleteOutboxEntry records that the entry has been dispatched
+func (p *Postgres) CompleteOutboxEntry(ctx context.Context, id int64) error {
+	res, err := p.db.ExecContext(ctx, "UPDATE partysvc.outbox SET attempts=attempts+1, dispatched_on=$1 WHERE id=$2", time.Now(), id)
+	if err != nil {
+		return wrapError(Internal, "Can't complete outbox entry "+strconv.FormatInt(id, 10)+": ", err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RetryOutboxEntry records a failed attempt to dispatch the entry, and when to try again
+func (p *Postgres) RetryOutboxEntry(ctx context.Context, id int64, lastError string, nextAttempt time.Time) error {
+	res, err := p.db.ExecContext(ctx, "UPDATE partysvc.outbox SET attempts=attempts+1, last_error=$1, next_attempt_at=$2 WHERE id=$3", lastError, nextAttempt, id)
+	if err != nil {
+		return wrapError(Internal, "Can't record failed attempt for outbox entry "+strconv.FormatInt(id, 10)+": ", err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// StuckOutboxEntries returns the entries which still haven't been dispatched after at least minAttempts, oldest first
+func (p *Postgres) StuckOutboxEntries(ctx context.Context, minAttempts int) ([]models.OutboxEntry, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT "+outboxColumns+" FROM partysvc.outbox WHERE dispatched_on IS NULL AND attempts>=$1 ORDER BY id", minAttempts)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	return rowsToOutboxEntries(rows)
+}
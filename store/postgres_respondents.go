@@ -0,0 +1,525 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/query"
+	"github.com/lib/pq"
+)
+
+const selectRespondentsQuery = "SELECT r.id, r.email_address, r.first_name, r.last_name, r.telephone, r.status, br.business_id, e.status AS enrolment_status, e.survey_id " +
+	"FROM partysvc.respondent r JOIN partysvc.business_respondent br ON r.id=br.respondent_id " +
+	"JOIN partysvc.enrolment e ON br.business_id=e.business_id AND br.respondent_id=e.respondent_id"
+
+// The columns each of the RespondentFilters filter on
+var respondentFilterColumns = map[string]string{
+	"firstName":    "r.first_name",
+	"lastName":     "r.last_name",
+	"emailAddress": "r.email_address",
+	"telephone":    "r.telephone",
+	"status":       "r.status",
+	"businessId":   "br.business_id",
+	"surveyId":     "e.survey_id",
+}
+
+func rowsToRespondentsModel(rows *sql.Rows) []models.Respondent {
+	respMap := make(map[string]*models.Respondent)
+	// Keep the respondents in the order they were first returned
+	respIDs := []string{}
+	for rows.Next() {
+		respondent := models.Respondent{
+			Attributes:   models.Attributes{},
+			Associations: []models.Association{},
+		}
+		association := models.Association{Enrolments: []models.Enrolment{}}
+		enrolment := models.Enrolment{}
+
+		rows.Scan(
+			&respondent.Attributes.ID,
+			&respondent.Attributes.EmailAddress,
+			&respondent.Attributes.FirstName,
+			&respondent.Attributes.LastName,
+			&respondent.Attributes.Telephone,
+			&respondent.Status,
+			&association.ID,
+			&enrolment.SurveyID,
+			&enrolment.EnrolmentStatus,
+		)
+
+		// If we already have this respondent in the rowset, it's a new association or enrolment
+		if val, ok := respMap[respondent.Attributes.ID]; ok {
+			found := false
+			// If we already have this business association, it's a new enrolment for that association
+			for idx := range val.Associations {
+				if val.Associations[idx].ID == association.ID {
+					found = true
+					val.Associations[idx].Enrolments = append(val.Associations[idx].Enrolments, enrolment)
+					break
+				}
+			}
+			if !found {
+				// Only add the enrolment if there actually is one
+				if enrolment.EnrolmentStatus != "" && enrolment.SurveyID != "" {
+					association.Enrolments = append(association.Enrolments, enrolment)
+				}
+				val.Associations = append(val.Associations, association)
+			}
+		} else {
+			// Only add the enrolment if there actually is one
+			if enrolment.EnrolmentStatus != "" && enrolment.SurveyID != "" {
+				association.Enrolments = append(association.Enrolments, enrolment)
+			}
+			respondent.Associations = append(respondent.Associations, association)
+			respMap[respondent.Attributes.ID] = &respondent
+			respIDs = append(respIDs, respondent.Attributes.ID)
+		}
+	}
+
+	respondents := []models.Respondent{}
+	for _, id := range respIDs {
+		respondents = append(respondents, *respMap[id])
+	}
+
+	return respondents
+}
+
+// SearchRespondents returns all respondents matching the search
+func (p *Postgres) SearchRespondents(ctx context.Context, search RespondentSearch) ([]models.Respondent, error) {
+	selectRespondents := query.NewSelect(selectRespondentsQuery)
+	for _, filter := range RespondentFilters {
+		if value, ok := search.Filters[filter]; ok {
+			selectRespondents.WhereEquals(respondentFilterColumns[filter], value)
+		}
+	}
+	if search.Offset != nil {
+		selectRespondents.Offset(*search.Offset)
+	}
+	if search.Limit != nil {
+		selectRespondents.Limit(*search.Limit)
+	}
+
+	queryString, args := selectRespondents.Build()
+	rows, err := p.db.QueryContext(ctx, queryString, args...)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	return rowsToRespondentsModel(rows), nil
+}
+
+// GetRespondent returns the respondent with the ID provided, or ErrNotFound
+func (p *Postgres) GetRespondent(ctx context.Context, id string) (models.Respondent, error) {
+	rows, err := p.db.QueryContext(ctx, selectRespondentsQuery+" WHERE r.id=$1", id)
+	if err != nil {
+		return models.Respondent{}, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	respondents := rowsToRespondentsModel(rows)
+	if len(respondents) == 0 {
+		return models.Respondent{}, ErrNotFound
+	}
+
+	return respondents[0], nil
+}
+
+// Returns whether the error is a violation of the respondent table's unique constraint on email addresses
+func emailInUse(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "unique_violation" && pqErr.Constraint == "respondent_email_address_key"
+}
+
+// CreateRespondent creates a respondent with the ID provided, associated with the businesses and enrolled (pending)
+// on the surveys of the enrolments provided
+func (p *Postgres) CreateRespondent(ctx context.Context, respondent models.Attributes, enrolments []NewEnrolment) error {
+	respondentID := respondent.ID
+	businessIDs := enrolmentBusinessIDs(enrolments)
+
+	if err := p.checkBusinessesExist(ctx, enrolments, businessIDs); err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(Internal, "Error creating DB transaction: ", err)
+	}
+
+	insertRespondent, err := tx.PrepareContext(ctx, "INSERT INTO partysvc.respondent (id, status, email_address, first_name, last_name, telephone, created_on) VALUES ($1,$2,$3,$4,$5,$6,$7)")
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Error creating DB prepared statement: ", err)
+	}
+	defer insertRespondent.Close()
+
+	_, err = insertRespondent.ExecContext(ctx, respondentID, "CREATED", respondent.EmailAddress, respondent.FirstName,
+		respondent.LastName, respondent.Telephone, time.Now())
+	// The memory store reports a duplicate email address the same way
+	if emailInUse(err) {
+		tx.Rollback()
+		return newError(Conflict, "New email address already in use")
+	}
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't create a respondent with ID "+respondentID+": ", err)
+	}
+
+	if err = insertBusinessRespondents(ctx, tx, respondentID, businessIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	insertPendingEnrolment, err := tx.PrepareContext(ctx, pq.CopyIn("partysvc.pending_enrolment", "case_id", "respondent_id", "business_id", "survey_id", "created_on"))
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Error creating DB prepared statement: ", err)
+	}
+	defer insertPendingEnrolment.Close()
+
+	insertEnrolment, err := tx.PrepareContext(ctx, pq.CopyIn("partysvc.enrolment", "respondent_id", "business_id", "survey_id", "status", "created_on"))
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Error creating DB prepared statement: ", err)
+	}
+	defer insertEnrolment.Close()
+
+	for _, enrolment := range enrolments {
+		_, err := insertPendingEnrolment.ExecContext(ctx, enrolment.CaseID, respondentID, enrolment.BusinessID, enrolment.SurveyID, time.Now())
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Unprocessable, "Can't create a Pending Enrolment with respondent ID "+respondentID+" and business ID "+enrolment.BusinessID+": ", err)
+		}
+
+		_, err = insertEnrolment.ExecContext(ctx, respondentID, enrolment.BusinessID, enrolment.SurveyID, "PENDING", time.Now())
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Unprocessable, "Can't create an Enrolment with respondent ID "+respondentID+" and business ID "+enrolment.BusinessID+": ", err)
+		}
+	}
+
+	_, err = insertPendingEnrolment.ExecContext(ctx)
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't commit pending enrolments with respondent ID "+respondentID+": ", err)
+	}
+	_, err = insertEnrolment.ExecContext(ctx)
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Unprocessable, "Can't commit enrolments with respondent ID "+respondentID+": ", err)
+	}
+
+	if err = insertOutboxEntries(ctx, tx, deactivationEntries(enrolments)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	created := models.Respondent{Attributes: respondent, Status: "CREATED", Associations: []models.Association{}}
+	enrol(&created, enrolments)
+	if err = insertOutboxEntries(ctx, tx, respondentEventEntries(nil, &created)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = insertAuditEntry(ctx, tx, auditEntry(ctx, AuditCreate, respondentID, nil, &created)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Can't commit database transaction for respondent ID "+respondentID+": ", err)
+	}
+
+	return nil
+}
+
+// Links the respondent to each of the businesses provided
+func insertBusinessRespondents(ctx context.Context, tx *sql.Tx, respondentID string, businessIDs []string) error {
+	insertBusinessRespondent, err := tx.PrepareContext(ctx, pq.CopyIn("partysvc.business_respondent", "business_id", "respondent_id", "status", "effective_from", "created_on"))
+	if err != nil {
+		return wrapError(Internal, "Error creating DB prepared statement: ", err)
+	}
+	defer insertBusinessRespondent.Close()
+
+	for _, businessID := range businessIDs {
+		_, err = insertBusinessRespondent.ExecContext(ctx, businessID, respondentID, "ACTIVE", time.Now(), time.Now())
+		if err != nil {
+			return wrapError(Unprocessable, "Can't create a business/respondent link with respondent ID "+respondentID+" and business ID "+businessID+": ", err)
+		}
+	}
+	_, err = insertBusinessRespondent.ExecContext(ctx)
+	if err != nil {
+		return wrapError(Unprocessable, "Can't commit business/respondent links with respondent ID "+respondentID+": ", err)
+	}
+
+	return nil
+}
+
+// UpdateRespondent applies all of the changes to the respondent, or none of them
+func (p *Postgres) UpdateRespondent(ctx context.Context, id string, update RespondentUpdate) error {
+	// Resolving the enrolments calls other services, so it's done before starting the transaction rather than holding
+	// its locks and connection for as long as they take
+	var enrolments []NewEnrolment
+	if update.ResolveEnrolments != nil {
+		var respondentID string
+		err := p.db.QueryRowContext(ctx, "SELECT id FROM partysvc.respondent WHERE id=$1", id).Scan(&respondentID)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return wrapError(Internal, "Error querying DB: ", err)
+		}
+
+		if enrolments, err = update.ResolveEnrolments(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(Internal, "Error creating DB transaction: ", err)
+	}
+
+	// The respondent may have been deleted while the enrolments were being resolved. Their row is locked until the
+	// update is committed, so that they can't be deleted or changed by anything else in the meantime.
+	var respondentID string
+	var emailAddress string
+	err = tx.QueryRowContext(ctx, "SELECT id, email_address FROM partysvc.respondent WHERE id=$1 FOR UPDATE", id).Scan(&respondentID, &emailAddress)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	before, err := auditedRespondent(ctx, tx, respondentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if update.Attributes.EmailAddress != "" && update.Attributes.EmailAddress != emailAddress {
+		var count int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM partysvc.respondent WHERE email_address=$1", update.Attributes.EmailAddress).Scan(&count)
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Internal, "Error querying DB: ", err)
+		}
+		if count > 0 {
+			tx.Rollback()
+			return newError(Conflict, "New email address already in use")
+		}
+	}
+
+	updateRespondent := query.NewUpdate("partysvc.respondent")
+	if update.Attributes.FirstName != "" {
+		updateRespondent.Set("first_name", update.Attributes.FirstName)
+	}
+	if update.Attributes.LastName != "" {
+		updateRespondent.Set("last_name", update.Attributes.LastName)
+	}
+	if update.Attributes.EmailAddress != "" {
+		updateRespondent.Set("email_address", update.Attributes.EmailAddress)
+	}
+	if update.Attributes.Telephone != "" {
+		updateRespondent.Set("telephone", update.Attributes.Telephone)
+	}
+	if update.Status != "" {
+		updateRespondent.Set("status", update.Status)
+	}
+	if updateRespondent.HasChanges() {
+		updateString, args, _ := updateRespondent.WhereEquals("id", respondentID).Build()
+		_, err := tx.ExecContext(ctx, updateString, args...)
+		// Another respondent may have taken the email address since it was checked, which the constraint catches
+		if emailInUse(err) {
+			tx.Rollback()
+			return newError(Conflict, "New email address already in use")
+		}
+		if err != nil {
+			tx.Rollback()
+			return wrapError(Unprocessable, "Can't update respondent for ID "+respondentID+": ", err)
+		}
+	}
+
+	if update.ResolveEnrolments != nil || len(update.EnrolmentStatuses) > 0 {
+		if err = p.updateEnrolments(ctx, tx, respondentID, enrolments, update.EnrolmentStatuses); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	after := copyRespondent(before)
+	applyAttributes(&after, update)
+	enrol(&after, enrolments)
+	applyEnrolmentStatuses(&after, update.EnrolmentStatuses)
+	if err = insertOutboxEntries(ctx, tx, respondentEventEntries(before, &after)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = insertAuditEntry(ctx, tx, auditEntry(ctx, AuditUpdate, respondentID, before, &after)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Can't commit transaction for respondent ID "+respondentID+": ", err)
+	}
+
+	return nil
+}
+
+// Creates the enrolments (and business associations) of an update and changes its enrolment statuses
+func (p *Postgres) updateEnrolments(ctx context.Context, tx *sql.Tx, respondentID string, enrolments []NewEnrolment, statuses []models.Association) error {
+	var existingBusinessRespondents []string
+	rows, err := tx.QueryContext(ctx, "SELECT business_id FROM partysvc.business_respondent WHERE respondent_id=$1", respondentID)
+	if err != nil {
+		return wrapError(Internal, "Can't retrieve existing business associations for respondent ID "+respondentID+": ", err)
+	}
+	for rows.Next() {
+		var businessID string
+		rows.Scan(&businessID)
+		existingBusinessRespondents = append(existingBusinessRespondents, businessID)
+	}
+	rows.Close()
+
+	// Only associate with the businesses we don't already have business respondent records for
+	newBusinessIDs := []string{}
+	for _, businessID := range enrolmentBusinessIDs(enrolments) {
+		if !contains(existingBusinessRespondents, businessID) {
+			newBusinessIDs = append(newBusinessIDs, businessID)
+		}
+	}
+
+	if len(newBusinessIDs) > 0 {
+		if err = p.checkBusinessesExist(ctx, enrolments, newBusinessIDs); err != nil {
+			return err
+		}
+		if err = insertBusinessRespondents(ctx, tx, respondentID, newBusinessIDs); err != nil {
+			return err
+		}
+	}
+
+	if len(enrolments) > 0 {
+		insertEnrolment, err := tx.PrepareContext(ctx, pq.CopyIn("partysvc.enrolment", "respondent_id", "business_id", "survey_id", "status", "created_on"))
+		if err != nil {
+			return wrapError(Internal, "Error creating DB prepared statement: ", err)
+		}
+		defer insertEnrolment.Close()
+
+		insertPendingEnrolment, err := tx.PrepareContext(ctx, pq.CopyIn("partysvc.pending_enrolment", "case_id", "respondent_id", "business_id", "survey_id", "created_on"))
+		if err != nil {
+			return wrapError(Internal, "Error creating DB prepared statement: ", err)
+		}
+		defer insertPendingEnrolment.Close()
+
+		for _, enrolment := range enrolments {
+			_, err := insertEnrolment.ExecContext(ctx, respondentID, enrolment.BusinessID, enrolment.SurveyID, "PENDING", time.Now())
+			if err != nil {
+				return wrapError(Unprocessable, "Can't create an Enrolment with respondent ID "+respondentID+" and business ID "+enrolment.BusinessID+": ", err)
+			}
+
+			_, err = insertPendingEnrolment.ExecContext(ctx, enrolment.CaseID, respondentID, enrolment.BusinessID, enrolment.SurveyID, time.Now())
+			if err != nil {
+				return wrapError(Unprocessable, "Can't create a Pending Enrolment with respondent ID "+respondentID+" and business ID "+enrolment.BusinessID+": ", err)
+			}
+		}
+
+		_, err = insertEnrolment.ExecContext(ctx)
+		if err != nil {
+			return wrapError(Unprocessable, "Can't commit enrolments with respondent ID "+respondentID+": ", err)
+		}
+
+		_, err = insertPendingEnrolment.ExecContext(ctx)
+		if err != nil {
+			return wrapError(Unprocessable, "Can't commit pending enrolments with respondent ID "+respondentID+": ", err)
+		}
+
+		if err = insertOutboxEntries(ctx, tx, deactivationEntries(enrolments)); err != nil {
+			return err
+		}
+	}
+
+	if len(statuses) > 0 {
+		updateEnrolment, err := tx.PrepareContext(ctx, "UPDATE partysvc.enrolment SET status=$1 WHERE respondent_id=$2 AND business_id=$3 AND survey_id=$4")
+		if err != nil {
+			return wrapError(Internal, "Error creating DB prepared statement: ", err)
+		}
+		defer updateEnrolment.Close()
+
+		for _, assoc := range statuses {
+			for _, enrolment := range assoc.Enrolments {
+				res, err := updateEnrolment.ExecContext(ctx, enrolment.EnrolmentStatus, respondentID, assoc.ID, enrolment.SurveyID)
+				if err != nil {
+					return wrapError(Unprocessable, "Can't update an Enrolment with respondent ID "+respondentID+" and business ID "+assoc.ID+": ", err)
+				}
+				if aff, _ := res.RowsAffected(); aff == 0 {
+					return newError(Missing, "Can't find enrolment to update for respondent ID "+respondentID+" and survey ID "+enrolment.SurveyID)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteRespondent deletes the respondent along with their associations and enrolments
+func (p *Postgres) DeleteRespondent(ctx context.Context, id string) error {
+	var respondentID string
+	err := p.db.QueryRowContext(ctx, "SELECT id FROM partysvc.respondent WHERE id=$1", id).Scan(&respondentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return wrapError(Internal, "Error querying DB: ", err)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(Internal, "Error creating DB transaction: ", err)
+	}
+
+	before, err := auditedRespondent(ctx, tx, respondentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	deletes := []struct {
+		statement string
+		message   string
+	}{
+		{"DELETE FROM partysvc.enrolment WHERE respondent_id=$1", "Error deleting enrolments for respondent ID "},
+		{"DELETE FROM partysvc.business_respondent WHERE respondent_id=$1", "Error deleting business respondent for respondent ID "},
+		{"DELETE FROM partysvc.pending_enrolment WHERE respondent_id=$1", "Error deleting pending enrolments for respondent ID "},
+		{"DELETE FROM partysvc.respondent WHERE id=$1", "Error deleting respondent record for respondent ID "},
+	}
+	for _, d := range deletes {
+		if _, err = tx.ExecContext(ctx, d.statement, respondentID); err != nil {
+			tx.Rollback()
+			return wrapError(Internal, d.message+respondentID+": ", err)
+		}
+	}
+
+	if err = insertOutboxEntries(ctx, tx, respondentEventEntries(before, nil)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = insertAuditEntry(ctx, tx, auditEntry(ctx, AuditDelete, respondentID, before, nil)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return wrapError(Internal, "Can't commit transaction for respondent ID "+respondentID+": ", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,626 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var selectQueryRegex = "SELECT (.+) FROM*"
+var insertQueryRegex = "INSERT INTO (.+)*"
+var deleteQueryRegex = "DELETE FROM (.+)*"
+var updateQueryRegex = "UPDATE (.+) SET*"
+var auditQueryRegex = "INSERT INTO partysvc.audit_log (.+)"
+var copyQueryRegex = "COPY (.+) FROM STDIN"
+
+var auditedRespondentColumns = []string{"id", "email_address", "first_name", "last_name", "telephone", "status", "business_id", "survey_id", "status"}
+
+// Expects bob to be read in the current transaction, as they stand before the change, for the audit log
+func expectAuditedBob(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(sqlmock.NewRows(auditedRespondentColumns).
+		AddRow(bob.ID, bob.EmailAddress, bob.FirstName, bob.LastName, bob.Telephone, "ACTIVE", nil, nil, nil))
+}
+
+// Expects the outbox entries publishing a business event, and notifying webhooks of it, to be recorded in the current
+// transaction
+func expectBusinessEventOutboxEntries(mock sqlmock.Sqlmock) {
+	prepared := mock.ExpectPrepare(copyQueryRegex)
+	prepared.ExpectExec().WithArgs(OutboxPublishEvent, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	prepared.ExpectExec().WithArgs(OutboxNotifyWebhooks, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestPostgresCreateRespondentChecksBusinessesBeforeStarting(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectPrepare(selectQueryRegex).ExpectQuery().WithArgs(pq.Array([]string{bobsEnrolment.BusinessID})).
+		WillReturnRows(sqlmock.NewRows([]string{"party_uuid"}))
+
+	err = NewPostgres(db).CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Unprocessable, storeErr.Kind)
+	assert.Equal(t, "Can't associate with the business for enrolment code: abc1234", storeErr.Message)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresCreateRespondentRejectsEmailInUse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectPrepare(selectQueryRegex).ExpectQuery().WithArgs(pq.Array([]string{bobsEnrolment.BusinessID})).
+		WillReturnRows(sqlmock.NewRows([]string{"party_uuid"}).AddRow(bobsEnrolment.BusinessID))
+	mock.ExpectBegin()
+	mock.ExpectPrepare(insertQueryRegex).ExpectExec().WithArgs(bob.ID, "CREATED", bob.EmailAddress, bob.FirstName, bob.LastName, bob.Telephone, sqlmock.AnyArg()).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "respondent_email_address_key"})
+	mock.ExpectRollback()
+
+	err = NewPostgres(db).CreateRespondent(ctx, bob, []NewEnrolment{bobsEnrolment})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Conflict, storeErr.Kind)
+	assert.Equal(t, "New email address already in use", storeErr.Message)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresUpdateRespondentResolvesEnrolmentsBeforeStartingTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+	resolverErr := errors.New("Enrolment code not found: abc1234")
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(bob.ID))
+
+	err = NewPostgres(db).UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		ResolveEnrolments: func() ([]NewEnrolment, error) {
+			// No transaction has been started while the enrolments are resolved
+			assert.Nil(t, mock.ExpectationsWereMet())
+			return nil, resolverErr
+		},
+	})
+
+	assert.Equal(t, resolverErr, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresUpdateRespondentReturnsNotFoundBeforeResolvingEnrolments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	err = NewPostgres(db).UpdateRespondent(ctx, bob.ID, RespondentUpdate{
+		ResolveEnrolments: func() ([]NewEnrolment, error) {
+			t.Error("Enrolments resolved for a respondent which doesn't exist")
+			return nil, nil
+		},
+	})
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresUpdateRespondentRejectsEmailTakenSinceChecking(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM partysvc.respondent WHERE id=(.+) FOR UPDATE").WithArgs(bob.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email_address"}).AddRow(bob.ID, bob.EmailAddress))
+	expectAuditedBob(mock)
+	mock.ExpectQuery(selectQueryRegex).WithArgs("jim@jimbob.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(updateQueryRegex).WithArgs("jim@jimbob.com", bob.ID).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "respondent_email_address_key"})
+	mock.ExpectRollback()
+
+	err = NewPostgres(db).UpdateRespondent(ctx, bob.ID, RespondentUpdate{Attributes: models.Attributes{EmailAddress: "jim@jimbob.com"}})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Conflict, storeErr.Kind)
+	assert.Equal(t, "New email address already in use", storeErr.Message)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDeleteRespondentReturnsNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	err = NewPostgres(db).DeleteRespondent(ctx, bob.ID)
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDeleteRespondentRollsBackIfDeleteFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(bob.ID))
+	mock.ExpectBegin()
+	expectAuditedBob(mock)
+	mock.ExpectExec(deleteQueryRegex).WithArgs(bob.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(deleteQueryRegex).WithArgs(bob.ID).WillReturnError(fmt.Errorf("SQL error"))
+	mock.ExpectRollback()
+
+	err = NewPostgres(db).DeleteRespondent(ctx, bob.ID)
+
+	assert.Equal(t, "Error deleting business respondent for respondent ID "+bob.ID+": SQL error", err.Error())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDeleteRespondentRecordsAuditEntry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(bob.ID))
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(sqlmock.NewRows(auditedRespondentColumns).
+		AddRow(bob.ID, bob.EmailAddress, bob.FirstName, bob.LastName, bob.Telephone, "ACTIVE", bobsEnrolment.BusinessID, bobsEnrolment.SurveyID, "ENABLED"))
+	for i := 0; i < 4; i++ {
+		mock.ExpectExec(deleteQueryRegex).WithArgs(bob.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	prepared := mock.ExpectPrepare(copyQueryRegex)
+	prepared.ExpectExec().WithArgs(OutboxPublishEvent, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	prepared.ExpectExec().WithArgs(OutboxNotifyWebhooks, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(auditQueryRegex).WithArgs("support-tool", AuditDelete, bob.ID, pq.Array([]string{bobsEnrolment.BusinessID}),
+		`{"attributes":{"emailAddress":"bob@boblaw.com","id":"`+bob.ID+`","firstName":"Bob","lastName":"Boblaw","telephone":"01234567890"},"status":"ACTIVE",`+
+			`"associations":[{"enrolments":[{"enrolmentStatus":"ENABLED","surveyId":"`+bobsEnrolment.SurveyID+`"}],"name":"","id":"`+bobsEnrolment.BusinessID+`","sampleUnitRef":""}]}`,
+		nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = NewPostgres(db).DeleteRespondent(WithActor(ctx, "support-tool"), bob.ID)
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRespondentHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+	createdOn := time.Date(2021, 11, 1, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(bob.ID).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "actor", "action", "respondent_id", "business_ids", "before", "after", "created_on"}).
+			AddRow(1, "frontstage", AuditCreate, bob.ID, "{"+bobsEnrolment.BusinessID+"}", nil, []byte(`{"status":"CREATED"}`), createdOn).
+			AddRow(2, "support-tool", AuditDelete, bob.ID, "{}", []byte(`{"status":"ACTIVE"}`), nil, createdOn))
+
+	history, err := NewPostgres(db).RespondentHistory(ctx, bob.ID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.AuditEntry{
+		{ID: 1, Actor: "frontstage", Action: AuditCreate, RespondentID: bob.ID, BusinessIDs: []string{bobsEnrolment.BusinessID},
+			After: []byte(`{"status":"CREATED"}`), CreatedOn: createdOn},
+		{ID: 2, Actor: "support-tool", Action: AuditDelete, RespondentID: bob.ID, BusinessIDs: []string{},
+			Before: []byte(`{"status":"ACTIVE"}`), CreatedOn: createdOn},
+	}, history)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresUpdateBusinessRecordsNewVersionOfAttributes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	business := models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001", Name: "Bolts and Ratchets Ltd",
+		SampleSummaryID: "c9a4f9a5-573e-4870-a114-42279ab2aa3a"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(updateQueryRegex).WithArgs("49900000001", business.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertQueryRegex).WithArgs(business.ID, business.SampleSummaryID, "Bolts and Ratchets Ltd", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectBusinessEventOutboxEntries(mock)
+	mock.ExpectCommit()
+
+	err = NewPostgres(db).UpdateBusiness(ctx, business, nil)
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresUpdateBusinessReturnsNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(updateQueryRegex).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = NewPostgres(db).UpdateBusiness(ctx, models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2"}, nil)
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresGetBusinessByRefReturnsNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs("49900000001").WillReturnRows(sqlmock.NewRows([]string{"party_uuid"}))
+
+	_, err = NewPostgres(db).GetBusinessByRef(ctx, "49900000001")
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresGetBusinessForCollectionExerciseTellsMissingBusinessesApart(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+	businessColumns := []string{"party_uuid", "business_ref", "id", "sample_summary_id", "name", "trading_as", "attributes"}
+
+	// The business exists, but not in the collection exercise
+	mock.ExpectQuery(selectQueryRegex).WithArgs("517a1f82-3440-41dd-933b-b54af5379b39", "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2").
+		WillReturnRows(sqlmock.NewRows(businessColumns))
+	mock.ExpectQuery(selectQueryRegex).WithArgs("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2").
+		WillReturnRows(sqlmock.NewRows(businessColumns).AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "49900000001", 1, "", "", "", nil))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(sqlmock.NewRows([]string{"business_id", "id", "first_name", "last_name", "survey_id", "status"}))
+
+	_, err = NewPostgres(db).GetBusinessForCollectionExercise(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "517a1f82-3440-41dd-933b-b54af5379b39")
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Missing, storeErr.Kind)
+
+	// The business doesn't exist
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(sqlmock.NewRows(businessColumns))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(sqlmock.NewRows(businessColumns))
+
+	_, err = NewPostgres(db).GetBusinessForCollectionExercise(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "517a1f82-3440-41dd-933b-b54af5379b39")
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresBusinessAttributesHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	createdOn := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(selectQueryRegex).WithArgs("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "sample_summary_id", "collection_exercise", "name", "trading_as", "attributes", "created_on"}).
+			AddRow(1, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", "517a1f82-3440-41dd-933b-b54af5379b39", "Bolts and Ratchets Ltd", nil,
+				[]byte(`{"ruref":"49900000001","froempment":50}`), createdOn).
+			AddRow(2, "c9a4f9a5-573e-4870-a114-42279ab2aa3a", nil, "Bolts and Ratchets Ltd", "Ratchets Direct",
+				[]byte(`{"ruref":"49900000001","froempment":55}`), createdOn.AddDate(0, 3, 0)))
+
+	history, err := NewPostgres(db).BusinessAttributesHistory(ctx, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "517a1f82-3440-41dd-933b-b54af5379b39", history[0].CollectionExerciseID)
+	assert.Equal(t, 50, history[0].Attributes.FroEmpment)
+	assert.Equal(t, "", history[1].CollectionExerciseID)
+	assert.Equal(t, "Ratchets Direct", history[1].TradingAs)
+	assert.Equal(t, 55, history[1].Attributes.FroEmpment)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresLinkSampleSummary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery("WITH linked AS (.+)").WithArgs("517a1f82-3440-41dd-933b-b54af5379b39", "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	linked, err := NewPostgres(db).LinkSampleSummary(ctx, "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", "517a1f82-3440-41dd-933b-b54af5379b39")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, linked)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresLoadBusinesses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	sampleSummaryID := "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"
+	businesses := []models.Business{
+		{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972", SampleUnitRef: "49900000001", SampleSummaryID: sampleSummaryID, Name: "Bolts and Ratchets Ltd"},
+		{ID: "c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", SampleUnitRef: "49900000002", SampleSummaryID: sampleSummaryID, Name: "Nuts Ltd"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectQueryRegex).WithArgs(pq.Array([]string{"49900000001", "49900000002"})).
+		WillReturnRows(sqlmock.NewRows([]string{"party_uuid", "business_ref"}).AddRow("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", "49900000001"))
+	mock.ExpectPrepare(copyQueryRegex).ExpectExec().WithArgs("c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", "49900000002", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TEMPORARY TABLE business_load_batch").WillReturnResult(sqlmock.NewResult(0, 0))
+	prepared := mock.ExpectPrepare(copyQueryRegex)
+	prepared.ExpectExec().WithArgs("ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", sampleSummaryID, "Bolts and Ratchets Ltd", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	prepared.ExpectExec().WithArgs("c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", sampleSummaryID, "Nuts Ltd", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(2, 2))
+	prepared = mock.ExpectPrepare(copyQueryRegex)
+	for range businesses {
+		prepared.ExpectExec().WithArgs(OutboxPublishEvent, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		prepared.ExpectExec().WithArgs(OutboxNotifyWebhooks, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = NewPostgres(db).LoadBusinesses(ctx, businesses)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", businesses[0].ID)
+	assert.Equal(t, "c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", businesses[1].ID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresLoadBusinessesLoadsRepeatedRefOnceWithLastRow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	sampleSummaryID := "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"
+	businesses := []models.Business{
+		{ID: "3b136c4b-7a14-4904-9e01-13364dd7b972", SampleUnitRef: "49900000001", SampleSummaryID: sampleSummaryID, Name: "Bolts Ltd"},
+		{ID: "c0f9b1d2-5d8e-4c7a-9a3b-2e1f0d9c8b7a", SampleUnitRef: "49900000001", SampleSummaryID: sampleSummaryID, Name: "Bolts and Ratchets Ltd"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectQueryRegex).WithArgs(pq.Array([]string{"49900000001"})).
+		WillReturnRows(sqlmock.NewRows([]string{"party_uuid", "business_ref"}))
+	mock.ExpectPrepare(copyQueryRegex).ExpectExec().WithArgs("3b136c4b-7a14-4904-9e01-13364dd7b972", "49900000001", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TEMPORARY TABLE business_load_batch").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(copyQueryRegex).ExpectExec().
+		WithArgs("3b136c4b-7a14-4904-9e01-13364dd7b972", sampleSummaryID, "Bolts and Ratchets Ltd", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectBusinessEventOutboxEntries(mock)
+	mock.ExpectCommit()
+
+	err = NewPostgres(db).LoadBusinesses(ctx, businesses)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "3b136c4b-7a14-4904-9e01-13364dd7b972", businesses[0].ID)
+	assert.Equal(t, "3b136c4b-7a14-4904-9e01-13364dd7b972", businesses[1].ID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresLoadBusinessesRollsBackIfAttributesCantBeRecorded(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	business := models.Business{ID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2", SampleUnitRef: "49900000001", SampleSummaryID: "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(sqlmock.NewRows([]string{"party_uuid", "business_ref"}).AddRow(business.ID, business.SampleUnitRef))
+	mock.ExpectExec("CREATE TEMPORARY TABLE business_load_batch").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(copyQueryRegex).ExpectExec().WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(copyQueryRegex).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertQueryRegex).WillReturnError(fmt.Errorf("deadlock detected"))
+	mock.ExpectRollback()
+
+	err = NewPostgres(db).LoadBusinesses(ctx, []models.Business{business})
+
+	var storeErr *Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, Unprocessable, storeErr.Kind)
+	assert.Equal(t, "Can't create business attributes: deadlock detected", storeErr.Message)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresGetBusinessLoad(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	createdOn := time.Date(2021, 11, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(selectQueryRegex).WithArgs("8d1bd1a6-5f7f-4d8e-a0a4-6f7d0f3c3a5e").WillReturnRows(sqlmock.NewRows(
+		[]string{"id", "sample_summary_id", "status", "total_rows", "loaded_rows", "errors", "created_on", "completed_on"}).
+		AddRow("8d1bd1a6-5f7f-4d8e-a0a4-6f7d0f3c3a5e", "0a4b2a8d-ebd1-4f8a-9d7c-a6a3e0a9a9a1", "RUNNING", 3, 1,
+			[]byte(`[{"row":2,"ruRef":"49900000002","error":"Missing required fields: runame1"}]`), createdOn, nil))
+	mock.ExpectQuery(selectQueryRegex).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	load, err := NewPostgres(db).GetBusinessLoad(ctx, "8d1bd1a6-5f7f-4d8e-a0a4-6f7d0f3c3a5e")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, load.Rows)
+	assert.Equal(t, []models.BusinessLoadError{{Row: 2, RURef: "49900000002", Error: "Missing required fields: runame1"}}, load.Errors)
+	assert.Equal(t, createdOn, load.CreatedOn)
+	assert.Nil(t, load.CompletedOn)
+
+	_, err = NewPostgres(db).GetBusinessLoad(ctx, "3b136c4b-7a14-4904-9e01-13364dd7b972")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresFailStaleBusinessLoads(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	before := time.Date(2021, 11, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectExec(updateQueryRegex).WithArgs(BusinessLoadFailed, sqlmock.AnyArg(), BusinessLoadRunning, before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	failed, err := NewPostgres(db).FailStaleBusinessLoads(ctx, before)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, failed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresSearchBusinessesSkipsQueryIfNoneMatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs("%bolt%", "%bolt%", "%bolt%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	businesses, total, err := NewPostgres(db).SearchBusinesses(ctx, BusinessSearch{Keywords: []string{"bolt"}, Page: 1, Limit: 10})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, businesses)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresClaimOutboxEntriesReturnsOldestFirst(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+	now := time.Now()
+
+	mock.ExpectQuery(updateQueryRegex).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "payload", "attempts", "last_error", "next_attempt_at", "created_on"}).
+			AddRow(2, OutboxDeactivateIAC, []byte(`{"iac":"abc1235"}`), 0, "", now, now).
+			AddRow(1, OutboxDeactivateIAC, []byte(`{"iac":"abc1234"}`), 3, "Received status code 503", now, now))
+
+	entries, err := NewPostgres(db).ClaimOutboxEntries(ctx, 10, time.Minute)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, int64(1), entries[0].ID)
+	assert.Equal(t, "Received status code 503", entries[0].LastError)
+	assert.JSONEq(t, `{"iac":"abc1235"}`, string(entries[1].Payload))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRetryOutboxEntryReturnsNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectExec(updateQueryRegex).WithArgs("Received status code 503", sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = NewPostgres(db).RetryOutboxEntry(ctx, 1, "Received status code 503", time.Now())
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresGetWebhookReturnsNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery(selectQueryRegex).WithArgs(allEventsWebhook.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "event_types", "secret", "created_on"}))
+
+	_, err = NewPostgres(db).GetWebhook(ctx, allEventsWebhook.ID)
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresQueueWebhookDeliveriesInOneStatement(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+	event, err := events.New(events.BusinessUpdated, events.BusinessUpdatedVersion, events.BusinessData{BusinessID: "ba02fad7-ae27-45c6-ab0f-c8cd9a48ebc2"})
+	assert.Nil(t, err)
+
+	mock.ExpectExec("INSERT INTO partysvc.outbox (.+) SELECT (.+) FROM partysvc.webhook").
+		WithArgs(OutboxDeliverWebhook, "webhookId", "event", sqlmock.AnyArg(), sqlmock.AnyArg(), events.BusinessUpdated).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	queued, err := NewPostgres(db).QueueWebhookDeliveries(ctx, event)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, queued)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresWebhookDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+	createdOn := time.Date(2021, 11, 1, 9, 0, 0, 0, time.UTC)
+	eventID := "3f1c6d0a-8b2e-4f5a-9c7d-1e2b3a4c5d6e"
+
+	mock.ExpectQuery("SELECT COUNT(.+) FROM partysvc.webhook").WithArgs(allEventsWebhook.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(selectQueryRegex).WithArgs(allEventsWebhook.ID).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "webhook_id", "event_id", "event_type", "attempt", "status_code", "error", "succeeded", "created_on"}).
+			AddRow(2, allEventsWebhook.ID, eventID, events.RespondentCreated, 2, 200, nil, true, createdOn).
+			AddRow(1, allEventsWebhook.ID, eventID, events.RespondentCreated, 1, nil, "connection refused", false, createdOn))
+
+	deliveries, err := NewPostgres(db).WebhookDeliveries(ctx, allEventsWebhook.ID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.WebhookDelivery{
+		{ID: 2, WebhookID: allEventsWebhook.ID, EventID: eventID, EventType: events.RespondentCreated, Attempt: 2, StatusCode: 200,
+			Succeeded: true, CreatedOn: createdOn},
+		{ID: 1, WebhookID: allEventsWebhook.ID, EventID: eventID, EventType: events.RespondentCreated, Attempt: 1,
+			Error: "connection refused", CreatedOn: createdOn},
+	}, deliveries)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresWebhookDeliveriesReturnsNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+
+	mock.ExpectQuery("SELECT COUNT(.+) FROM partysvc.webhook").WithArgs(allEventsWebhook.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	_, err = NewPostgres(db).WebhookDeliveries(ctx, allEventsWebhook.ID)
+
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/lib/pq"
+)
+
+// CreateWebhook registers the webhook, with the ID provided
+func (p *Postgres) CreateWebhook(ctx context.Context, webhook models.Webhook) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO partysvc.webhook (id, url, event_types, secret, created_on) VALUES ($1,$2,$3,$4,$5)",
+		webhook.ID, webhook.URL, pq.Array(webhook.EventTypes), webhook.Secret, webhook.CreatedOn)
+	if err != nil {
+		return wrapError(Unprocessable, "Can't create a webhook with ID "+webhook.ID+": ", err)
+	}
+	return nil
+}
+
+// ListWebhooks returns every webhook, oldest first, without their secrets
+func (p *Postgres) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, url, event_types, created_on FROM partysvc.webhook ORDER BY created_on, id")
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		if err = rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.EventTypes), &webhook.CreatedOn); err != nil {
+			return nil, wrapError(Internal, "Error reading webhooks: ", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(Internal, "Error reading webhooks: ", err)
+	}
+	return webhooks, nil
+}
+
+// GetWebhook returns the webhook with the ID provided, including its secret, or ErrNotFound
+func (p *Postgres) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := p.db.QueryRowContext(ctx, "SELECT id, url, event_types, secret, created_on FROM partysvc.webhook WHERE id=$1", id).
+		Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.EventTypes), &webhook.Secret, &webhook.CreatedOn)
+	if err == sql.ErrNoRows {
+		return models.Webhook{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Webhook{}, wrapError(Internal, "Error querying DB: ", err)
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook deletes the webhook and its delivery log, or returns ErrNotFound. Deliveries already queued for it are
+// dropped when they're dispatched.
+func (p *Postgres) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := p.db.ExecContext(ctx, "DELETE FROM partysvc.webhook WHERE id=$1", id)
+	if err != nil {
+		return wrapError(Internal, "Error deleting webhook with ID "+id+": ", err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// QueueWebhookDeliveries records an OutboxDeliverWebhook entry for each webhook subscribed to the event, and returns
+// how many there were. They're all recorded in one statement, so either every webhook gets a delivery or none do.
+func (p *Postgres) QueueWebhookDeliveries(ctx context.Context, event events.Event) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, wrapError(Internal, "Invalid event: ", err)
+	}
+
+	res, err := p.db.ExecContext(ctx, "INSERT INTO partysvc.outbox (kind, payload, next_attempt_at, created_on) "+
+		"SELECT $1, jsonb_build_object($2::text, id, $3::text, $4::jsonb), $5, $5 FROM partysvc.webhook "+
+		"WHERE cardinality(event_types)=0 OR $6=ANY(event_types)",
+		OutboxDeliverWebhook, "webhookId", "event", string(payload), time.Now(), event.Type)
+	if err != nil {
+		return 0, wrapError(Internal, "Can't queue deliveries of event "+event.ID+" to webhooks: ", err)
+	}
+	queued, _ := res.RowsAffected()
+	return int(queued), nil
+}
+
+// RecordWebhookDelivery adds the attempt to the webhook's delivery log
+func (p *Postgres) RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	var statusCode interface{}
+	if delivery.StatusCode != 0 {
+		statusCode = delivery.StatusCode
+	}
+	var deliveryError interface{}
+	if delivery.Error != "" {
+		deliveryError = delivery.Error
+	}
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO partysvc.webhook_delivery (webhook_id, event_id, event_type, attempt, status_code, error, succeeded, created_on) "+
+		"VALUES ($1,$2,$3,$4,$5,$6,$7,$8)", delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempt, statusCode, deliveryError,
+		delivery.Succeeded, delivery.CreatedOn)
+	if err != nil {
+		return wrapError(Internal, "Can't record delivery to webhook ID "+delivery.WebhookID+": ", err)
+	}
+	return nil
+}
+
+// WebhookDeliveries returns the webhook's delivery log, most recent first, or ErrNotFound if there's no such webhook
+func (p *Postgres) WebhookDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	var count int
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM partysvc.webhook WHERE id=$1", webhookID).Scan(&count)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	if count == 0 {
+		return nil, ErrNotFound
+	}
+
+	rows, err := p.db.QueryContext(ctx, "SELECT id, webhook_id, event_id, event_type, attempt, status_code, error, succeeded, created_on "+
+		"FROM partysvc.webhook_delivery WHERE webhook_id=$1 ORDER BY id DESC", webhookID)
+	if err != nil {
+		return nil, wrapError(Internal, "Error querying DB: ", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var statusCode sql.NullInt64
+		var deliveryError sql.NullString
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Attempt, &statusCode,
+			&deliveryError, &delivery.Succeeded, &delivery.CreatedOn)
+		if err != nil {
+			return nil, wrapError(Internal, "Error reading webhook deliveries: ", err)
+		}
+		delivery.StatusCode = int(statusCode.Int64)
+		delivery.Error = deliveryError.String
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(Internal, "Error reading webhook deliveries: ", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,499 @@
+// Package store provides storage for parties (respondents and businesses) and their enrolments, decoupling the API
+// handlers from how and where they're stored.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+)
+
+// ErrNotFound is returned when the party being retrieved, changed or deleted doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// Kind classifies why a store operation failed
+type Kind int
+
+const (
+	// Internal means the store itself failed, e.g. it couldn't be reached
+	Internal Kind = iota
+	// Unprocessable means the change couldn't be applied to the data as it stands, and has been rolled back
+	Unprocessable
+	// Missing means something the change relies on doesn't exist
+	Missing
+	// Conflict means the change would clash with another party
+	Conflict
+)
+
+// Error represents a failed store operation, with a message suitable for returning to API clients
+type Error struct {
+	Kind    Kind
+	Message string
+	// Err is the underlying error which caused the failure, if there was one
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Creates an error whose message is the one provided followed by the underlying error's
+func wrapError(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message + err.Error(), Err: err}
+}
+
+// RespondentFilters lists the respondent fields which can be searched on, named as they are in the API
+var RespondentFilters = []string{"firstName", "lastName", "emailAddress", "telephone", "status", "businessId", "surveyId"}
+
+// RespondentSearch represents the criteria for a respondent search. Respondents must match every filter provided,
+// keyed by the names in RespondentFilters.
+type RespondentSearch struct {
+	Filters map[string]string
+	Offset  *int
+	Limit   *int
+}
+
+// NewEnrolment represents a pending enrolment to be created from an enrolment code, once the case and survey behind
+// the code have been found
+type NewEnrolment struct {
+	Code       string
+	CaseID     string
+	BusinessID string
+	SurveyID   string
+}
+
+// RespondentUpdate represents the changes to make to a respondent. Empty attributes and status are left unchanged.
+type RespondentUpdate struct {
+	Attributes models.Attributes
+	Status     string
+	// ResolveEnrolments, if set, returns the enrolments to create, associating the respondent with their businesses
+	// if they aren't already. It's only called once the respondent is known to exist, before the update takes any
+	// locks, and any error it returns is returned from the update unchanged.
+	ResolveEnrolments func() ([]NewEnrolment, error)
+	// Existing enrolments to change the status of
+	EnrolmentStatuses []models.Association
+}
+
+// RespondentStore stores respondents, their business associations and their enrolments
+type RespondentStore interface {
+	// SearchRespondents returns all respondents matching the search
+	SearchRespondents(ctx context.Context, search RespondentSearch) ([]models.Respondent, error)
+	// GetRespondent returns the respondent with the ID provided, or ErrNotFound
+	GetRespondent(ctx context.Context, id string) (models.Respondent, error)
+	// CreateRespondent creates a respondent with the ID provided, associated with the businesses and enrolled
+	// (pending) on the surveys of the enrolments provided
+	CreateRespondent(ctx context.Context, respondent models.Attributes, enrolments []NewEnrolment) error
+	// UpdateRespondent applies all of the changes to the respondent, or none of them
+	UpdateRespondent(ctx context.Context, id string, update RespondentUpdate) error
+	// DeleteRespondent deletes the respondent along with their associations and enrolments
+	DeleteRespondent(ctx context.Context, id string) error
+	// RespondentHistory returns the audit log of changes to the respondent, oldest first, which outlives the
+	// respondent being deleted
+	RespondentHistory(ctx context.Context, id string) ([]models.AuditEntry, error)
+}
+
+// The actions recorded in the audit log
+const (
+	AuditCreate = "CREATE"
+	AuditUpdate = "UPDATE"
+	AuditDelete = "DELETE"
+)
+
+type actorKey struct{}
+
+// WithActor returns a copy of the context which records who is making changes, for the audit log
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Returns who is making changes, as recorded in the context
+func actorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "unknown"
+}
+
+// Returns the audit log entry for a change to the respondent, from before to after, either of which is nil if the
+// respondent didn't exist at that point
+func auditEntry(ctx context.Context, action, respondentID string, before, after *models.Respondent) models.AuditEntry {
+	entry := models.AuditEntry{
+		Actor:        actorFromContext(ctx),
+		Action:       action,
+		RespondentID: respondentID,
+		BusinessIDs:  []string{},
+		CreatedOn:    time.Now(),
+	}
+	for _, respondent := range []*models.Respondent{before, after} {
+		if respondent == nil {
+			continue
+		}
+		for _, assoc := range respondent.Associations {
+			if !contains(entry.BusinessIDs, assoc.ID) {
+				entry.BusinessIDs = append(entry.BusinessIDs, assoc.ID)
+			}
+		}
+	}
+	if before != nil {
+		entry.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		entry.After, _ = json.Marshal(after)
+	}
+	return entry
+}
+
+// BusinessSearch represents the criteria for a business search. Businesses must partially match every keyword on
+// their name, trading as or reference.
+type BusinessSearch struct {
+	Keywords []string
+	Page     int
+	Limit    int
+}
+
+// BusinessStore stores businesses and their attributes. A business has a version of its attributes for each sample it's
+// in, the latest of which is its current state.
+type BusinessStore interface {
+	// SearchBusinesses returns the requested page of businesses matching the search, and the total number matching
+	SearchBusinesses(ctx context.Context, search BusinessSearch) ([]models.Business, int, error)
+	// GetBusiness returns the business with the ID provided, or ErrNotFound
+	GetBusiness(ctx context.Context, id string) (models.Business, error)
+	// GetBusinessForCollectionExercise returns the business with the ID provided, with the attributes it had in the
+	// collection exercise, or ErrNotFound. It's Missing if the business wasn't in the collection exercise.
+	GetBusinessForCollectionExercise(ctx context.Context, id string, collectionExerciseID string) (models.Business, error)
+	// BusinessAttributesHistory returns every version of the business's attributes, oldest first
+	BusinessAttributesHistory(ctx context.Context, id string) ([]models.BusinessAttributesVersion, error)
+	// GetBusinessByRef returns the business with the RU reference (sample unit ref) provided, or ErrNotFound
+	GetBusinessByRef(ctx context.Context, ref string) (models.Business, error)
+	// GetBusinessesByRefs returns the businesses with any of the RU references provided, ordered by reference. Refs
+	// which no business has are skipped.
+	GetBusinessesByRefs(ctx context.Context, refs []string) ([]models.Business, error)
+	// CreateBusiness creates a business with the ID provided
+	CreateBusiness(ctx context.Context, business models.Business) error
+	// UpdateBusiness replaces the stored state of the business with the one provided, and adds it to the samples
+	// provided, or returns ErrNotFound. Changed attributes are recorded as a new version for the business's sample
+	// summary, leaving the previous ones in its history.
+	UpdateBusiness(ctx context.Context, business models.Business, samples []models.Sample) error
+	// BusinessSamples returns the samples the business is in, in the order it was added to them
+	BusinessSamples(ctx context.Context, businessID string) ([]models.Sample, error)
+	// LinkSampleSummary links the sample summary to the collection exercise, for every business in the sample, and
+	// returns how many businesses there were
+	LinkSampleSummary(ctx context.Context, sampleSummaryID string, collectionExerciseID string) (int, error)
+	// LoadBusinesses creates or updates each of the businesses, identified by their RU references, along with their
+	// attributes for their sample summary, all or none of them at once. Businesses which don't exist yet are created
+	// with the IDs provided, and the IDs of those which do are filled in. A reference repeated in the batch is created
+	// with the ID of its first row and ends up with the attributes of its last.
+	LoadBusinesses(ctx context.Context, businesses []models.Business) error
+	// CreateBusinessLoad records a new job loading businesses from a sample file, with the ID provided
+	CreateBusinessLoad(ctx context.Context, load models.BusinessLoad) error
+	// UpdateBusinessLoad records how far the job loading businesses has got, or returns ErrNotFound
+	UpdateBusinessLoad(ctx context.Context, load models.BusinessLoad) error
+	// GetBusinessLoad returns the job loading businesses with the ID provided, or ErrNotFound
+	GetBusinessLoad(ctx context.Context, id string) (models.BusinessLoad, error)
+	// FailStaleBusinessLoads marks the jobs loading businesses which are still running, but haven't recorded any
+	// progress since the time provided, as failed, and returns how many there were. They'll have been interrupted,
+	// e.g. by the service stopping without the chance to finish them.
+	FailStaleBusinessLoads(ctx context.Context, before time.Time) (int, error)
+}
+
+// The statuses of a job loading businesses from a sample file
+const (
+	BusinessLoadRunning   = "RUNNING"
+	BusinessLoadCompleted = "COMPLETED"
+	// BusinessLoadFailed is the status of a load which was stopped before it got through every row
+	BusinessLoadFailed = "FAILED"
+)
+
+// OutboxDeactivateIAC is the kind of outbox entry recording that an enrolment code has been used, and should be
+// deactivated in the IAC service
+const OutboxDeactivateIAC = "deactivate_iac"
+
+// DeactivateIACPayload is the payload of an OutboxDeactivateIAC entry
+type DeactivateIACPayload struct {
+	IAC string `json:"iac"`
+}
+
+// OutboxPublishEvent is the kind of outbox entry recording an event about a change to the party data, to be published
+// once the change is committed. Its payload is the events.Event.
+const OutboxPublishEvent = "publish_event"
+
+// OutboxNotifyWebhooks is the kind of outbox entry recording an event to notify the webhooks subscribed to it about,
+// once the change is committed. Its payload is the events.Event.
+const OutboxNotifyWebhooks = "notify_webhooks"
+
+// OutboxDeliverWebhook is the kind of outbox entry recording an event to deliver to a webhook. Its payload is a
+// WebhookDeliveryPayload.
+const OutboxDeliverWebhook = "deliver_webhook"
+
+// WebhookDeliveryPayload is the payload of an OutboxDeliverWebhook entry
+type WebhookDeliveryPayload struct {
+	WebhookID string       `json:"webhookId"`
+	Event     events.Event `json:"event"`
+}
+
+// OutboxStore stores messages which are recorded in the same transaction as the changes they're about, so that they
+// can be sent on reliably once the change is committed. Creating enrolments records an OutboxDeactivateIAC entry
+// for each enrolment code used, and changes to respondents and businesses record an OutboxPublishEvent and an
+// OutboxNotifyWebhooks entry for each event they cause.
+type OutboxStore interface {
+	// ClaimOutboxEntries returns up to limit entries which are due to be dispatched, oldest first, and stops them
+	// being claimed again until the lease has passed
+	ClaimOutboxEntries(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error)
+	// CompleteOutboxEntry records that the entry has been dispatched
+	CompleteOutboxEntry(ctx context.Context, id int64) error
+	// RetryOutboxEntry records a failed attempt to dispatch the entry, and when to try again
+	RetryOutboxEntry(ctx context.Context, id int64, lastError string, nextAttempt time.Time) error
+	// StuckOutboxEntries returns the entries which still haven't been dispatched after at least minAttempts, oldest
+	// first
+	StuckOutboxEntries(ctx context.Context, minAttempts int) ([]models.OutboxEntry, error)
+}
+
+// WebhookStore stores the webhooks registered for events, and the log of attempts to deliver events to them
+type WebhookStore interface {
+	// CreateWebhook registers the webhook, with the ID provided
+	CreateWebhook(ctx context.Context, webhook models.Webhook) error
+	// ListWebhooks returns every webhook, oldest first, without their secrets
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	// GetWebhook returns the webhook with the ID provided, including its secret, or ErrNotFound
+	GetWebhook(ctx context.Context, id string) (models.Webhook, error)
+	// DeleteWebhook deletes the webhook and its delivery log, or returns ErrNotFound
+	DeleteWebhook(ctx context.Context, id string) error
+	// QueueWebhookDeliveries records an OutboxDeliverWebhook entry for each webhook subscribed to the event, and
+	// returns how many there were
+	QueueWebhookDeliveries(ctx context.Context, event events.Event) (int, error)
+	// RecordWebhookDelivery adds the attempt to the webhook's delivery log
+	RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	// WebhookDeliveries returns the webhook's delivery log, most recent first, or ErrNotFound if there's no such
+	// webhook
+	WebhookDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error)
+}
+
+// Reports whether the webhook is subscribed to events of the type provided. A webhook without any event types is
+// subscribed to all of them.
+func subscribed(webhook models.Webhook, eventType string) bool {
+	return len(webhook.EventTypes) == 0 || contains(webhook.EventTypes, eventType)
+}
+
+// Returns the outbox entry delivering the event to the webhook
+func webhookDeliveryEntry(webhookID string, event events.Event) models.OutboxEntry {
+	payload, _ := json.Marshal(WebhookDeliveryPayload{WebhookID: webhookID, Event: event})
+	return models.OutboxEntry{Kind: OutboxDeliverWebhook, Payload: payload}
+}
+
+// Makes the changes to the respondent's attributes and status in the update
+func applyAttributes(respondent *models.Respondent, update RespondentUpdate) {
+	if update.Attributes.FirstName != "" {
+		respondent.Attributes.FirstName = update.Attributes.FirstName
+	}
+	if update.Attributes.LastName != "" {
+		respondent.Attributes.LastName = update.Attributes.LastName
+	}
+	if update.Attributes.EmailAddress != "" {
+		respondent.Attributes.EmailAddress = update.Attributes.EmailAddress
+	}
+	if update.Attributes.Telephone != "" {
+		respondent.Attributes.Telephone = update.Attributes.Telephone
+	}
+	if update.Status != "" {
+		respondent.Status = update.Status
+	}
+}
+
+// Adds the enrolments to the respondent, associating them with any businesses they aren't already
+func enrol(respondent *models.Respondent, enrolments []NewEnrolment) {
+	for _, enrolment := range enrolments {
+		found := false
+		for idx := range respondent.Associations {
+			if respondent.Associations[idx].ID == enrolment.BusinessID {
+				found = true
+				respondent.Associations[idx].Enrolments = append(respondent.Associations[idx].Enrolments,
+					models.Enrolment{SurveyID: enrolment.SurveyID, EnrolmentStatus: "PENDING"})
+				break
+			}
+		}
+		if !found {
+			respondent.Associations = append(respondent.Associations, models.Association{
+				ID:         enrolment.BusinessID,
+				Enrolments: []models.Enrolment{{SurveyID: enrolment.SurveyID, EnrolmentStatus: "PENDING"}},
+			})
+		}
+	}
+}
+
+// Changes the statuses of the respondent's enrolments, returning the survey ID of the first one which can't be found
+func applyEnrolmentStatuses(respondent *models.Respondent, statuses []models.Association) (string, bool) {
+	for _, status := range statuses {
+		for _, change := range status.Enrolments {
+			found := false
+			for assocIdx := range respondent.Associations {
+				assoc := &respondent.Associations[assocIdx]
+				if assoc.ID != status.ID {
+					continue
+				}
+				for idx := range assoc.Enrolments {
+					if assoc.Enrolments[idx].SurveyID == change.SurveyID {
+						found = true
+						assoc.Enrolments[idx].EnrolmentStatus = change.EnrolmentStatus
+					}
+				}
+			}
+			if !found {
+				return change.SurveyID, false
+			}
+		}
+	}
+	return "", true
+}
+
+// Returns a copy of the respondent which shares nothing with the original
+func copyRespondent(respondent *models.Respondent) models.Respondent {
+	c := *respondent
+	c.Associations = make([]models.Association, len(respondent.Associations))
+	for idx, assoc := range respondent.Associations {
+		c.Associations[idx] = assoc
+		c.Associations[idx].Enrolments = append([]models.Enrolment{}, assoc.Enrolments...)
+	}
+	return c
+}
+
+// Returns the outbox entries deactivating the enrolment codes used for the enrolments
+func deactivationEntries(enrolments []NewEnrolment) []models.OutboxEntry {
+	entries := []models.OutboxEntry{}
+	for _, enrolment := range enrolments {
+		payload, _ := json.Marshal(DeactivateIACPayload{IAC: enrolment.Code})
+		entries = append(entries, models.OutboxEntry{Kind: OutboxDeactivateIAC, Payload: payload})
+	}
+	return entries
+}
+
+// Returns the outbox entries for the events caused by a change to the respondent from before to after, where
+// before is nil if the respondent has just been created, and after is nil if they've just been deleted
+func respondentEventEntries(before, after *models.Respondent) []models.OutboxEntry {
+	published := []events.Event{}
+	add := func(eventType string, version int, data interface{}) {
+		if event, err := events.New(eventType, version, data); err == nil {
+			published = append(published, event)
+		}
+	}
+
+	if before == nil {
+		created := events.RespondentCreatedData{
+			RespondentID: after.Attributes.ID,
+			EmailAddress: after.Attributes.EmailAddress,
+			FirstName:    after.Attributes.FirstName,
+			LastName:     after.Attributes.LastName,
+			Status:       after.Status,
+			Enrolments:   []events.Enrolment{},
+		}
+		for _, assoc := range after.Associations {
+			for _, enrolment := range assoc.Enrolments {
+				created.Enrolments = append(created.Enrolments, events.Enrolment{BusinessID: assoc.ID, SurveyID: enrolment.SurveyID, Status: enrolment.EnrolmentStatus})
+			}
+		}
+		add(events.RespondentCreated, events.RespondentCreatedVersion, created)
+	} else if after == nil {
+		add(events.RespondentDeleted, events.RespondentDeletedVersion, events.RespondentDeletedData{
+			RespondentID: before.Attributes.ID,
+			EmailAddress: before.Attributes.EmailAddress,
+		})
+	} else {
+		if before.Attributes.EmailAddress != after.Attributes.EmailAddress {
+			add(events.RespondentEmailChanged, events.RespondentEmailChangedVersion, events.RespondentEmailChangedData{
+				RespondentID:         after.Attributes.ID,
+				PreviousEmailAddress: before.Attributes.EmailAddress,
+				EmailAddress:         after.Attributes.EmailAddress,
+			})
+		}
+		for _, assoc := range before.Associations {
+			for _, enrolment := range assoc.Enrolments {
+				status, ok := enrolmentStatus(after, assoc.ID, enrolment.SurveyID)
+				if ok && status != enrolment.EnrolmentStatus {
+					add(events.EnrolmentStatusChanged, events.EnrolmentStatusChangedVersion, events.EnrolmentStatusChangedData{
+						RespondentID:   after.Attributes.ID,
+						BusinessID:     assoc.ID,
+						SurveyID:       enrolment.SurveyID,
+						PreviousStatus: enrolment.EnrolmentStatus,
+						Status:         status,
+					})
+				}
+			}
+		}
+	}
+
+	return eventEntries(published)
+}
+
+// Returns the outbox entries for an event about the business being created or updated
+func businessEventEntries(eventType string, version int, business models.Business) []models.OutboxEntry {
+	event, err := events.New(eventType, version, events.BusinessData{
+		BusinessID:      business.ID,
+		SampleUnitRef:   business.SampleUnitRef,
+		SampleSummaryID: business.SampleSummaryID,
+		Name:            business.Name,
+		TradingAs:       business.TradingAs,
+	})
+	if err != nil {
+		return []models.OutboxEntry{}
+	}
+	return eventEntries([]events.Event{event})
+}
+
+// Returns the outbox entries publishing each event and notifying the webhooks subscribed to it
+func eventEntries(published []events.Event) []models.OutboxEntry {
+	entries := []models.OutboxEntry{}
+	for _, event := range published {
+		payload, _ := json.Marshal(event)
+		entries = append(entries,
+			models.OutboxEntry{Kind: OutboxPublishEvent, Payload: payload},
+			models.OutboxEntry{Kind: OutboxNotifyWebhooks, Payload: payload})
+	}
+	return entries
+}
+
+// Returns the status of the respondent's enrolment on the survey for the business, if they have one
+func enrolmentStatus(respondent *models.Respondent, businessID, surveyID string) (string, bool) {
+	for _, assoc := range respondent.Associations {
+		if assoc.ID != businessID {
+			continue
+		}
+		for _, enrolment := range assoc.Enrolments {
+			if enrolment.SurveyID == surveyID {
+				return enrolment.EnrolmentStatus, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns the IDs of the businesses enrolled with, without duplicates, in the order they're first enrolled with
+func enrolmentBusinessIDs(enrolments []NewEnrolment) []string {
+	businessIDs := []string{}
+	for _, enrolment := range enrolments {
+		if !contains(businessIDs, enrolment.BusinessID) {
+			businessIDs = append(businessIDs, enrolment.BusinessID)
+		}
+	}
+	return businessIDs
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
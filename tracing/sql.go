@@ -0,0 +1,225 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WrapConnector returns a connector whose connections record a span for each statement and transaction. Statements
+// run inside a transaction are recorded as children of its span. A prepared statement, such as a COPY, is recorded as
+// one span from when it's prepared until it's closed, rather than one per execution.
+func WrapConnector(connector driver.Connector) driver.Connector {
+	return &tracedConnector{connector: connector}
+}
+
+type tracedConnector struct {
+	connector driver.Connector
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn: conn}, nil
+}
+
+func (c *tracedConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+type tracedConn struct {
+	conn driver.Conn
+	// The span of the transaction in progress on the connection, if there is one
+	tx trace.Span
+}
+
+func (c *tracedConn) start(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	if c.tx != nil {
+		ctx = trace.ContextWithSpan(ctx, c.tx)
+	}
+	attributes := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(semconv.DBSystemPostgreSQL)}
+	if query != "" {
+		attributes = append(attributes, trace.WithAttributes(semconv.DBStatementKey.String(query)))
+	}
+	return Tracer().Start(ctx, name, attributes...)
+}
+
+// Names the span for a statement after its operation, e.g. "db.SELECT"
+func statementName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "db.statement"
+	}
+	return "db." + strings.ToUpper(fields[0])
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	_, span := c.start(ctx, statementName(query), query)
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		RecordError(span, err)
+		span.End()
+		return nil, err
+	}
+	return &tracedStmt{stmt: stmt, span: span}, nil
+}
+
+func (c *tracedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *tracedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	_, span := c.start(ctx, "db.transaction", "")
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.conn.Begin()
+	}
+	if err != nil {
+		RecordError(span, err)
+		span.End()
+		return nil, err
+	}
+	c.tx = span
+	return &tracedTx{tx: tx, conn: c}, nil
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.start(ctx, statementName(query), query)
+	defer span.End()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		RecordError(span, err)
+	}
+	return result, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.start(ctx, statementName(query), query)
+	defer span.End()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		RecordError(span, err)
+	}
+	return rows, err
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type tracedTx struct {
+	tx   driver.Tx
+	conn *tracedConn
+}
+
+func (t *tracedTx) Commit() error {
+	t.conn.tx.SetAttributes(semconv.DBOperationKey.String("COMMIT"))
+	return t.end(t.tx.Commit())
+}
+
+func (t *tracedTx) Rollback() error {
+	t.conn.tx.SetAttributes(semconv.DBOperationKey.String("ROLLBACK"))
+	return t.end(t.tx.Rollback())
+}
+
+func (t *tracedTx) end(err error) error {
+	span := t.conn.tx
+	t.conn.tx = nil
+	RecordError(span, err)
+	span.End()
+	return err
+}
+
+type tracedStmt struct {
+	stmt driver.Stmt
+	span trace.Span
+}
+
+func (s *tracedStmt) Close() error {
+	err := s.stmt.Close()
+	RecordError(s.span, err)
+	s.span.End()
+	return err
+}
+
+func (s *tracedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *tracedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	result, err := s.stmt.Exec(args)
+	RecordError(s.span, err)
+	return result, err
+}
+
+func (s *tracedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.stmt.Query(args)
+	RecordError(s.span, err)
+	return rows, err
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err := execer.ExecContext(ctx, args)
+		RecordError(s.span, err)
+		return result, err
+	}
+	return s.Exec(values(args))
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err := queryer.QueryContext(ctx, args)
+		RecordError(s.span, err)
+		return rows, err
+	}
+	return s.Query(values(args))
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for idx, arg := range args {
+		values[idx] = arg.Value
+	}
+	return values
+}
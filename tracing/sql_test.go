@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Opens connections to an SQL mock, as pq.NewConnector does to Postgres
+type mockConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c mockConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c mockConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func openTracedDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.NewWithDSN(t.Name())
+	if err != nil {
+		t.Fatal("Error setting up an SQL mock")
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	return sql.OpenDB(WrapConnector(mockConnector{dsn: t.Name(), driver: mockDB.Driver()})), mock
+}
+
+func TestStatementsAreTraced(t *testing.T) {
+	recorder := recordSpans(t)
+	db, mock := openTracedDB(t)
+
+	mock.ExpectQuery("SELECT id FROM partysvc.respondent").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("DELETE FROM partysvc.respondent").WillReturnError(errors.New("relation does not exist"))
+
+	rows, err := db.QueryContext(ctx, "SELECT id FROM partysvc.respondent")
+	assert.Nil(t, err)
+	rows.Close()
+	_, err = db.ExecContext(ctx, "DELETE FROM partysvc.respondent WHERE id = $1", "abc")
+	assert.NotNil(t, err)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "db.SELECT", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), semconv.DBStatementKey.String("SELECT id FROM partysvc.respondent"))
+	assert.Equal(t, "db.DELETE", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestStatementsInTransactionAreChildrenOfIt(t *testing.T) {
+	recorder := recordSpans(t)
+	db, mock := openTracedDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE partysvc.respondent").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	tx, err := db.BeginTx(ctx, nil)
+	assert.Nil(t, err)
+	_, err = tx.ExecContext(ctx, "UPDATE partysvc.respondent SET status = 'ACTIVE'")
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Rollback())
+
+	spans := recorder.Ended()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "db.UPDATE", spans[0].Name())
+	assert.Equal(t, "db.transaction", spans[1].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Contains(t, spans[1].Attributes(), semconv.DBOperationKey.String("ROLLBACK"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPreparedStatementIsOneSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	db, mock := openTracedDB(t)
+
+	prepared := mock.ExpectPrepare("COPY")
+	prepared.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stmt, err := db.PrepareContext(ctx, "COPY partysvc.outbox (kind, payload) FROM STDIN")
+	assert.Nil(t, err)
+	_, err = stmt.ExecContext(ctx, "deactivate_iac", "{}")
+	assert.Nil(t, err)
+	_, err = stmt.ExecContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(recorder.Ended()))
+	stmt.Close()
+
+	spans := recorder.Ended()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "db.COPY", spans[0].Name())
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+var ctx = context.Background()
+
+// Records every span in place of the configured exporter, until the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+func TestMiddlewareRecordsSpanForRoute(t *testing.T) {
+	recorder := recordSpans(t)
+	handler := Middleware("/v2/respondents/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/respondents/abc", nil), nil)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "GET /v2/respondents/:id", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), semconv.HTTPStatusCodeKey.Int(http.StatusInternalServerError))
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestMiddlewareContinuesCallersTrace(t *testing.T) {
+	recorder := recordSpans(t)
+	handler := Middleware("/v2/info", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {})
+	req := httptest.NewRequest(http.MethodGet, "/v2/info", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	handler(httptest.NewRecorder(), req, nil)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+func TestConfigureFileExporter(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(provider)
+	file := filepath.Join(t.TempDir(), "traces.json")
+
+	shutdown, err := Configure(ctx, Config{Exporter: "file", File: file, SampleRatio: 1, Service: "ras-rm-party"})
+	assert.Nil(t, err)
+	_, span := Tracer().Start(ctx, "Resolve enrolment code")
+	span.End()
+	assert.Nil(t, shutdown(ctx))
+
+	written, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Contains(t, string(written), "Resolve enrolment code")
+	assert.Contains(t, string(written), "ras-rm-party")
+}
+
+func TestConfigureWithoutExporter(t *testing.T) {
+	shutdown, err := Configure(ctx, Config{Exporter: "none"})
+
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(ctx))
+}
+
+func TestConfigureRejectsUnknownExporter(t *testing.T) {
+	_, err := Configure(ctx, Config{Exporter: "jaeger"})
+
+	assert.Equal(t, `unknown trace exporter "jaeger"`, err.Error())
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/logging"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/outbox"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/ONSdigital/ras-rm-party/webhooks"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// Returns the outbox handler which queues a delivery of the event recorded in an entry to each webhook subscribed to
+// it. If the entry is retried after its deliveries were queued, e.g. because the dispatcher crashed, webhooks may be
+// sent the event twice, so consumers should ignore event IDs they've already seen.
+func notifyWebhooks(webhookStore store.WebhookStore) outbox.Handler {
+	return func(ctx context.Context, entry models.OutboxEntry) error {
+		var event events.Event
+		if err := json.Unmarshal(entry.Payload, &event); err != nil {
+			return err
+		}
+		queued, err := webhookStore.QueueWebhookDeliveries(ctx, event)
+		if err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Debug("Queued event for webhooks", zap.String("event_id", event.ID), zap.String("event_type", event.Type),
+			zap.Int("webhooks", queued))
+		return nil
+	}
+}
+
+// Returns the outbox handler which delivers an event to a webhook, recording each attempt in its delivery log. Failed
+// deliveries are retried with the outbox's backoff until maxAttempts have been made, after which the event is dropped.
+// Deliveries to webhooks which have since been deleted are dropped too.
+func deliverWebhook(webhookStore store.WebhookStore, sender *webhooks.Sender, maxAttempts int) outbox.Handler {
+	return func(ctx context.Context, entry models.OutboxEntry) error {
+		var payload store.WebhookDeliveryPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return err
+		}
+		logger := logging.FromContext(ctx).With(zap.String("webhook_id", payload.WebhookID), zap.String("event_id", payload.Event.ID))
+
+		webhook, err := webhookStore.GetWebhook(ctx, payload.WebhookID)
+		if err == store.ErrNotFound {
+			logger.Debug("Dropped delivery to deleted webhook")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		attempt := entry.Attempts + 1
+		statusCode, sendErr := sender.Send(ctx, webhook, payload.Event, attempt)
+		delivery := models.WebhookDelivery{
+			WebhookID:  webhook.ID,
+			EventID:    payload.Event.ID,
+			EventType:  payload.Event.Type,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Succeeded:  sendErr == nil,
+			CreatedOn:  time.Now().UTC(),
+		}
+		if sendErr != nil {
+			delivery.Error = sendErr.Error()
+		}
+		if err = webhookStore.RecordWebhookDelivery(ctx, delivery); err != nil {
+			// Retrying would send the event again, so settle for the log missing this attempt
+			logger.Error("Error recording webhook delivery", zap.Error(err))
+		}
+
+		if sendErr != nil && attempt >= maxAttempts {
+			logger.Warn("Gave up delivering event to webhook", zap.Int("attempts", attempt), zap.Error(sendErr))
+			return nil
+		}
+		return sendErr
+	}
+}
+
+// Returns the event types in the list which aren't ones the service publishes
+func unknownEventTypes(eventTypes []string) []string {
+	unknown := []string{}
+	for _, eventType := range eventTypes {
+		known := false
+		for _, knownType := range events.Types {
+			if eventType == knownType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, eventType)
+		}
+	}
+	return unknown
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	hooks := getWebhookStore()
+	if hooks == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	registered, err := hooks.ListWebhooks(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.Webhooks{Data: registered})
+}
+
+func postWebhooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	hooks := getWebhookStore()
+	if hooks == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	var postRequest models.PostWebhooks
+	err := json.NewDecoder(r.Body).Decode(&postRequest)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Invalid JSON",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	missingFields := []string{}
+	if postRequest.Data.URL == "" {
+		missingFields = append(missingFields, "url")
+	}
+	if postRequest.Data.Secret == "" {
+		missingFields = append(missingFields, "secret")
+	}
+
+	if len(missingFields) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Missing required fields: " + strings.Join(missingFields, ", "),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	callback, err := url.Parse(postRequest.Data.URL)
+	if err != nil || (callback.Scheme != "http" && callback.Scheme != "https") || callback.Host == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid URL: " + postRequest.Data.URL,
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	if unknown := unknownEventTypes(postRequest.Data.EventTypes); len(unknown) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Unknown event types: " + strings.Join(unknown, ", "),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	webhook := postRequest.Data
+	webhook.ID = uuid.New().String()
+	webhook.CreatedOn = time.Now().UTC()
+	if webhook.EventTypes == nil {
+		webhook.EventTypes = []string{}
+	}
+	err = hooks.CreateWebhook(r.Context(), webhook)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	webhook.Secret = ""
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.Webhooks{Data: []models.Webhook{webhook}})
+}
+
+func getWebhookByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	webhookID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	hooks := getWebhookStore()
+	if hooks == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	webhook, err := hooks.GetWebhook(r.Context(), webhookID.String())
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Webhook does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	webhook.Secret = ""
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.Webhooks{Data: []models.Webhook{webhook}})
+}
+
+func deleteWebhookByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	webhookID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	hooks := getWebhookStore()
+	if hooks == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	err = hooks.DeleteWebhook(r.Context(), webhookID.String())
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Webhook does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getWebhookDeliveries(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	webhookID, err := uuid.Parse(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorString := models.Error{
+			Error: "Not a valid ID: " + p.ByName("id"),
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	hooks := getWebhookStore()
+	if hooks == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errorString := models.Error{
+			Error: "Database connection could not be found",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+
+	deliveries, err := hooks.WebhookDeliveries(r.Context(), webhookID.String())
+	if err == store.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errorString := models.Error{
+			Error: "Webhook does not exist",
+		}
+		json.NewEncoder(w).Encode(errorString)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.WebhookDeliveries{Data: deliveries})
+}
@@ -0,0 +1,158 @@
+// Package webhooks sends the service's events to the callback URLs consumers have registered, signed with each
+// webhook's secret so that consumers can check a delivery came from the party service and hasn't been replayed.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/metrics"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers sent with each delivery
+const (
+	// SignatureHeader carries the time the delivery was signed and the signature, as "t=<unix seconds>,v1=<hex>"
+	SignatureHeader = "X-Party-Signature"
+	EventIDHeader   = "X-Party-Event-Id"
+	EventTypeHeader = "X-Party-Event-Type"
+	// AttemptHeader is which attempt at delivering the event this is, counting from 1
+	AttemptHeader = "X-Party-Delivery-Attempt"
+)
+
+// Sign returns the signature header for a delivery of the body at the time provided. The signature is the hex
+// HMAC-SHA256, keyed with the webhook's secret, of the unix time in seconds, a full stop and the body.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(signature(secret, unix, body))
+}
+
+func signature(secret, unix string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Verify checks a signature header made by Sign, as a consumer would. Signatures more than tolerance away from now
+// are rejected, so that old deliveries can't be replayed.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value := part, ""
+		if idx := strings.Index(part, "="); idx >= 0 {
+			key, value = part[:idx], part[idx+1:]
+		}
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return errors.New("signature has no valid timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp is outside the tolerance")
+	}
+
+	expected := signature(secret, unix, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return errors.New("no matching signature")
+}
+
+// Sender posts events to webhooks
+type Sender struct {
+	httpClient *http.Client
+}
+
+// NewSender returns a sender which makes its requests with the HTTP client provided, or the default client if it's nil
+func NewSender(httpClient *http.Client) *Sender {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Sender{httpClient: httpClient}
+}
+
+// Send posts the event to the webhook's URL as JSON, signed with its secret, and returns the status code of the
+// response, or 0 if there wasn't one. Any response other than a 2xx is an error.
+func (s *Sender) Send(ctx context.Context, webhook models.Webhook, event events.Event, attempt int) (int, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "webhook POST",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPMethodKey.String(http.MethodPost)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	statusCode, err := s.send(ctx, webhook, event, attempt)
+	tracing.RecordError(span, err)
+	if statusCode != 0 {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(statusCode))
+	}
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	metrics.ObserveOutbound("webhook", http.MethodPost, outcome, time.Since(start))
+	return statusCode, err
+}
+
+func (s *Sender) send(ctx context.Context, webhook models.Webhook, event events.Event, attempt int) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now(), body))
+	req.Header.Set(EventIDHeader, event.ID)
+	req.Header.Set(EventTypeHeader, event.Type)
+	req.Header.Set(AttemptHeader, strconv.Itoa(attempt))
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		// Drain the body so that the connection can be reused
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("received status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
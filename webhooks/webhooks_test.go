@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func TestSignAndVerify(t *testing.T) {
+	signedAt := time.Unix(1635757200, 0)
+	body := []byte(`{"type":"respondent.created"}`)
+
+	header := Sign("shh", signedAt, body)
+
+	assert.Regexp(t, "^t=1635757200,v1=[0-9a-f]{64}$", header)
+	assert.Nil(t, Verify("shh", header, body, signedAt.Add(time.Minute), 5*time.Minute))
+	assert.EqualError(t, Verify("wrong", header, body, signedAt, 5*time.Minute), "no matching signature")
+	assert.EqualError(t, Verify("shh", header, []byte(`{"type":"respondent.deleted"}`), signedAt, 5*time.Minute), "no matching signature")
+	assert.EqualError(t, Verify("shh", header, body, signedAt.Add(time.Hour), 5*time.Minute), "signature timestamp is outside the tolerance")
+	assert.EqualError(t, Verify("shh", "v1=abc", body, signedAt, 5*time.Minute), "signature has no valid timestamp")
+}
+
+func TestSendPostsSignedEvent(t *testing.T) {
+	event, err := events.New(events.RespondentCreated, events.RespondentCreatedVersion, events.RespondentCreatedData{RespondentID: "be70e086-7bbc-461c-a565-5b454d748a71"})
+	assert.Nil(t, err)
+
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	webhook := models.Webhook{ID: "6c4a2b5e-4c4e-4b8e-9a44-53a3c4f26e1b", URL: server.URL + "/party-events", Secret: "shh"}
+	statusCode, err := NewSender(nil).Send(ctx, webhook, event, 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, statusCode)
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "/party-events", received.URL.Path)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, event.ID, received.Header.Get(EventIDHeader))
+	assert.Equal(t, events.RespondentCreated, received.Header.Get(EventTypeHeader))
+	assert.Equal(t, "2", received.Header.Get(AttemptHeader))
+	assert.Nil(t, Verify("shh", received.Header.Get(SignatureHeader), body, time.Now(), time.Minute))
+	assert.Contains(t, string(body), `"respondentId":"be70e086-7bbc-461c-a565-5b454d748a71"`)
+}
+
+func TestSendFailsUnlessResponseIsSuccessful(t *testing.T) {
+	event, _ := events.New(events.RespondentCreated, events.RespondentCreatedVersion, events.RespondentCreatedData{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	statusCode, err := NewSender(nil).Send(ctx, models.Webhook{URL: server.URL, Secret: "shh"}, event, 1)
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode)
+	assert.EqualError(t, err, "received status code 503")
+
+	server.Close()
+	statusCode, err = NewSender(nil).Send(ctx, models.Webhook{URL: server.URL, Secret: "shh"}, event, 1)
+	assert.Equal(t, 0, statusCode)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/ras-rm-party/auth"
+	"github.com/ONSdigital/ras-rm-party/events"
+	"github.com/ONSdigital/ras-rm-party/models"
+	"github.com/ONSdigital/ras-rm-party/store"
+	"github.com/ONSdigital/ras-rm-party/webhooks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// Registers a webhook through the API and returns it as the response describes it
+func registerWebhook(t *testing.T, webhook models.Webhook) models.Webhook {
+	jsonOut, err := json.Marshal(models.PostWebhooks{Data: webhook})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'POST /webhooks', ", err.Error())
+	}
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v2/webhooks", bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.Webhooks
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'POST /webhooks', ", err.Error())
+	}
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	return response.Data[0]
+}
+
+// A consumer's callback endpoint, which records the deliveries it's sent and fails the first few
+type webhookReceiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	failures   int
+	deliveries []*http.Request
+	bodies     [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, failures int) *webhookReceiver {
+	receiver := &webhookReceiver{failures: failures}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.deliveries = append(receiver.deliveries, r)
+		receiver.bodies = append(receiver.bodies, body)
+		if len(receiver.deliveries) <= receiver.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func TestPostWebhooks(t *testing.T) {
+	setup()
+	memory := useMemoryStore(t)
+
+	webhook := registerWebhook(t, models.Webhook{URL: "https://example.com/party-events", EventTypes: []string{events.RespondentCreated}, Secret: "shh"})
+
+	assert.NotEmpty(t, webhook.ID)
+	assert.Equal(t, "https://example.com/party-events", webhook.URL)
+	assert.Equal(t, []string{events.RespondentCreated}, webhook.EventTypes)
+	assert.Empty(t, webhook.Secret)
+	stored, err := memory.GetWebhook(context.Background(), webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "shh", stored.Secret)
+}
+
+func TestPostWebhooksReturns400IfInvalid(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	for webhook, expected := range map[string]string{
+		`{"data":{}}`: "Missing required fields: url, secret",
+		`{"data":{"url":"ftp://example.com","secret":"shh"}}`:                          "Not a valid URL: ftp://example.com",
+		`{"data":{"url":"/party-events","secret":"shh"}}`:                              "Not a valid URL: /party-events",
+		`{"data":{"url":"https://example.com","secret":"shh","eventTypes":["a","b"]}}`: "Unknown event types: a, b",
+		`{"data":`: "Invalid JSON",
+	} {
+		resp = httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v2/webhooks", bytes.NewBufferString(webhook))
+		req.SetBasicAuth("admin", "secret")
+		router.ServeHTTP(resp, req)
+
+		var errResp models.Error
+		err := json.NewDecoder(resp.Body).Decode(&errResp)
+		if err != nil {
+			t.Fatal("Error decoding JSON response from 'POST /webhooks', ", err.Error())
+		}
+		assert.Equal(t, http.StatusBadRequest, resp.Code, webhook)
+		assert.Equal(t, expected, errResp.Error, webhook)
+	}
+}
+
+func TestGetWebhooksLeavesOutSecrets(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+	first := registerWebhook(t, models.Webhook{URL: "https://example.com/all", Secret: "shh"})
+	registerWebhook(t, models.Webhook{URL: "https://example.com/businesses", EventTypes: []string{events.BusinessCreated}, Secret: "hush"})
+
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v2/webhooks", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.Webhooks
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /webhooks', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 2, len(response.Data))
+	assert.Equal(t, first.ID, response.Data[0].ID)
+	assert.Equal(t, []string{}, response.Data[0].EventTypes)
+	for _, webhook := range response.Data {
+		assert.Empty(t, webhook.Secret)
+	}
+}
+
+func TestGetWebhookByID(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+	webhook := registerWebhook(t, models.Webhook{URL: "https://example.com/all", Secret: "shh"})
+
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v2/webhooks/"+webhook.ID, nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.Webhooks
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /webhooks/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, webhook.ID, response.Data[0].ID)
+	assert.Empty(t, response.Data[0].Secret)
+}
+
+func TestGetWebhookByIDReturns404IfNotFound(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/webhooks/6c4a2b5e-4c4e-4b8e-9a44-53a3c4f26e1b", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /webhooks/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Webhook does not exist", errResp.Error)
+}
+
+func TestGetWebhookByIDReturns400IfIDInvalid(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/webhooks/not-a-uuid", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /webhooks/{id}', ", err.Error())
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Not a valid ID: not-a-uuid", errResp.Error)
+}
+
+func TestDeleteWebhookByID(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+	webhook := registerWebhook(t, models.Webhook{URL: "https://example.com/all", Secret: "shh"})
+
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/v2/webhooks/"+webhook.ID, nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "/v2/webhooks/"+webhook.ID, nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestGetWebhookDeliveriesReturns404IfNotFound(t *testing.T) {
+	setup()
+	useMemoryStore(t)
+
+	req := httptest.NewRequest("GET", "/v2/webhooks/6c4a2b5e-4c4e-4b8e-9a44-53a3c4f26e1b/deliveries", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var errResp models.Error
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /webhooks/{id}/deliveries', ", err.Error())
+	}
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "Webhook does not exist", errResp.Error)
+}
+
+func TestWebhooksRequireScope(t *testing.T) {
+	useMemoryStore(t)
+	useClients(t, auth.ClientConfig{Name: "frontstage", User: "frontstage", Password: "frontstage-secret",
+		Scopes: []string{auth.ReadRespondents, auth.WriteRespondents}})
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/webhooks", nil)
+	req.SetBasicAuth("frontstage", "frontstage-secret")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestPatchRespondentsDeliversSignedEventsToWebhooks(t *testing.T) {
+	setup()
+	viper.Set("outbox_min_backoff", "0s")
+	defer viper.Set("outbox_min_backoff", "10s")
+	// The receiver's on loopback
+	viper.Set("webhook_allow_private_hosts", true)
+	defer viper.Set("webhook_allow_private_hosts", false)
+	memory := useMemoryStore(t)
+	memory.CreateRespondent(context.Background(), postReq.Data.Attributes, nil)
+	dispatcher := newOutboxDispatcher(memory, memory, nil)
+	dispatcher.DispatchDue(context.Background())
+
+	receiver := newWebhookReceiver(t, 1)
+	webhook := registerWebhook(t, models.Webhook{URL: receiver.URL, EventTypes: []string{events.RespondentEmailChanged}, Secret: "shh"})
+	registerWebhook(t, models.Webhook{URL: receiver.URL + "/businesses", EventTypes: []string{events.BusinessUpdated}, Secret: "hush"})
+
+	jsonOut, err := json.Marshal(models.PostRespondents{Data: models.Respondent{Attributes: models.Attributes{EmailAddress: "robert@boblaw.com"}}})
+	if err != nil {
+		t.Fatal("Error encoding JSON request body for 'PATCH /respondents/{id}', ", err.Error())
+	}
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("PATCH", "/v2/respondents/"+postReq.Data.Attributes.ID, bytes.NewBuffer(jsonOut))
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Dispatching the event queues a delivery to the subscribed webhook, which fails the first time, and is retried
+	// once its backoff has passed
+	for attempt := 0; attempt < 3; attempt++ {
+		_, err = dispatcher.DispatchDue(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, attempt, len(receiver.deliveries))
+	}
+
+	assert.Equal(t, 2, len(receiver.deliveries))
+	delivered := receiver.deliveries[1]
+	assert.Equal(t, events.RespondentEmailChanged, delivered.Header.Get(webhooks.EventTypeHeader))
+	assert.Equal(t, "2", delivered.Header.Get(webhooks.AttemptHeader))
+	assert.Nil(t, webhooks.Verify("shh", delivered.Header.Get(webhooks.SignatureHeader), receiver.bodies[1], time.Now(), time.Minute))
+	var event events.Event
+	assert.Nil(t, json.Unmarshal(receiver.bodies[1], &event))
+	assert.JSONEq(t, `{"respondentId":"`+postReq.Data.Attributes.ID+`","previousEmailAddress":"`+postReq.Data.Attributes.EmailAddress+
+		`","emailAddress":"robert@boblaw.com"}`, string(event.Data))
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/v2/webhooks/"+webhook.ID+"/deliveries", nil)
+	req.SetBasicAuth("admin", "secret")
+	router.ServeHTTP(resp, req)
+
+	var response models.WebhookDeliveries
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Error decoding JSON response from 'GET /webhooks/{id}/deliveries', ", err.Error())
+	}
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 2, len(response.Data))
+	assert.True(t, response.Data[0].Succeeded)
+	assert.Equal(t, http.StatusNoContent, response.Data[0].StatusCode)
+	assert.Equal(t, event.ID, response.Data[0].EventID)
+	assert.False(t, response.Data[1].Succeeded)
+	assert.Equal(t, "received status code 503", response.Data[1].Error)
+}
+
+func TestDeliverWebhookGivesUpAfterMaxAttempts(t *testing.T) {
+	memory := store.NewMemory()
+	receiver := newWebhookReceiver(t, 10)
+	webhook := models.Webhook{ID: "6c4a2b5e-4c4e-4b8e-9a44-53a3c4f26e1b", URL: receiver.URL, Secret: "shh"}
+	assert.Nil(t, memory.CreateWebhook(context.Background(), webhook))
+	event, _ := events.New(events.RespondentCreated, events.RespondentCreatedVersion, events.RespondentCreatedData{})
+	payload, _ := json.Marshal(store.WebhookDeliveryPayload{WebhookID: webhook.ID, Event: event})
+	deliver := deliverWebhook(memory, webhooks.NewSender(nil), 3)
+
+	err := deliver(context.Background(), models.OutboxEntry{ID: 1, Kind: store.OutboxDeliverWebhook, Payload: payload, Attempts: 1})
+	assert.EqualError(t, err, "received status code 503")
+	err = deliver(context.Background(), models.OutboxEntry{ID: 1, Kind: store.OutboxDeliverWebhook, Payload: payload, Attempts: 2})
+	assert.Nil(t, err)
+
+	deliveries, err := memory.WebhookDeliveries(context.Background(), webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(deliveries))
+	assert.Equal(t, 3, deliveries[0].Attempt)
+}
+
+func TestDeliverWebhookDropsDeliveriesToDeletedWebhooks(t *testing.T) {
+	event, _ := events.New(events.RespondentCreated, events.RespondentCreatedVersion, events.RespondentCreatedData{})
+	payload, _ := json.Marshal(store.WebhookDeliveryPayload{WebhookID: "6c4a2b5e-4c4e-4b8e-9a44-53a3c4f26e1b", Event: event})
+
+	err := deliverWebhook(store.NewMemory(), webhooks.NewSender(nil), 3)(context.Background(),
+		models.OutboxEntry{ID: 1, Kind: store.OutboxDeliverWebhook, Payload: payload})
+
+	assert.Nil(t, err)
+}